@@ -3,18 +3,25 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
+	"fmt"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"codeberg.org/tslocum/bgammon"
 	"codeberg.org/tslocum/boxcars/game"
+	"codeberg.org/tslocum/boxcars/render"
+	"codeberg.org/tslocum/boxcars/replay"
 	"github.com/hajimehoshi/ebiten/v2"
 )
 
@@ -57,7 +64,121 @@ func openBoxcars(boxcarsPath string, matchID int) {
 	}
 }
 
+// parseSize parses an image size in the format WIDTHxHEIGHT.
+func parseSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(size), "x")
+	width, err := strconv.Atoi(w)
+	if !ok || err != nil || width < 1 {
+		return 0, 0, fmt.Errorf("invalid size: %s", size)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height < 1 {
+		return 0, 0, fmt.Errorf("invalid size: %s", size)
+	}
+	return width, height, nil
+}
+
+// loadReplayFrames returns the state of each game in the provided replay file
+// before each action and after the last action.
+func loadReplayFrames(replayPath string) ([]*bgammon.Game, error) {
+	data, err := os.ReadFile(replayPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay file %s: %s", replayPath, err)
+	}
+	data, err = replay.Import(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import replay file %s: %s", replayPath, err)
+	}
+	m, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse replay file %s: %s", replayPath, err)
+	}
+	var frames []*bgammon.Game
+	for _, g := range m.Games {
+		gameFrames, err := g.Frames()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse replay file %s: %s", replayPath, err)
+		}
+		frames = append(frames, gameFrames...)
+	}
+	return frames, nil
+}
+
+// loadPosition returns the final position of the provided replay file, or the
+// position described by the provided GNU Backgammon position ID.
+func loadPosition(position string) (*bgammon.Game, error) {
+	_, err := os.Stat(position)
+	if os.IsNotExist(err) {
+		return replay.ParsePositionID(position)
+	}
+	frames, err := loadReplayFrames(position)
+	if err != nil {
+		return nil, err
+	}
+	return frames[len(frames)-1], nil
+}
+
+// renderPosition draws the provided position to a PNG image file.
+func renderPosition(position string, out string, size string) error {
+	width, height, err := parseSize(size)
+	if err != nil {
+		return err
+	}
+	g, err := loadPosition(position)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create image file %s: %s", out, err)
+	}
+	err = png.Encode(f, render.Position(g, width, height))
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write image file %s: %s", out, err)
+	}
+	return nil
+}
+
+// runRender runs the render command, which draws a position to a PNG image
+// without a window.
+func runRender(args []string) error {
+	var (
+		position string
+		out      string
+		size     string
+	)
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s render --position <id|file> [--out pos.png] [--size WIDTHxHEIGHT]\n", filepath.Base(os.Args[0]))
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&position, "position", "", "GNU Backgammon position ID, or replay file (match, mat, txt or sgf) whose final position is drawn")
+	flags.StringVar(&out, "out", "position.png", "Image file to write")
+	flags.StringVar(&size, "size", "1024x768", "Size of image in pixels (WIDTHxHEIGHT)")
+	flags.Parse(args)
+
+	if position == "" && flags.NArg() > 0 {
+		position = flags.Arg(0)
+	}
+	if position == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return renderPosition(position, out, size)
+}
+
 func parseFlags() *game.Game {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		err := runRender(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	var (
 		username      string
 		password      string
@@ -69,6 +190,25 @@ func parseFlags() *game.Game {
 		locale        string
 		join          int
 		tv            bool
+		record        string
+		playback      string
+		tui           bool
+		tlsCA         string
+		tlsCert       string
+		tlsKey        string
+		tlsInsecure   bool
+		proxy         string
+		profile       string
+		savePassword  bool
+		simulate      int
+		variant       string
+		export        string
+		position      string
+		gifReplay     string
+		out           string
+		size          string
+		delay         time.Duration
+		gifMotion     bool
 		debug         int
 	)
 	flag.StringVar(&username, "username", "", "Username")
@@ -81,9 +221,79 @@ func parseFlags() *game.Game {
 	flag.StringVar(&locale, "locale", "", "Use specified locale for translations")
 	flag.IntVar(&join, "join", 0, "Connect as guest and join specified match")
 	flag.BoolVar(&tv, "tv", false, "Spectate games continuously")
+	flag.StringVar(&record, "record", "", "Record protocol traffic to specified session file")
+	flag.StringVar(&playback, "playback", "", "Play back specified session file instead of connecting to a server")
+	flag.StringVar(&tlsCA, "tls-ca", "", "Verify tls:// servers using the certificate authorities in specified PEM file")
+	flag.StringVar(&tlsCert, "tls-cert", "", "Present client certificate in specified PEM file to tls:// servers")
+	flag.StringVar(&tlsKey, "tls-key", "", "Private key for client certificate")
+	flag.BoolVar(&tlsInsecure, "tls-insecure", false, "Skip verifying certificates of tls:// servers (for local testing only)")
+	flag.StringVar(&profile, "profile", "", "Connect using specified server profile, creating it from the provided address, username and locale when it does not exist")
+	flag.BoolVar(&savePassword, "save-password", false, "Save the provided password in the server profile (stored in plain text)")
+	flag.StringVar(&proxy, "proxy", "", "Connect via specified SOCKS5 (socks5://host:port) or HTTP (http://host:port) proxy, or none to ignore proxy environment variables")
+	flag.BoolVar(&tui, "tui", false, "Play in the terminal using a text-mode interface")
+	flag.IntVar(&simulate, "simulate", 0, "Play specified number of matches between two bots without a user interface, then report the results and save each match as a replay")
+	flag.StringVar(&variant, "variant", "backgammon", "Variant of simulated matches (backgammon, acey-deucey or tabula)")
+	flag.StringVar(&export, "export", "", "Convert specified replay file (match, mat, txt or sgf) to match, mat (GNU Backgammon) or txt (Jellyfish) format and write it to standard output, then exit")
+	flag.StringVar(&position, "position", "", "Alias of the render command: draw specified GNU Backgammon position ID, or the final position of specified replay file, to a PNG image without a window, then exit")
+	flag.StringVar(&gifReplay, "gif", "", "Draw specified replay file (match, mat, txt or sgf) to an animated GIF image without a window, then exit")
+	flag.StringVar(&out, "out", "", "Image file to write when drawing a position or replay (default position.png, or the replay file name with a .gif extension)")
+	flag.StringVar(&size, "size", "1024x768", "Size of drawn images in pixels (WIDTHxHEIGHT)")
+	flag.DurationVar(&delay, "delay", time.Second, "Delay between frames of animated GIF images")
+	flag.BoolVar(&gifMotion, "gif-motion", true, "Draw checkers moving between spaces in animated GIF images (use --gif-motion=false to only draw the position after each move)")
 	flag.IntVar(&debug, "debug", 0, "Debug level")
 	flag.Parse()
 
+	forcedLocale := locale
+	if profile != "" {
+		p, err := game.LoadProfile(profile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if p == nil {
+			p = &game.ServerProfile{
+				Name:     profile,
+				Address:  serverAddress,
+				Username: username,
+				Locale:   locale,
+			}
+			if savePassword {
+				p.Password = password
+			}
+		} else {
+			// Settings provided via flags take precedence over the profile.
+			flag.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "address":
+					p.Address = serverAddress
+				case "username":
+					p.Username = username
+				case "password":
+					if savePassword {
+						p.Password = password
+					}
+				case "locale":
+					p.Locale = locale
+				}
+			})
+		}
+		err = game.SaveProfile(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		serverAddress, username, locale = p.Address, p.Username, p.Locale
+		if password == "" {
+			password = p.Password
+		}
+	} else if locale == "" {
+		// Use the locale of the most recently used profile.
+		p, err := game.LoadProfile("")
+		if err != nil {
+			log.Printf("warning: %s", err)
+		} else if p != nil {
+			locale = p.Locale
+		}
+	}
+
 	if game.DefaultFullscreen() {
 		fullscreen = true
 	}
@@ -97,6 +307,112 @@ func parseFlags() *game.Game {
 	}
 	game.LoadLocale(locale)
 
+	if tlsCA != "" || tlsCert != "" || tlsKey != "" || tlsInsecure {
+		err := game.ConfigureTLS(tlsCA, tlsCert, tlsKey, tlsInsecure)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if proxy != "" {
+		err := game.SetProxy(proxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if debug > 0 {
+		game.Debug = int8(debug)
+	}
+
+	if record != "" {
+		err := game.RecordSession(record)
+		if err != nil {
+			log.Fatalf("failed to record session to %s: %s", record, err)
+		}
+	}
+
+	if tui {
+		err := game.RunTerminal(serverAddress, username, password)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if export != "" {
+		format, err := replay.ParseFormat(export)
+		if err != nil {
+			log.Fatal(err)
+		} else if len(flag.Args()) == 0 {
+			log.Fatal("no replay file specified")
+		}
+		data, err := os.ReadFile(flag.Arg(0))
+		if err != nil {
+			log.Fatalf("failed to open replay file %s: %s", flag.Arg(0), err)
+		}
+		converted, err := replay.Convert(data, format)
+		if err != nil {
+			log.Fatalf("failed to convert replay file %s: %s", flag.Arg(0), err)
+		}
+		os.Stdout.Write(converted)
+		os.Exit(0)
+	}
+
+	if position != "" {
+		if out == "" {
+			out = "position.png"
+		}
+		err := renderPosition(position, out, size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
+	if gifReplay != "" {
+		width, height, err := parseSize(size)
+		if err != nil {
+			log.Fatal(err)
+		}
+		frames, err := loadReplayFrames(gifReplay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if out == "" {
+			out = strings.TrimSuffix(filepath.Base(gifReplay), filepath.Ext(gifReplay)) + ".gif"
+		}
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatalf("failed to create image file %s: %s", out, err)
+		}
+		err = render.EncodeGIF(f, frames, &render.GIFOptions{
+			Width:  width,
+			Height: height,
+			Delay:  delay,
+			Motion: gifMotion,
+		})
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			log.Fatalf("failed to write image file %s: %s", out, err)
+		}
+		os.Exit(0)
+	}
+
+	if simulate > 0 {
+		v, err := game.ParseVariant(variant)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = game.Simulate(simulate, v, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+
 	g := game.NewGame()
 	g.Username = username
 	g.Password = password
@@ -104,16 +420,15 @@ func parseFlags() *game.Game {
 	g.Mute = mute
 	g.Instant = instant
 	g.JoinGame = join
+	g.Playback = playback
+	g.Profile = profile
+	g.Locale = forcedLocale
 
 	if fullscreen && !windowed {
 		g.Fullscreen = true
 		ebiten.SetFullscreen(true)
 	}
 
-	if debug > 0 {
-		game.Debug = int8(debug)
-	}
-
 	if len(flag.Args()) > 0 {
 		replay, err := os.ReadFile(flag.Arg(0))
 		if err != nil {
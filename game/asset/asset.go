@@ -0,0 +1,9 @@
+// Package asset provides the images and fonts used to draw the board.
+package asset
+
+import "embed"
+
+// FS contains the image and font assets.
+//
+//go:embed image font
+var FS embed.FS
@@ -6,14 +6,17 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"log"
 	"math"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/render"
 	"codeberg.org/tslocum/etk"
 	"codeberg.org/tslocum/gotext"
 	"codeberg.org/tslocum/tabula"
@@ -59,6 +62,7 @@ type board struct {
 	lastPoints       int8
 	lastDoubleValue  int8
 	lastDoublePlayer int8
+	lastRotated      bool
 	lastVariant      int8
 	lastIconPlayer   int
 	lastIconOpponent int
@@ -116,6 +120,7 @@ type board struct {
 
 	timerLabel     *etk.Text
 	clockLabel     *etk.Text
+	latencyLabel   *etk.Text
 	showMenuButton *etk.Button
 
 	menuGrid *etk.Grid
@@ -124,6 +129,11 @@ type board struct {
 	changePasswordNew    *Input
 	changePasswordDialog *Dialog
 
+	exportGIFWidth  *Input
+	exportGIFHeight *Input
+	exportGIFDelay  *Input
+	exportGIFDialog *Dialog
+
 	muteJoinLeaveCheckbox *etk.Checkbox
 	muteChatCheckbox      *etk.Checkbox
 	muteRollCheckbox      *etk.Checkbox
@@ -138,6 +148,8 @@ type board struct {
 	traditionalCheckbox      *etk.Checkbox
 	advancedMovementCheckbox *etk.Checkbox
 	autoPlayCheckbox         *etk.Checkbox
+	passScreenCheckbox       *etk.Checkbox
+	fixedBoardCheckbox       *etk.Checkbox
 	selectDim                *etk.Select
 	selectSpeed              *etk.Select
 	accountGrid              *etk.Grid
@@ -145,16 +157,25 @@ type board struct {
 
 	matchStatusGrid *etk.Grid
 
-	replayAuto        time.Time
-	replayPauseButton *etk.Button
-	replayList        *etk.List
-	replayGrid        *etk.Grid
+	replayAuto          time.Time
+	replaySpeed         atomic.Int32 // Index of the autoplay speed in replaySpeeds, read by the autoplay goroutine.
+	replaySpeedSelect   *etk.Select
+	replayTimeline      *replayTimeline
+	replayPauseButton   *etk.Button
+	replayAnalyzeButton *etk.Button
+	replayList          *etk.List
+	replayGrid          *etk.Grid
+
+	editing bool // Whether a position is being set up in the board editor.
+	editor  *positionEditor
 
 	inputGrid *etk.Grid
 	uiGrid    *etk.Grid
 	frame     *etk.Frame
 
 	leaveMatchDialog *Dialog
+	passDeviceDialog *Dialog
+	passDeviceLabel  *etk.Text
 
 	fontSize   int
 	lineHeight int
@@ -167,6 +188,9 @@ type board struct {
 	showMoves          bool
 	flipBoard          bool
 	traditional        bool
+	hotSeatPassScreen  bool
+	hotSeatFixedBoard  bool
+	rotated            bool // Whether the board is drawn rotated, keeping the perspective of hot-seat matches fixed.
 	advancedMovement   bool
 	muteJoinLeave      bool
 	muteChat           bool
@@ -209,6 +233,7 @@ func NewBoard() *board {
 		horizontalBorderSize: 20 + extraBorder,
 		verticalBorderSize:   float64(baseBoardVerticalSize) + extraBorder,
 		overlapSize:          97,
+		hotSeatPassScreen:    true,
 		Sprites: &Sprites{
 			sprites: make([]*Sprite, 30),
 			num:     30,
@@ -254,6 +279,8 @@ func NewBoard() *board {
 		Mutex:                   &sync.Mutex{},
 	}
 
+	b.loadHotSeatSettings()
+
 	b.createRatingLabels()
 	b.createForcedLabels()
 
@@ -309,12 +336,14 @@ func NewBoard() *board {
 	b.createMenu()
 	b.createChangePasswordDialog()
 	b.createMuteSoundsDialog()
+	b.createExportGIFDialog()
 
 	b.rematchButton = etk.NewButton(gotext.Get("Rematch"), b.selectRematch)
 	b.rematchButton.SetVisible(false)
 
 	b.createSettingsDialog()
 	b.createLeaveMatchDialog()
+	b.createPassDeviceDialog()
 
 	b.createMatchStatus()
 
@@ -324,6 +353,7 @@ func NewBoard() *board {
 
 	b.createReplayControls()
 	b.createReplayList()
+	b.createEditorControls()
 
 	b.uiGrid.SetBackground(frameColor)
 	b.recreateUIGrid()
@@ -369,6 +399,7 @@ func (b *board) fontUpdated() {
 
 	b.timerLabel.SetFont(etk.Style.TextFont, etk.Scale(b.fontSize))
 	b.clockLabel.SetFont(etk.Style.TextFont, etk.Scale(b.fontSize))
+	b.latencyLabel.SetFont(etk.Style.TextFont, etk.Scale(b.fontSize))
 
 	b.opponentMovesLabel.SetFont(etk.Style.TextFont, game.bufferFontSize)
 	b.playerMovesLabel.SetFont(etk.Style.TextFont, game.bufferFontSize)
@@ -494,17 +525,14 @@ func (b *board) confirmLeaveMatch() error {
 		ev := &bgammon.EventLeft{}
 		ev.Player = b.client.Username
 		b.client.Events <- ev
-		if !b.replayAuto.IsZero() {
-			b.replayAuto = time.Time{}
-			b.replayPauseButton.SetText("▶")
-		}
+		b.stopReplayAuto()
 		b.recreateUIGrid()
 	} else {
 		game.leavingMatch = true
 		if b.cancelAnimation != nil {
 			b.cancelAnimation()
 		}
-		b.client.Out <- []byte("leave")
+		b.client.Send([]byte("leave"))
 	}
 	return nil
 }
@@ -552,6 +580,7 @@ func (b *board) hideMenu() error {
 	b.changePasswordDialog.SetVisible(false)
 	b.changePasswordOld.SetText("")
 	b.changePasswordNew.SetText("")
+	b.exportGIFDialog.SetVisible(false)
 	return nil
 }
 
@@ -568,13 +597,13 @@ func (b *board) toggleMenu() error {
 }
 
 func (b *board) selectRoll() error {
-	b.client.Out <- []byte("roll")
+	b.client.Send([]byte("roll"))
 	return nil
 }
 
 func (b *board) selectRollFunc(value int) func() error {
 	return func() error {
-		b.client.Out <- []byte(fmt.Sprintf("ok %d", value))
+		b.client.Send([]byte(fmt.Sprintf("ok %d", value)))
 		return nil
 	}
 }
@@ -584,7 +613,7 @@ func (b *board) selectOK() error {
 		b.selectRollGrid.SetVisible(true)
 		return nil
 	}
-	b.client.Out <- []byte("ok")
+	b.client.Send([]byte("ok"))
 	return nil
 }
 
@@ -606,7 +635,7 @@ func (b *board) _selectUndo() {
 	b._positionCheckers()
 
 	lastMove := b.gameState.Moves[l-1]
-	b.client.Out <- []byte(fmt.Sprintf("mv %d/%d", lastMove[1], lastMove[0]))
+	b.client.Send([]byte(fmt.Sprintf("mv %d/%d", lastMove[1], lastMove[0])))
 
 	playSoundEffect(effectMove)
 	b.movePiece(lastMove[1], lastMove[0], false)
@@ -619,23 +648,26 @@ func (b *board) selectUndo() error {
 }
 
 func (b *board) selectDouble() error {
-	b.client.Out <- []byte("double")
+	b.client.Send([]byte("double"))
 	return nil
 }
 
 func (b *board) selectResign() error {
-	b.client.Out <- []byte("resign")
+	b.client.Send([]byte("resign"))
 	return nil
 }
 
 func (b *board) selectRematch() error {
-	b.client.Out <- []byte("rematch")
+	b.client.Send([]byte("rematch"))
+	if game.hotSeat != nil {
+		game.hotSeat.inactive().Send([]byte("rematch"))
+	}
 	b.rematchButton.SetVisible(false)
 	return nil
 }
 
 func (b *board) selectChangePassword() error {
-	b.client.Out <- []byte(fmt.Sprintf("password %s %s", strings.ReplaceAll(b.changePasswordOld.Text(), " ", "_"), strings.ReplaceAll(b.changePasswordNew.Text(), " ", "_")))
+	b.client.Send([]byte(fmt.Sprintf("password %s %s", strings.ReplaceAll(b.changePasswordOld.Text(), " ", "_"), strings.ReplaceAll(b.changePasswordNew.Text(), " ", "_"))))
 	return b.hideMenu()
 }
 
@@ -644,7 +676,7 @@ func (b *board) confirmSelectDim(index int) (accept bool) {
 		return false
 	}
 	b.dim = int8(index)
-	b.client.Out <- []byte(fmt.Sprintf("set dim %d", b.dim))
+	b.client.Send([]byte(fmt.Sprintf("set dim %d", b.dim)))
 	return true
 }
 
@@ -653,44 +685,49 @@ func (b *board) confirmSelectSpeed(index int) (accept bool) {
 		return false
 	}
 	b.speed = int8(index)
-	b.client.Out <- []byte(fmt.Sprintf("set speed %d", b.speed))
+	b.client.Send([]byte(fmt.Sprintf("set speed %d", b.speed)))
 	return true
 }
 
-func (b *board) selectReplayStart() error {
-	if !game.replay {
-		return nil
-	}
-
+// stopReplayAuto stops autoplay of the replay.
+func (b *board) stopReplayAuto() {
 	if !b.replayAuto.IsZero() {
 		b.replayAuto = time.Time{}
 		b.replayPauseButton.SetText("▶")
 	}
+}
+
+// seekReplay stops autoplay and shows a replay frame without animation.
+func (b *board) seekReplay(replayFrame int) {
+	b.stopReplayAuto()
 
 	b.playerRoll1, b.playerRoll2, b.playerRoll3 = 0, 0, 0
 	b.opponentRoll1, b.opponentRoll2, b.opponentRoll3 = 0, 0, 0
-	game.showReplayFrame(0, false)
+	game.showReplayFrame(replayFrame, false)
+}
+
+func (b *board) selectReplayStart() error {
+	if !game.replay {
+		return nil
+	}
+	b.seekReplay(0)
 	return nil
 }
 
+// selectReplayJumpBack jumps to the start of the current game, or to the start
+// of the previous game when the current game is already at its start.
 func (b *board) selectReplayJumpBack() error {
 	if !game.replay {
 		return nil
 	}
-
-	if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
+	replayFrame := game.replayFrame - 1
+	for replayFrame > 0 && !game.replayFrames[replayFrame].gameStart {
+		replayFrame--
 	}
-
-	b.playerRoll1, b.playerRoll2, b.playerRoll3 = 0, 0, 0
-	b.opponentRoll1, b.opponentRoll2, b.opponentRoll3 = 0, 0, 0
-	replayFrame := game.replayFrame
-	replayFrame--
 	if replayFrame < 0 {
 		replayFrame = 0
 	}
-	game.showReplayFrame(replayFrame, false)
+	b.seekReplay(replayFrame)
 	return nil
 }
 
@@ -699,21 +736,14 @@ func (b *board) selectReplayStepBack() error {
 		return nil
 	}
 
-	if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
-	}
-
 	// TODO Stepping back moves checkers backwards.
 
-	b.playerRoll1, b.playerRoll2, b.playerRoll3 = 0, 0, 0
-	b.opponentRoll1, b.opponentRoll2, b.opponentRoll3 = 0, 0, 0
 	replayFrame := game.replayFrame
 	replayFrame--
 	if replayFrame < 0 {
 		replayFrame = 0
 	}
-	game.showReplayFrame(replayFrame, false)
+	b.seekReplay(replayFrame)
 	return nil
 }
 
@@ -721,8 +751,7 @@ func (b *board) selectReplayPause() error {
 	if !game.replay {
 		return nil
 	} else if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
+		b.stopReplayAuto()
 		return nil
 	} else if game.replayFrame >= len(game.replayFrames)-1 {
 		return nil
@@ -731,20 +760,19 @@ func (b *board) selectReplayPause() error {
 	b.replayPauseButton.SetText("ll")
 	autoStart := b.replayAuto
 	go func() {
-		t := time.NewTicker(3 * time.Second)
 		for {
 			if b.replayAuto != autoStart {
 				return
 			}
 
 			frame := game.replayFrames[game.replayFrame]
-			if len(frame.Event) != 0 {
-				game._handleReplay(&bgammon.GameState{
+			if frame.Record != nil {
+				game.playReplayRecord(&bgammon.GameState{
 					Game:         frame.Game.Copy(true),
 					PlayerNumber: 1,
 					Available:    frame.Game.LegalMoves(true),
 					Spectating:   true,
-				}, frame.Event, 0, true, true)
+				}, frame.Record)
 			}
 
 			replayFrame := game.replayFrame
@@ -760,7 +788,8 @@ func (b *board) selectReplayPause() error {
 			game.replayFrame = replayFrame
 			game.showReplayFrame(replayFrame, false)
 
-			<-t.C
+			// The delay is calculated each frame so speed changes apply immediately.
+			time.Sleep(time.Duration(float64(replayAutoDelay) / replaySpeeds[b.replaySpeed.Load()]))
 		}
 	}()
 	return nil
@@ -771,19 +800,16 @@ func (b *board) selectReplayStepForward() error {
 		return nil
 	}
 
-	if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
-	}
+	b.stopReplayAuto()
 
 	frame := game.replayFrames[game.replayFrame]
-	if len(frame.Event) != 0 {
-		game._handleReplay(&bgammon.GameState{
+	if frame.Record != nil {
+		game.playReplayRecord(&bgammon.GameState{
 			Game:         frame.Game.Copy(true),
 			PlayerNumber: 1,
 			Available:    frame.Game.LegalMoves(true),
 			Spectating:   true,
-		}, frame.Event, 0, true, true)
+		}, frame.Record)
 	}
 
 	replayFrame := game.replayFrame
@@ -795,48 +821,113 @@ func (b *board) selectReplayStepForward() error {
 	return nil
 }
 
+// selectReplayJumpForward jumps to the start of the next game, or to the end
+// of the replay when the last game is being shown.
 func (b *board) selectReplayJumpForward() error {
 	if !game.replay {
 		return nil
 	}
+	replayFrame := game.replayFrame + 1
+	for replayFrame < len(game.replayFrames)-1 && !game.replayFrames[replayFrame].gameStart {
+		replayFrame++
+	}
+	if replayFrame >= len(game.replayFrames) {
+		return nil
+	}
+	b.seekReplay(replayFrame)
+	return nil
+}
 
-	if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
+func (b *board) selectReplayAnalyze() error {
+	if !game.replay {
+		return nil
 	}
+	game.analyzeReplay()
+	return nil
+}
 
-	replayFrame := game.replayFrame
-	replayFrame++
-	if replayFrame < len(game.replayFrames) {
-		game.replayFrame = replayFrame
-		game.showReplayFrame(replayFrame, false)
+func (b *board) selectReplayTakeOver() error {
+	if !game.replay {
+		return nil
 	}
+	game.takeOverReplay()
 	return nil
 }
 
-func (b *board) selectReplayEnd() error {
+// selectReplayExportGIF shows the dialog used to choose the size and frame
+// delay of the GIF image the replay is exported as. The size of the board and
+// the playback speed are suggested until other values are entered.
+func (b *board) selectReplayExportGIF() error {
 	if !game.replay {
 		return nil
+	} else if ReplayDir() == "" {
+		ls("*** " + gotext.Get("Exporting replays as GIF images is not supported on this platform."))
+		return nil
 	}
+	b.hideMenu()
+	if b.exportGIFWidth.Text() == "" {
+		b.exportGIFWidth.SetText(strconv.Itoa(b.w))
+		b.exportGIFHeight.SetText(strconv.Itoa(b.h))
+		delay := time.Duration(float64(replayAutoDelay) / replaySpeeds[b.replaySpeed.Load()])
+		b.exportGIFDelay.SetText(strconv.FormatInt(delay.Milliseconds(), 10))
+	}
+	b.exportGIFDialog.SetVisible(true)
+	etk.SetFocus(b.exportGIFWidth)
+	return nil
+}
 
-	if !b.replayAuto.IsZero() {
-		b.replayAuto = time.Time{}
-		b.replayPauseButton.SetText("▶")
+// confirmExportGIF exports the replay using the size and frame delay entered.
+func (b *board) confirmExportGIF() error {
+	if !game.replay || !b.exportGIFDialog.Visible() {
+		return nil
+	}
+	width, err := strconv.Atoi(strings.TrimSpace(b.exportGIFWidth.Text()))
+	if err != nil || width < minGIFSize || width > maxGIFSize {
+		ls("*** " + gotext.Get("The width and height must be between %d and %d pixels.", minGIFSize, maxGIFSize))
+		etk.SetFocus(b.exportGIFWidth)
+		return nil
 	}
+	height, err := strconv.Atoi(strings.TrimSpace(b.exportGIFHeight.Text()))
+	if err != nil || height < minGIFSize || height > maxGIFSize {
+		ls("*** " + gotext.Get("The width and height must be between %d and %d pixels.", minGIFSize, maxGIFSize))
+		etk.SetFocus(b.exportGIFHeight)
+		return nil
+	}
+	delay, err := strconv.Atoi(strings.TrimSpace(b.exportGIFDelay.Text()))
+	if err != nil || time.Duration(delay)*time.Millisecond < minGIFDelay {
+		ls("*** " + gotext.Get("The frame delay must be at least %d milliseconds.", minGIFDelay.Milliseconds()))
+		etk.SetFocus(b.exportGIFDelay)
+		return nil
+	}
+	b.exportGIFDialog.SetVisible(false)
 
-	b.playerRoll1, b.playerRoll2, b.playerRoll3 = 0, 0, 0
-	b.opponentRoll1, b.opponentRoll2, b.opponentRoll3 = 0, 0, 0
-	game.showReplayFrame(len(game.replayFrames)-1, false)
+	go game.exportReplayGIF(width, height, time.Duration(delay)*time.Millisecond)
 	return nil
 }
 
+func (b *board) selectReplayEnd() error {
+	if !game.replay {
+		return nil
+	}
+	b.seekReplay(len(game.replayFrames) - 1)
+	return nil
+}
+
+func (b *board) confirmReplaySpeed(index int) (accept bool) {
+	if index < 0 || index >= len(replaySpeeds) {
+		return false
+	}
+	b.replaySpeed.Store(int32(index))
+	return true
+}
+
 func (b *board) toggleHighlightCheckbox() error {
 	b.highlightAvailable = b.highlightCheckbox.Selected()
 	highlight := 0
 	if b.highlightAvailable {
 		highlight = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set highlight %d", highlight))
+	b.client.Send([]byte(fmt.Sprintf("set highlight %d", highlight)))
 	return nil
 }
 
@@ -848,7 +939,7 @@ func (b *board) togglePipCountCheckbox() error {
 	if b.showPipCount {
 		pips = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set pips %d", pips))
+	b.client.Send([]byte(fmt.Sprintf("set pips %d", pips)))
 	return nil
 }
 
@@ -859,7 +950,7 @@ func (b *board) toggleMovesCheckbox() error {
 	if b.showMoves {
 		moves = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set moves %d", moves))
+	b.client.Send([]byte(fmt.Sprintf("set moves %d", moves)))
 	return nil
 }
 
@@ -868,7 +959,61 @@ func (b *board) toggleAutoPlayCheckbox() error {
 	if b.autoPlayCheckbox.Selected() {
 		autoPlay = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set autoplay %d", autoPlay))
+	b.client.Send([]byte(fmt.Sprintf("set autoplay %d", autoPlay)))
+	return nil
+}
+
+func (b *board) togglePassScreenCheckbox() error {
+	b.hotSeatPassScreen = b.passScreenCheckbox.Selected()
+	b.saveHotSeatSettings()
+	return nil
+}
+
+func (b *board) toggleFixedBoardCheckbox() error {
+	b.hotSeatFixedBoard = b.fixedBoardCheckbox.Selected()
+	b.saveHotSeatSettings()
+
+	h := game.hotSeat
+	if h == nil {
+		return nil
+	}
+	b.Lock()
+	b.rotated = b.hotSeatFixedBoard && h.active == 1
+	b.processState()
+	b.Unlock()
+	scheduleFrame()
+	return nil
+}
+
+func (b *board) loadHotSeatSettings() {
+	settings, err := loadHotSeatSettings()
+	if err != nil {
+		log.Printf("warning: failed to load hot-seat settings: %s", err)
+		return
+	}
+	b.hotSeatPassScreen = settings.PassScreen
+	b.hotSeatFixedBoard = settings.FixedBoard
+}
+
+func (b *board) saveHotSeatSettings() {
+	err := saveHotSeatSettings(&hotSeatSettings{
+		PassScreen: b.hotSeatPassScreen,
+		FixedBoard: b.hotSeatFixedBoard,
+	})
+	if err != nil {
+		log.Printf("warning: failed to save hot-seat settings: %s", err)
+	}
+}
+
+// showPassDevice hides the board until the specified player confirms they
+// have been passed the device.
+func (b *board) showPassDevice(player string) {
+	b.passDeviceLabel.SetText(gotext.Get("Pass the device to %s.", player))
+	b.passDeviceDialog.SetVisible(true)
+}
+
+func (b *board) hidePassDevice() error {
+	b.passDeviceDialog.SetVisible(false)
 	return nil
 }
 
@@ -881,8 +1026,8 @@ func (b *board) toggleFlipBoardCheckbox() error {
 	if b.flipBoard {
 		flipBoard = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set flip %d", flipBoard))
-	b.client.Out <- []byte("board")
+	b.client.Send([]byte(fmt.Sprintf("set flip %d", flipBoard)))
+	b.client.Send([]byte("board"))
 	return nil
 }
 
@@ -893,7 +1038,7 @@ func (b *board) toggleTraditionalCheckbox() error {
 	if b.traditional {
 		traditional = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set traditional %d", traditional))
+	b.client.Send([]byte(fmt.Sprintf("set traditional %d", traditional)))
 	return nil
 }
 
@@ -904,7 +1049,7 @@ func (b *board) toggleAdvancedMovementCheckbox() error {
 	if b.advancedMovement {
 		advancedMovement = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set advanced %d", advancedMovement))
+	b.client.Send([]byte(fmt.Sprintf("set advanced %d", advancedMovement)))
 	return nil
 }
 
@@ -915,7 +1060,7 @@ func (b *board) toggleMuteJoinLeave() error {
 	if b.muteJoinLeave {
 		value = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set mutejoinleave %d", value))
+	b.client.Send([]byte(fmt.Sprintf("set mutejoinleave %d", value)))
 	return nil
 }
 
@@ -926,7 +1071,7 @@ func (b *board) toggleMuteChat() error {
 	if b.muteChat {
 		value = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set mutechat %d", value))
+	b.client.Send([]byte(fmt.Sprintf("set mutechat %d", value)))
 	return nil
 }
 
@@ -937,7 +1082,7 @@ func (b *board) toggleMuteRoll() error {
 	if b.muteRoll {
 		value = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set muteroll %d", value))
+	b.client.Send([]byte(fmt.Sprintf("set muteroll %d", value)))
 	return nil
 }
 
@@ -948,7 +1093,7 @@ func (b *board) toggleMuteMove() error {
 	if b.muteMove {
 		value = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set mutemove %d", value))
+	b.client.Send([]byte(fmt.Sprintf("set mutemove %d", value)))
 	return nil
 }
 
@@ -959,7 +1104,7 @@ func (b *board) toggleMuteBearOff() error {
 	if b.muteBearOff {
 		value = 1
 	}
-	b.client.Out <- []byte(fmt.Sprintf("set mutebearoff %d", value))
+	b.client.Send([]byte(fmt.Sprintf("set mutebearoff %d", value)))
 	return nil
 }
 
@@ -1223,7 +1368,11 @@ func (b *board) updateBackgroundImage() {
 	if b.gameState.Points > 1 {
 		const cubePadding = 10
 		var cubeY float64
-		switch b.gameState.DoublePlayer {
+		doublePlayer := b.gameState.DoublePlayer
+		if b.rotated && doublePlayer != 0 {
+			doublePlayer = 3 - doublePlayer
+		}
+		switch doublePlayer {
 		case 1:
 			cubeY = float64(b.h) - b.verticalBorderSize - b.overlapSize*5 - cubesImageSize - float64(etk.Scale(cubePadding))
 		case 2:
@@ -1240,7 +1389,6 @@ func (b *board) updateBackgroundImage() {
 
 	ff := etk.FontFace(etk.Style.TextFont, etk.Scale(b.fontSize))
 
-	spaceLabelColor := color.RGBA{121, 96, 60, 255}
 	for space, r := range b.spaceRects {
 		if space < 1 || space > 24 {
 			continue
@@ -1250,7 +1398,7 @@ func (b *board) updateBackgroundImage() {
 
 		sp := strconv.Itoa(space)
 		if b.gameState.Variant == bgammon.VariantTabula {
-			sp = romanNumerals(space)
+			sp = render.RomanNumerals(space)
 		}
 		bounds := etk.BoundString(ff, sp)
 		x := int(b.horizontalBorderSize) + r[0] + (r[2]-bounds.Dx())/2
@@ -1269,7 +1417,7 @@ func (b *board) updateBackgroundImage() {
 		fontMutex.Lock()
 		op := &text.DrawOptions{}
 		op.GeoM.Translate(float64(x), float64(y+(int(b.verticalBorderSize)-b.lineHeight)/2))
-		op.ColorScale.ScaleWithColor(spaceLabelColor)
+		op.ColorScale.ScaleWithColor(render.SpaceLabelColor)
 		text.Draw(b.backgroundImage, sp, ff, op)
 		fontMutex.Unlock()
 	}
@@ -1278,6 +1426,9 @@ func (b *board) updateBackgroundImage() {
 
 	opponentIcon := profileIcon(b.gameState.Player2.Icon)
 	playerIcon := profileIcon(b.gameState.Player1.Icon)
+	if b.rotated {
+		opponentIcon, playerIcon = playerIcon, opponentIcon
+	}
 	if opponentIcon == nil && playerIcon == nil {
 		return
 	}
@@ -1467,7 +1618,11 @@ func (b *board) Draw(screen *ebiten.Image) {
 	checkerHeight := (b.spaceWidth + b.overlapSize*4 - dividerHeight*2) / 15
 
 	checkerY := float64(b.y+b.h-int(b.verticalBorderSize)) - checkerHeight - float64(etk.Scale(4))
-	checkers := len(b.spaceSprites[bgammon.SpaceHomePlayer])
+	bottomHome, topHome := bgammon.SpaceHomePlayer, bgammon.SpaceHomeOpponent
+	if b.rotated {
+		bottomHome, topHome = topHome, bottomHome
+	}
+	checkers := len(b.spaceSprites[bottomHome])
 	var checkerOffset float64
 	for i := 0; i < checkers; i++ {
 		checkerOffset = 0
@@ -1482,7 +1637,7 @@ func (b *board) Draw(screen *ebiten.Image) {
 	}
 
 	checkerY = float64(b.y+int(b.verticalBorderSize)) - checkerHeight - 3
-	checkers = len(b.spaceSprites[bgammon.SpaceHomeOpponent])
+	checkers = len(b.spaceSprites[topHome])
 	for i := 0; i < checkers; i++ {
 		checkerOffset = 0
 		if i >= 10 {
@@ -1784,7 +1939,7 @@ func (b *board) setRect(x, y, w, h int) {
 		if dialogWidth > game.screenW {
 			dialogWidth = game.screenW
 		}
-		const settingsRows = 12
+		const settingsRows = 14
 		dialogHeight := 72 + (72+20)*settingsRows + etk.Scale(baseButtonHeight)
 		if dialogHeight > game.screenH {
 			dialogHeight = game.screenH
@@ -1796,6 +1951,20 @@ func (b *board) setRect(x, y, w, h int) {
 		b.muteSoundsDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
 	}
 
+	{
+		dialogWidth := etk.Scale(620)
+		if dialogWidth > game.screenW {
+			dialogWidth = game.screenW
+		}
+		dialogHeight := 72 + (fieldHeight+20)*3 + etk.Scale(baseButtonHeight)
+		if dialogHeight > game.screenH {
+			dialogHeight = game.screenH
+		}
+
+		x, y := game.screenW/2-dialogWidth/2, game.screenH/2-dialogHeight/2
+		b.exportGIFDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
+	}
+
 	{
 		dialogWidth := int(float64(diceSize) * 6)
 		if dialogWidth > game.screenW {
@@ -2086,7 +2255,7 @@ func (b *board) spaceAt(x, y int) int8 {
 func (b *board) setSpaceRects() {
 	var x, y, w, h int
 	for space := int8(0); space < bgammon.BoardSpaces; space++ {
-		if !b.bottomRow(space) {
+		if !b.unrotatedBottomRow(space) {
 			y = 0
 		} else {
 			y = int((float64(b.h) / 2) - b.verticalBorderSize)
@@ -2134,6 +2303,15 @@ func (b *board) setSpaceRects() {
 		}
 	}
 
+	// Rotate board.
+	if b.rotated {
+		rects := make([][4]int, bgammon.BoardSpaces)
+		copy(rects, b.spaceRects)
+		for space := int8(0); space < bgammon.BoardSpaces; space++ {
+			b.spaceRects[space] = rects[bgammon.FlipSpace(space, 2, b.gameState.Variant)]
+		}
+	}
+
 	r := b.spaceRects[1]
 	highlightHeight := int(b.overlapSize*5) + 4
 	bounds := b.spaceHighlight.Bounds()
@@ -2150,6 +2328,13 @@ func (b *board) spaceRect(space int8) (x, y, w, h int) {
 }
 
 func (b *board) bottomRow(space int8) bool {
+	if b.rotated {
+		space = bgammon.FlipSpace(space, 2, b.gameState.Variant)
+	}
+	return b.unrotatedBottomRow(space)
+}
+
+func (b *board) unrotatedBottomRow(space int8) bool {
 	var bottomStart int8 = 1
 	var bottomEnd int8 = 12
 	bottomBar := bgammon.SpaceBarPlayer
@@ -2219,7 +2404,7 @@ func (b *board) processState() {
 		return
 	}
 
-	if b.lastPlayerNumber != b.gameState.PlayerNumber || b.lastVariant != b.gameState.Variant {
+	if b.lastPlayerNumber != b.gameState.PlayerNumber || b.lastVariant != b.gameState.Variant || b.lastRotated != b.rotated {
 		b.setSpaceRects()
 		b.updateBackgroundImage()
 	} else if b.lastPoints != b.gameState.Points || b.lastDoublePlayer != b.gameState.DoublePlayer || b.lastDoubleValue != b.gameState.DoubleValue || b.lastIconPlayer != b.gameState.Player1.Icon || b.lastIconOpponent != b.gameState.Player2.Icon || b.lastCrawford != b.gameState.Crawford {
@@ -2227,6 +2412,7 @@ func (b *board) processState() {
 	}
 	b.lastPlayerNumber = b.gameState.PlayerNumber
 	b.lastVariant = b.gameState.Variant
+	b.lastRotated = b.rotated
 	b.lastPoints = b.gameState.Points
 	b.lastDoublePlayer = b.gameState.DoublePlayer
 	b.lastDoubleValue = b.gameState.DoubleValue
@@ -2234,7 +2420,7 @@ func (b *board) processState() {
 	b.lastIconOpponent = b.gameState.Player2.Icon
 	b.lastCrawford = b.gameState.Crawford
 
-	if b.flipBoard || b.gameState.PlayerNumber == 2 {
+	if (b.flipBoard || b.gameState.PlayerNumber == 2) != b.rotated {
 		if b.opponentLabel.activeColor != colorBlack {
 			b.opponentLabel.activeColor = colorBlack
 			b.opponentLabel.SetForeground(colorBlack)
@@ -2286,7 +2472,7 @@ func (b *board) processState() {
 	b.playerForcedLabel.SetVisible(b.gameState.Forced && b.gameState.Turn == b.gameState.PlayerNumber)
 
 	var showGrid *etk.Grid
-	if !b.gameState.Spectating && !b.availableStale {
+	if !b.gameState.Spectating && !b.availableStale && !b.editing {
 		if b.gameState.MayRoll() {
 			if b.gameState.MayDouble() {
 				showGrid = b.buttonsDoubleRollGrid
@@ -2315,7 +2501,7 @@ func (b *board) processState() {
 		spaceValue := b.gameState.Board[space]
 
 		white := spaceValue < 0
-		if b.flipBoard {
+		if b.flipBoard != b.rotated {
 			white = !white
 		}
 
@@ -2370,7 +2556,7 @@ func (b *board) processState() {
 	b.updateOpponentLabel()
 	b.updatePlayerLabel()
 
-	if b.gameState.Spectating || b.gameState.Turn != b.gameState.PlayerNumber {
+	if b.gameState.Spectating || b.editing || b.gameState.Turn != b.gameState.PlayerNumber {
 		return
 	}
 
@@ -2658,6 +2844,14 @@ func (b *board) finishDrag(x int, y int, click bool) {
 			index = bgammon.SpaceHomePlayer
 		}
 
+		if b.editing {
+			b.editMoveChecker(dropped, b.draggingSpace, index)
+			b.processState()
+			scheduleFrame()
+			b.lastDragClick = time.Now()
+			return
+		}
+
 		if !b.draggingClick && index == b.draggingSpace && !b.lastDragClick.IsZero() && time.Since(b.lastDragClick) < 500*time.Millisecond {
 			b.startDrag(dropped, index, true)
 			if mobileDevice {
@@ -2698,7 +2892,7 @@ func (b *board) finishDrag(x int, y int, click bool) {
 					scheduleFrame()
 					found = true
 					processed = true
-					b.client.Out <- []byte(fmt.Sprintf("mv %d/%d", space, index))
+					b.client.Send([]byte(fmt.Sprintf("mv %d/%d", space, index)))
 				}
 			} else if time.Since(b.lastDragClick) < 500*time.Millisecond && b.gameState.MayBearOff(b.gameState.PlayerNumber, true) {
 				homeStart, homeEnd := bgammon.HomeRange(b.gameState.PlayerNumber, b.gameState.Variant)
@@ -2715,13 +2909,13 @@ func (b *board) finishDrag(x int, y int, click bool) {
 							playSoundEffect(effectHomeMulti)
 						}
 						found = true
-						b.client.Out <- []byte(fmt.Sprintf("mv %d/off", index))
+						b.client.Send([]byte(fmt.Sprintf("mv %d/off", index)))
 					}
 				}
 			} else if time.Since(b.lastDragClick) < 500*time.Millisecond && space == bgammon.SpaceHomePlayer && !b.gameState.Player1.Entered {
 				for _, m := range b.gameState.Available {
 					if m[0] == bgammon.SpaceHomePlayer && bgammon.SpaceDiff(m[0], m[1], b.gameState.Variant) == b.gameState.Roll1 {
-						b.client.Out <- []byte(fmt.Sprintf("mv %d/%d", m[0], m[1]))
+						b.client.Send([]byte(fmt.Sprintf("mv %d/%d", m[0], m[1])))
 						found = true
 						break
 					}
@@ -2729,7 +2923,7 @@ func (b *board) finishDrag(x int, y int, click bool) {
 				if !found {
 					for _, m := range b.gameState.Available {
 						if m[0] == bgammon.SpaceHomePlayer {
-							b.client.Out <- []byte(fmt.Sprintf("mv %d/%d", m[0], m[1]))
+							b.client.Send([]byte(fmt.Sprintf("mv %d/%d", m[0], m[1])))
 							found = true
 							break
 						}
@@ -2862,21 +3056,6 @@ func tabulaBoard(g *bgammon.Game, b []int8) tabula.Board {
 	return tabula.Board{b[0], b[1], b[2], b[3], b[4], b[5], b[6], b[7], b[8], b[9], b[10], b[11], b[12], b[13], b[14], b[15], b[16], b[17], b[18], b[19], b[20], b[21], b[22], b[23], b[24], b[25], b[26], b[27], roll1, roll2, roll3, roll4, entered1, entered2, g.Variant}
 }
 
-func romanNumerals(i int) string {
-	var roman string = ""
-	var numbers = []int{1, 4, 5, 9, 10}
-	var numerals = []string{"I", "IV", "V", "IX", "X"}
-	var index = len(numerals) - 1
-	for i > 0 {
-		for numbers[index] <= i {
-			roman += numerals[index]
-			i -= numbers[index]
-		}
-		index -= 1
-	}
-	return roman
-}
-
 func formatRoll(r1, r2, r3 int8) string {
 	var dice string
 	haveR1, haveR2 := r1 != 0, r2 != 0
@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"strconv"
 
 	"codeberg.org/tslocum/bgammon"
 	"codeberg.org/tslocum/etk"
@@ -110,6 +111,47 @@ func (b *board) createChangePasswordDialog() {
 	b.changePasswordDialog.SetVisible(false)
 }
 
+func (b *board) createExportGIFDialog() {
+	headerLabel := resizeText(gotext.Get("Export as GIF"))
+	headerLabel.SetHorizontal(etk.AlignCenter)
+	headerLabel.SetVertical(etk.AlignCenter)
+
+	onConfirm := func(text string) (handled bool) {
+		b.confirmExportGIF()
+		return false
+	}
+
+	b.exportGIFWidth = &Input{etk.NewInput("", nil, onConfirm)}
+	b.exportGIFWidth.SetBackground(frameColor)
+	centerInput(b.exportGIFWidth)
+
+	b.exportGIFHeight = &Input{etk.NewInput("", nil, onConfirm)}
+	b.exportGIFHeight.SetBackground(frameColor)
+	centerInput(b.exportGIFHeight)
+
+	b.exportGIFDelay = &Input{etk.NewInput("", nil, onConfirm)}
+	b.exportGIFDelay.SetBackground(frameColor)
+	centerInput(b.exportGIFDelay)
+
+	grid := etk.NewGrid()
+	grid.SetColumnSizes(20, -1, -1, 20)
+	grid.SetRowSizes(72, fieldHeight, 20, fieldHeight, 20, fieldHeight, -1)
+	grid.AddChildAt(headerLabel, 1, 0, 2, 1)
+	grid.AddChildAt(newCenteredText(gotext.Get("Width")), 1, 1, 1, 1)
+	grid.AddChildAt(b.exportGIFWidth, 2, 1, 1, 1)
+	grid.AddChildAt(newCenteredText(gotext.Get("Height")), 1, 3, 1, 1)
+	grid.AddChildAt(b.exportGIFHeight, 2, 3, 1, 1)
+	grid.AddChildAt(newCenteredText(gotext.Get("Frame delay (ms)")), 1, 5, 1, 1)
+	grid.AddChildAt(b.exportGIFDelay, 2, 5, 1, 1)
+
+	b.exportGIFDialog = newDialog(etk.NewGrid())
+	b.exportGIFDialog.SetRowSizes(-1, etk.Scale(baseButtonHeight))
+	b.exportGIFDialog.AddChildAt(&withDialogBorder{grid, image.Rectangle{}}, 0, 0, 2, 1)
+	b.exportGIFDialog.AddChildAt(etk.NewButton(gotext.Get("Cancel"), func() error { b.exportGIFDialog.SetVisible(false); return nil }), 0, 1, 1, 1)
+	b.exportGIFDialog.AddChildAt(etk.NewButton(gotext.Get("Export"), b.confirmExportGIF), 1, 1, 1, 1)
+	b.exportGIFDialog.SetVisible(false)
+}
+
 func (b *board) createMuteSoundsDialog() {
 	headerLabel := resizeText(gotext.Get("Mute Sounds"))
 	headerLabel.SetHorizontal(etk.AlignCenter)
@@ -327,6 +369,34 @@ func (b *board) createSettingsDialog() {
 	}
 	autoPlayLabel.SetVertical(etk.AlignCenter)
 
+	b.passScreenCheckbox = etk.NewCheckbox(b.togglePassScreenCheckbox)
+	b.passScreenCheckbox.SetBorderColor(triangleA)
+	b.passScreenCheckbox.SetCheckColor(triangleA)
+	b.passScreenCheckbox.SetSelected(b.hotSeatPassScreen)
+
+	passScreenLabel := &ClickableText{
+		Text: resizeText(gotext.Get("Hide board between offline turns")),
+		onSelected: func() {
+			b.passScreenCheckbox.SetSelected(!b.passScreenCheckbox.Selected())
+			b.togglePassScreenCheckbox()
+		},
+	}
+	passScreenLabel.SetVertical(etk.AlignCenter)
+
+	b.fixedBoardCheckbox = etk.NewCheckbox(b.toggleFixedBoardCheckbox)
+	b.fixedBoardCheckbox.SetBorderColor(triangleA)
+	b.fixedBoardCheckbox.SetCheckColor(triangleA)
+	b.fixedBoardCheckbox.SetSelected(b.hotSeatFixedBoard)
+
+	fixedBoardLabel := &ClickableText{
+		Text: resizeText(gotext.Get("Keep board perspective fixed offline")),
+		onSelected: func() {
+			b.fixedBoardCheckbox.SetSelected(!b.fixedBoardCheckbox.Selected())
+			b.toggleFixedBoardCheckbox()
+		},
+	}
+	fixedBoardLabel.SetVertical(etk.AlignCenter)
+
 	b.recreateAccountGrid()
 
 	grid := etk.NewGrid()
@@ -407,6 +477,12 @@ func (b *board) createSettingsDialog() {
 	grid.AddChildAt(cGrid(b.autoPlayCheckbox), 1, gridY, 1, 1)
 	grid.AddChildAt(autoPlayLabel, 2, gridY, 3, 1)
 	gridY++
+	grid.AddChildAt(cGrid(b.passScreenCheckbox), 1, gridY, 1, 1)
+	grid.AddChildAt(passScreenLabel, 2, gridY, 3, 1)
+	gridY++
+	grid.AddChildAt(cGrid(b.fixedBoardCheckbox), 1, gridY, 1, 1)
+	grid.AddChildAt(fixedBoardLabel, 2, gridY, 3, 1)
+	gridY++
 
 	rowSizes := make([]int, gridY)
 	for i := 0; i < gridY; i++ {
@@ -445,6 +521,22 @@ func (b *board) createLeaveMatchDialog() {
 	b.leaveMatchDialog.SetVisible(false)
 }
 
+func (b *board) createPassDeviceDialog() {
+	b.passDeviceLabel = resizeText("")
+	b.passDeviceLabel.SetHorizontal(etk.AlignCenter)
+	b.passDeviceLabel.SetVertical(etk.AlignCenter)
+
+	buttonGrid := etk.NewGrid()
+	buttonGrid.SetColumnSizes(-1, etk.Scale(300), -1)
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Continue"), b.hidePassDevice), 1, 0, 1, 1)
+
+	b.passDeviceDialog = newDialog(etk.NewGrid())
+	b.passDeviceDialog.SetRowSizes(-1, etk.Scale(baseButtonHeight), -1)
+	b.passDeviceDialog.AddChildAt(b.passDeviceLabel, 0, 0, 1, 1)
+	b.passDeviceDialog.AddChildAt(buttonGrid, 0, 1, 1, 1)
+	b.passDeviceDialog.SetVisible(false)
+}
+
 func (b *board) createMatchStatus() {
 	timerLabel := etk.NewText("0:00")
 	timerLabel.SetForeground(triangleA)
@@ -462,6 +554,14 @@ func (b *board) createMatchStatus() {
 	clockLabel.SetVertical(etk.AlignCenter)
 	b.clockLabel = clockLabel
 
+	latencyLabel := etk.NewText("")
+	latencyLabel.SetForeground(triangleA)
+	latencyLabel.SetScrollBarVisible(false)
+	latencyLabel.SetSingleLine(true)
+	latencyLabel.SetHorizontal(etk.AlignCenter)
+	latencyLabel.SetVertical(etk.AlignCenter)
+	b.latencyLabel = latencyLabel
+
 	b.showMenuButton = etk.NewButton(gotext.Get("Menu"), b.toggleMenu)
 	if !mobileDevice {
 		b.showMenuButton.SetBorderSize(etk.Scale(etk.Style.ButtonBorderSize / 2))
@@ -472,24 +572,44 @@ func (b *board) createMatchStatus() {
 		padding = int(b.verticalBorderSize / 4)
 	}
 	b.matchStatusGrid = etk.NewGrid()
-	b.matchStatusGrid.SetColumnSizes(padding, -1, -1, -1, padding)
+	b.matchStatusGrid.SetColumnSizes(padding, -1, -1, -1, -1, padding)
 	b.matchStatusGrid.AddChildAt(b.timerLabel, 1, 0, 1, 1)
 	b.matchStatusGrid.AddChildAt(b.clockLabel, 2, 0, 1, 1)
-	b.matchStatusGrid.AddChildAt(b.showMenuButton, 3, 0, 1, 1)
-	b.matchStatusGrid.AddChildAt(etk.NewBox(), 4, 0, 1, 1)
+	b.matchStatusGrid.AddChildAt(b.latencyLabel, 3, 0, 1, 1)
+	b.matchStatusGrid.AddChildAt(b.showMenuButton, 4, 0, 1, 1)
+	b.matchStatusGrid.AddChildAt(etk.NewBox(), 5, 0, 1, 1)
 }
 
 func (b *board) createReplayControls() {
 	b.replayPauseButton = etk.NewButton("▶", b.selectReplayPause)
 
+	b.replayTimeline = newReplayTimeline()
+
+	b.replaySpeed.Store(replaySpeedNormal)
+	b.replaySpeedSelect = etk.NewSelect(game.itemHeight(), b.confirmReplaySpeed)
+	b.replaySpeedSelect.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+	for _, speed := range replaySpeeds {
+		b.replaySpeedSelect.AddOption(strconv.FormatFloat(speed, 'f', -1, 64) + "x")
+	}
+	b.replaySpeedSelect.SetSelectedItem(int(b.replaySpeed.Load()))
+
 	b.replayGrid = etk.NewGrid()
-	b.replayGrid.AddChildAt(etk.NewButton("⇤", b.selectReplayStart), 0, 0, 1, 1)
-	b.replayGrid.AddChildAt(etk.NewButton("⇇", b.selectReplayJumpBack), 1, 0, 1, 1)
-	b.replayGrid.AddChildAt(etk.NewButton("←", b.selectReplayStepBack), 2, 0, 1, 1)
-	b.replayGrid.AddChildAt(b.replayPauseButton, 3, 0, 1, 1)
-	b.replayGrid.AddChildAt(etk.NewButton("→", b.selectReplayStepForward), 4, 0, 1, 1)
-	b.replayGrid.AddChildAt(etk.NewButton("⇉", b.selectReplayJumpForward), 5, 0, 1, 1)
-	b.replayGrid.AddChildAt(etk.NewButton("⇥", b.selectReplayEnd), 6, 0, 1, 1)
+	b.replayGrid.AddChildAt(b.replayTimeline, 0, 0, 7, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("⇤", b.selectReplayStart), 0, 1, 1, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("⇇", b.selectReplayJumpBack), 1, 1, 1, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("←", b.selectReplayStepBack), 2, 1, 1, 1)
+	b.replayGrid.AddChildAt(b.replayPauseButton, 3, 1, 1, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("→", b.selectReplayStepForward), 4, 1, 1, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("⇉", b.selectReplayJumpForward), 5, 1, 1, 1)
+	b.replayGrid.AddChildAt(etk.NewButton("⇥", b.selectReplayEnd), 6, 1, 1, 1)
+	b.replayAnalyzeButton = etk.NewButton(gotext.Get("Analyze"), b.selectReplayAnalyze)
+
+	actionGrid := etk.NewGrid()
+	actionGrid.AddChildAt(b.replaySpeedSelect, 0, 0, 1, 1)
+	actionGrid.AddChildAt(b.replayAnalyzeButton, 1, 0, 1, 1)
+	actionGrid.AddChildAt(etk.NewButton(gotext.Get("Take over"), b.selectReplayTakeOver), 2, 0, 1, 1)
+	actionGrid.AddChildAt(etk.NewButton(gotext.Get("Export as GIF"), b.selectReplayExportGIF), 3, 0, 1, 1)
+	b.replayGrid.AddChildAt(actionGrid, 0, 2, 7, 1)
 }
 
 func (b *board) createReplayList() {
@@ -503,7 +623,7 @@ func (b *board) createReplayList() {
 func (b *board) recreateUIGrid() {
 	b.uiGrid.Clear()
 	var gridY int
-	if !mobileDevice || game.replay {
+	if !mobileDevice || game.replay || b.editing {
 		b.uiGrid.AddChildAt(etk.NewBox(), 0, 0, 1, 1)
 		b.uiGrid.AddChildAt(b.matchStatusGrid, 0, 1, 1, 1)
 		b.uiGrid.AddChildAt(etk.NewBox(), 0, 2, 1, 1)
@@ -511,12 +631,18 @@ func (b *board) recreateUIGrid() {
 	}
 	if game.replay {
 		g := etk.NewGrid()
-		g.SetRowSizes(etk.Scale(baseButtonHeight), int(b.verticalBorderSize/2), -1, int(b.verticalBorderSize/2), etk.Scale(baseButtonHeight*2))
+		g.SetRowSizes(etk.Scale(baseButtonHeight*3), int(b.verticalBorderSize/2), -1, int(b.verticalBorderSize/2), etk.Scale(baseButtonHeight*2))
 		g.AddChildAt(b.replayGrid, 0, 0, 1, 1)
 		g.AddChildAt(b.replayList, 0, 2, 1, 1)
 		g.AddChildAt(statusBuffer, 0, 4, 1, 1)
 		b.uiGrid.AddChildAt(g, 0, gridY, 1, 3)
 		gridY++
+	} else if b.editing {
+		g := etk.NewGrid()
+		g.SetRowSizes(-1, int(b.verticalBorderSize/2), etk.Scale(baseButtonHeight*2))
+		g.AddChildAt(b.editor.grid, 0, 0, 1, 1)
+		g.AddChildAt(statusBuffer, 0, 2, 1, 1)
+		b.uiGrid.AddChildAt(g, 0, gridY, 1, 3)
 	} else {
 		if mobileDevice {
 			b.uiGrid.AddChildAt(b.inputGrid, 0, gridY, 1, 1)
@@ -588,11 +714,22 @@ func (b *board) createFrame() {
 		log.Panicf("failed to find speed selection list")
 	}
 	f.AddChild(children[0])
+	children = b.replaySpeedSelect.Children()
+	if len(children) == 0 {
+		log.Panicf("failed to find replay speed selection list")
+	}
+	f.AddChild(children[0])
+	for _, s := range b.editor.selects() {
+		f.AddChild(s.Children()[0])
+	}
 	f.AddChild(b.changePasswordDialog)
 	f.AddChild(b.muteSoundsDialog)
+	f.AddChild(b.exportGIFDialog)
 	f.AddChild(b.leaveMatchDialog)
 	b.frame.AddChild(f)
 
+	b.frame.AddChild(b.passDeviceDialog)
+
 	b.frame.AddChild(game.tutorialFrame)
 }
 
@@ -231,7 +231,7 @@ func (bw *BoardWidget) finishClick(cursor image.Point, double bool) {
 		game.board.processState()
 		game.board.Unlock()
 		game.Lock()
-		game.client.Out <- []byte(fmt.Sprintf("mv %d/%d", useMove[0], useMove[1]))
+		game.client.Send([]byte(fmt.Sprintf("mv %d/%d", useMove[0], useMove[1])))
 		return
 	}
 
@@ -282,7 +282,7 @@ FINDMOVE:
 	game.board.Unlock()
 	game.Lock()
 	for _, move := range useMoves {
-		game.client.Out <- []byte(fmt.Sprintf("mv %d/%d", move[0], move[1]))
+		game.client.Send([]byte(fmt.Sprintf("mv %d/%d", move[0], move[1])))
 	}
 }
 
@@ -292,14 +292,14 @@ func (bw *BoardWidget) HandleMouse(cursor image.Point, pressed bool, clicked boo
 	}
 
 	b := game.board
-	if b.client == nil || !b.playerTurn() {
+	if b.client == nil || (!b.editing && !b.playerTurn()) {
 		return false, nil
 	}
 
 	cx, cy := cursor.X, cursor.Y
 
 	if b.dragging == nil {
-		if b.advancedMovement && clicked {
+		if b.advancedMovement && clicked && !b.editing {
 			if b.moving != nil {
 				return false, nil
 			}
@@ -328,9 +328,12 @@ func (bw *BoardWidget) HandleMouse(cursor image.Point, pressed bool, clicked boo
 			return false, nil
 		}
 
-		if !handled && b.playerTurn() && clicked && (b.lastDragClick.IsZero() || time.Since(b.lastDragClick) >= 50*time.Millisecond) {
+		if !handled && (b.editing || b.playerTurn()) && clicked && (b.lastDragClick.IsZero() || time.Since(b.lastDragClick) >= 50*time.Millisecond) {
 			s, space := b.spriteAt(cx, cy)
-			if s != nil && s.colorWhite == (b.flipBoard || b.gameState.PlayerNumber == 2) && space != bgammon.SpaceHomeOpponent && (game.board.gameState.Variant == bgammon.VariantBackgammon || space != bgammon.SpaceHomePlayer || !game.board.gameState.Player1.Entered) {
+			if s != nil && b.editing {
+				b.startDrag(s, space, false)
+				handled = true
+			} else if s != nil && s.colorWhite == (b.flipBoard || b.gameState.PlayerNumber == 2) && space != bgammon.SpaceHomeOpponent && (game.board.gameState.Variant == bgammon.VariantBackgammon || space != bgammon.SpaceHomePlayer || !game.board.gameState.Player1.Entered) {
 				b.startDrag(s, space, false)
 				handled = true
 			}
@@ -0,0 +1,285 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync/atomic"
+
+	"codeberg.org/tslocum/bei"
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/gotext"
+	"codeberg.org/tslocum/tabula"
+)
+
+// Bot strength levels available when playing offline.
+const (
+	BotStrengthBeginner int32 = iota
+	BotStrengthIntermediate
+	BotStrengthFull
+)
+
+// botStrength is the strength of the bots when playing offline.
+var botStrength atomic.Int32
+
+func init() {
+	botStrength.Store(BotStrengthFull)
+}
+
+// SetBotStrength sets the strength of the bots when playing offline.
+func SetBotStrength(strength int32) {
+	if strength < BotStrengthBeginner || strength > BotStrengthFull {
+		return
+	}
+	botStrength.Store(strength)
+}
+
+func botStrengthLabels() []string {
+	return []string{
+		gotext.Get("Beginner"),
+		gotext.Get("Intermediate"),
+		gotext.Get("Full strength"),
+	}
+}
+
+// botStrengthNoise returns the amount of noise added to the evaluation of
+// each move and cube decision. Move evaluations are weakened relative to the
+// difference between the best and worst moves.
+func botStrengthNoise(strength int32) float64 {
+	switch strength {
+	case BotStrengthBeginner:
+		return 0.5
+	case BotStrengthIntermediate:
+		return 0.15
+	default:
+		return 0
+	}
+}
+
+// Cube decisions are made using the pip count lead of the player on roll,
+// relative to their pip count.
+const (
+	cubeOfferLead    = 0.08 // Minimum lead required to double.
+	cubeRedoubleLead = 0.09 // Minimum lead required to redouble.
+	cubeTakeLead     = 0.12 // Maximum lead of the opponent when taking a double.
+	cubeNoise        = 0.2  // Noise added to the lead, multiplied by the noise of the bot strength.
+)
+
+// weakenEngine returns a connection to the engine which weakens the moves
+// chosen by the engine according to the current bot strength. Cube decisions
+// are passed through to engines which evaluate the cube, and are otherwise
+// answered directly. Other commands are passed through to the engine.
+func weakenEngine(engine net.Conn) net.Conn {
+	client, server := net.Pipe()
+	go handleWeakenedEngine(server, engine)
+	return client
+}
+
+func handleWeakenedEngine(conn net.Conn, engine net.Conn) {
+	defer conn.Close()
+	defer engine.Close()
+
+	analysis := make([]*tabula.Analysis, 0, tabula.AnalysisBufferSize)
+	engineReader := bufio.NewReader(engine)
+	scanner := bufio.NewScanner(conn)
+	var engineCube bool // Whether the engine evaluates cube decisions.
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		strength := botStrength.Load()
+		isDouble := bytes.HasPrefix(line, []byte(bei.CommandDouble+" "))
+		var response []byte
+		var err error
+		switch {
+		case isDouble && !engineCube:
+			response = cubeDecision(line[7:], strength)
+		case strength != BotStrengthFull && bytes.HasPrefix(line, []byte(bei.CommandMove+" ")):
+			response, err = weakenedMove(line[5:], strength, &analysis)
+			if err != nil {
+				log.Printf("warning: failed to choose weakened move: %s", err)
+				response = nil
+			}
+		}
+		if response != nil {
+			_, err = conn.Write(append(response, '\n'))
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		_, err = engine.Write(append(line, '\n'))
+		if err != nil {
+			return
+		}
+		response, err = engineReader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		if bytes.Equal(line, []byte(bei.CommandBEI)) {
+			engineCube = engineEvaluatesCube(response)
+		} else if isDouble {
+			// Cube decisions which the engine failed to evaluate are answered
+			// directly.
+			ev, err := bei.DecodeEvent(response)
+			if _, ok := ev.(*bei.EventOkDouble); err != nil || !ok {
+				response = append(cubeDecision(line[7:], strength), '\n')
+			}
+		}
+		_, err = conn.Write(response)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// cubeEnginesUnsupported are the names of engines which do not evaluate cube
+// decisions. The tabula engine closes the connection when asked to.
+var cubeEnginesUnsupported = []string{"tabula"}
+
+// engineEvaluatesCube returns whether the engine which sent the provided
+// reply to the bei command evaluates cube decisions.
+func engineEvaluatesCube(reply []byte) bool {
+	ev, err := bei.DecodeEvent(bytes.TrimSpace(reply))
+	if err != nil {
+		return false
+	}
+	okBEI, ok := ev.(*bei.EventOkBEI)
+	if !ok {
+		return false
+	}
+	for _, name := range cubeEnginesUnsupported {
+		if okBEI.ID["name"] == name {
+			return false
+		}
+	}
+	return true
+}
+
+// cubeDecision answers a cube decision which the engine did not evaluate.
+// When the cube may not be evaluated, the bot does not double and takes any
+// double offered.
+func cubeDecision(stateBuf []byte, strength int32) []byte {
+	response, err := weakenedDouble(stateBuf, strength)
+	if err != nil {
+		log.Printf("warning: failed to evaluate cube: %s", err)
+		response, _ = bei.EncodeEvent(&bei.EventOkDouble{Cube: bei.CubeEvaluation{Take: true}})
+	}
+	return response
+}
+
+// weakenedMove analyzes the provided BEI state without considering the
+// replies available to the opponent, and chooses a move after adding noise to
+// the evaluation of each move.
+func weakenedMove(stateBuf []byte, strength int32, analysis *[]*tabula.Analysis) ([]byte, error) {
+	g, err := parseEngineState(stateBuf)
+	if err != nil {
+		return nil, err
+	}
+	b := tabulaBoard(g, g.Board)
+
+	available, _ := b.Available(1)
+	b.Analyze(available, analysis, true)
+
+	result := &bei.EventOkMove{
+		Moves: []*bei.Move{},
+	}
+	if len(*analysis) > 0 {
+		// The score of each analysis is offset by the engine when a move is
+		// preferred, such as when the move is an opening move or leaves the
+		// players past contact. Moves are weighed by their evaluation alone.
+		scores := make([]float64, len(*analysis))
+		minScore, maxScore := math.Inf(1), math.Inf(-1)
+		for i, a := range *analysis {
+			scores[i] = a.PlayerScore
+			if !math.IsNaN(a.OppScore) {
+				scores[i] += a.OppScore * tabula.WeightOppScore
+			}
+			minScore = math.Min(minScore, scores[i])
+			maxScore = math.Max(maxScore, scores[i])
+		}
+		spread := (maxScore - minScore) * botStrengthNoise(strength)
+
+		var chosen *tabula.Analysis
+		var chosenScore float64
+		for i, a := range *analysis {
+			score := scores[i] + rand.NormFloat64()*spread
+			if chosen == nil || score < chosenScore {
+				chosen, chosenScore = a, score
+			}
+		}
+
+		move := &bei.Move{}
+		for _, m := range chosen.Moves {
+			if m[0] == 0 && m[1] == 0 {
+				break
+			}
+			move.Play = append(move.Play, &bei.Play{From: int(m[0]), To: int(m[1])})
+		}
+		result.Moves = append(result.Moves, move)
+	}
+	return bei.EncodeEvent(result)
+}
+
+// weakenedDouble evaluates the doubling cube of the provided BEI state using
+// the pip counts of both players, after adding noise to the lead of the player
+// on roll.
+func weakenedDouble(stateBuf []byte, strength int32) ([]byte, error) {
+	g, err := parseEngineState(stateBuf)
+	if err != nil {
+		return nil, err
+	}
+	b := tabulaBoard(g, g.Board)
+
+	cube := bei.CubeEvaluation{}
+	pips, oppPips := float64(b.Pips(1)), float64(b.Pips(2))
+	if pips != 0 && oppPips != 0 {
+		noise := rand.NormFloat64() * botStrengthNoise(strength) * cubeNoise
+
+		offerLead := cubeOfferLead
+		if g.DoublePlayer == 1 {
+			offerLead = cubeRedoubleLead
+		}
+		cube.Offer = (oppPips-pips)/pips+noise >= offerLead
+		cube.Take = (pips-oppPips)/oppPips+noise <= cubeTakeLead
+	}
+	return bei.EncodeEvent(&bei.EventOkDouble{Cube: cube})
+}
+
+// parseEngineState parses a BEI state into a game from the perspective of
+// player 1.
+func parseEngineState(buf []byte) (*bgammon.Game, error) {
+	var stateInts []int
+	for _, v := range bytes.Split(buf, []byte(",")) {
+		i, err := strconv.Atoi(string(v))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode state: %s", err)
+		}
+		stateInts = append(stateInts, i)
+	}
+	state, err := bei.DecodeState(stateInts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %s", err)
+	}
+
+	g := &bgammon.Game{
+		Board:        make([]int8, bgammon.BoardSpaces),
+		Variant:      int8(state.Variant),
+		Roll1:        int8(state.Roll1),
+		Roll2:        int8(state.Roll2),
+		Roll3:        int8(state.Roll3),
+		DoubleValue:  int8(state.CubeValue),
+		DoublePlayer: int8(state.CubePlayer),
+		Points:       int8(state.TotalPoints),
+	}
+	for i, v := range state.Board {
+		g.Board[i] = int8(v)
+	}
+	g.Player1.Points, g.Player2.Points = int8(state.Points1), int8(state.Points2)
+	g.Player1.Entered, g.Player2.Entered = state.Entered1, state.Entered2
+	return g, nil
+}
@@ -0,0 +1,127 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"codeberg.org/tslocum/bei"
+	"codeberg.org/tslocum/bgammon"
+)
+
+// fakeEngine returns a connection to an engine with the provided name which
+// replies to cube decisions with the provided event. Commands received by the
+// engine are sent to the returned channel.
+func fakeEngine(t *testing.T, name string, double interface{}) (net.Conn, chan string) {
+	t.Helper()
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	received := make(chan string, 10)
+	go func() {
+		scanner := bufio.NewScanner(server)
+		for scanner.Scan() {
+			line := scanner.Text()
+			received <- line
+
+			var ev interface{} = &bei.EventOkBEI{Version: 1, ID: map[string]string{"name": name}}
+			if strings.HasPrefix(line, bei.CommandDouble+" ") {
+				ev = double
+			}
+			buf, err := bei.EncodeEvent(ev)
+			if err != nil {
+				t.Errorf("failed to encode engine event: %s", err)
+				return
+			}
+			server.Write(append(buf, '\n'))
+		}
+	}()
+	return client, received
+}
+
+// weakenedCubeDecision returns the reply of a weakened engine to a cube
+// decision.
+func weakenedCubeDecision(t *testing.T, engine net.Conn, state string) interface{} {
+	t.Helper()
+	conn := weakenEngine(engine)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var ev interface{}
+	r := bufio.NewReader(conn)
+	for _, command := range []string{bei.CommandBEI, bei.CommandDouble + " " + state} {
+		_, err := conn.Write([]byte(command + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err = bei.DecodeEvent(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ev
+}
+
+func cubeState(g *bgammon.Game) string {
+	var values []string
+	for _, v := range practiceEngineState(g, 1) {
+		values = append(values, fmt.Sprint(v))
+	}
+	return strings.Join(values, ",")
+}
+
+func TestWeakenedEngineCube(t *testing.T) {
+	g := bgammon.NewGame(bgammon.VariantBackgammon)
+	g.Points, g.Turn = 5, 1
+	state := cubeState(g)
+
+	offer := &bei.EventOkDouble{Cube: bei.CubeEvaluation{Offer: true}}
+	testCases := []struct {
+		name     string
+		engine   string
+		double   interface{}
+		state    string
+		cube     *bei.CubeEvaluation // Expected cube evaluation, or nil when any evaluation is expected.
+		answered bool                // Whether the cube decision is expected to reach the engine.
+	}{
+		{"engine evaluates cube", "gnubg", offer, state, &offer.Cube, true},
+		{"engine fails to evaluate cube", "gnubg", &bei.EventFailDouble{Reason: "unsupported"}, state, nil, true},
+		{"engine does not evaluate cube", "tabula", offer, state, nil, false},
+		{"invalid state", "tabula", offer, "invalid", &bei.CubeEvaluation{Take: true}, false},
+	}
+	SetBotStrength(BotStrengthFull)
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			engine, received := fakeEngine(t, c.engine, c.double)
+			ev := weakenedCubeDecision(t, engine, c.state)
+			double, ok := ev.(*bei.EventOkDouble)
+			if !ok {
+				t.Fatalf("unexpected reply: %+v", ev)
+			} else if c.cube != nil && double.Cube != *c.cube {
+				t.Errorf("unexpected cube evaluation: expected %+v, got %+v", *c.cube, double.Cube)
+			}
+
+			// Commands are received by the engine before it replies.
+			var answered bool
+			for len(received) > 0 {
+				if strings.HasPrefix(<-received, bei.CommandDouble+" ") {
+					answered = true
+				}
+			}
+			if answered != c.answered {
+				t.Errorf("unexpected cube decision passed to engine: expected %v, got %v", c.answered, answered)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/bgammon-bei-bot/bot"
+)
+
+// botMatchDelay is the amount of time the bots wait before each action when
+// a bot match is being watched.
+const botMatchDelay = 750 * time.Millisecond
+
+var botMatchCount atomic.Int32
+
+// botMatch is a match between two bots on the local server. The bots play
+// rematches until the match is stopped.
+type botMatch struct {
+	gameID  atomic.Int64  // ID of the match, or zero until it has been created.
+	joined  chan int      // Receives the ID of the match once both bots have joined.
+	conns   []net.Conn    // Connections between the bots and the local server.
+	ready   chan struct{} // Closed once the bots may begin playing.
+	done    chan struct{} // Closed once the match has been stopped.
+	started sync.Once
+	stopped atomic.Bool
+	*sync.Mutex
+}
+
+// startBotMatch connects two bots to the local server. The first bot creates
+// a match which the second bot joins. The bots do not play until start is
+// called, which allows a spectator to join the match before it begins. When
+// delay is non-zero, the bots wait before each action so that the match may
+// be watched.
+func startBotMatch(localServer chan net.Conn, beiClient *bot.BEIClient, variant int8, points int, delay time.Duration) *botMatch {
+	m := &botMatch{
+		joined: make(chan int, 1),
+		ready:  make(chan struct{}),
+		done:   make(chan struct{}),
+		Mutex:  &sync.Mutex{},
+	}
+
+	n := botMatchCount.Add(1)
+	name1 := fmt.Sprintf("BOT_tabula_%d_a", n)
+	name2 := fmt.Sprintf("BOT_tabula_%d_b", n)
+
+	var joined bool
+	conn1 := m.botConn(<-localServer, delay, nil, func(e interface{}) {
+		ev, ok := e.(*bgammon.EventJoined)
+		if !ok {
+			return
+		}
+		switch ev.PlayerNumber {
+		case 1:
+			m.gameID.Store(int64(ev.GameID))
+		case 2:
+			// Spectators may join once the second bot has joined.
+			if !joined {
+				joined = true
+				m.joined <- ev.GameID
+			}
+		}
+	})
+	m.startBot(conn1, name1, points, variant, beiClient)
+
+	// The second bot joins the match created by the first bot instead of
+	// creating its own match.
+	conn2 := m.botConn(<-localServer, delay, func(line []byte) []byte {
+		if !bytes.HasPrefix(line, []byte("c ")) {
+			return line
+		}
+		for m.gameID.Load() == 0 {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return []byte(fmt.Sprintf("j %d", m.gameID.Load()))
+	}, nil)
+	m.startBot(conn2, name2, points, variant, beiClient)
+	return m
+}
+
+// startBot connects a bot to the local server using the provided connection.
+func (m *botMatch) startBot(conn *botPipe, name string, points int, variant int8, beiClient *bot.BEIClient) {
+	client := bot.NewLocalClient(conn, "", name, "", points, variant, false, beiClient)
+	m.Lock()
+	conn.client = client
+	m.Unlock()
+}
+
+// botConn returns a connection to the local server for a bot. Commands sent
+// by the bot may be rewritten, and events received by the bot may be observed.
+func (m *botMatch) botConn(server net.Conn, delay time.Duration, rewrite func(line []byte) []byte, observe func(e interface{})) *botPipe {
+	client, local := net.Pipe()
+
+	m.Lock()
+	m.conns = append(m.conns, server, local)
+	m.Unlock()
+
+	go func() {
+		scanner := bufio.NewScanner(local)
+		for scanner.Scan() {
+			if m.stopped.Load() {
+				continue
+			}
+			line := scanner.Bytes()
+			if rewrite != nil {
+				line = rewrite(line)
+			}
+			if botPlayCommand(line) {
+				<-m.ready
+				if delay > 0 {
+					time.Sleep(delay)
+				}
+				if m.stopped.Load() {
+					continue
+				}
+			}
+			_, err := server.Write(append(line, '\n'))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(server)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			if m.stopped.Load() {
+				return
+			}
+			if observe != nil {
+				e, err := bgammon.DecodeEvent(scanner.Bytes())
+				if err == nil {
+					observe(e)
+				}
+			}
+			_, err := local.Write(append(scanner.Bytes(), '\n'))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return &botPipe{
+		Conn: client,
+		m:    m,
+	}
+}
+
+// botPipe is the connection of a bot to the local server. The bot exits the
+// application when reading from its connection fails, and it may not be
+// stopped otherwise. Once the bot match is stopped, the goroutine reading
+// from the connection exits instead, and the remaining goroutines of the bot
+// exit once its event channel is closed and writing to the connection fails.
+type botPipe struct {
+	net.Conn
+	m      *botMatch
+	client *bot.Client // Bot using the connection.
+}
+
+func (p *botPipe) Read(b []byte) (int, error) {
+	n, err := p.Conn.Read(b)
+	if err != nil && p.m.stopped.Load() {
+		p.m.Lock()
+		client := p.client
+		p.m.Unlock()
+		if client != nil {
+			// The reading goroutine is the only sender of events.
+			close(client.Events)
+			select {
+			case client.Out <- nil:
+			default:
+			}
+		}
+		runtime.Goexit()
+	}
+	return n, err
+}
+
+func (p *botPipe) Write(b []byte) (int, error) {
+	if p.m.stopped.Load() {
+		return 0, io.EOF
+	}
+	return p.Conn.Write(b)
+}
+
+// botPlayCommand returns whether the command is a game action.
+func botPlayCommand(line []byte) bool {
+	command := line
+	if i := bytes.IndexByte(line, ' '); i != -1 {
+		command = line[:i]
+	}
+	switch string(command) {
+	case "r", "roll", "mv", "m", "move", "ok", "k", "d", "double", "resign":
+		return true
+	default:
+		return false
+	}
+}
+
+// start allows the bots to begin playing.
+func (m *botMatch) start() {
+	m.started.Do(func() {
+		close(m.ready)
+	})
+}
+
+// stop disconnects the bots from the local server and stops the bots.
+func (m *botMatch) stop() {
+	if m.stopped.Swap(true) {
+		return
+	}
+	m.start()
+	close(m.done)
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+}
+
+// watchBots plays offline and spectates a match between two bots.
+func (g *Game) watchBots() error {
+	go hideKeyboard()
+	if g.loggedIn {
+		return nil
+	}
+
+	g.startLocalServer()
+	if g.botMatch != nil {
+		g.botMatch.stop()
+	}
+	beiClient := bot.NewLocalBEIClient(<-g.beiConns, true)
+	m := startBotMatch(g.localServer, beiClient, bgammon.VariantBackgammon, 5, botMatchDelay)
+	g.botMatch = m
+
+	go func() {
+		conn := <-g.localServer
+
+		g.Lock()
+		if m.stopped.Load() {
+			g.Unlock()
+			conn.Close()
+			return
+		}
+		g.ConnectLocal(conn)
+		client := g.client
+		g.Unlock()
+
+		// Commands sent before the client has logged in are held until then.
+		select {
+		case gameID := <-m.joined:
+			client.Send([]byte(fmt.Sprintf("j %d", gameID)))
+		case <-m.done:
+		}
+	}()
+	return nil
+}
+
+// stopBotMatch disconnects the bots of the bot match being watched.
+func (g *Game) stopBotMatch() {
+	if g.botMatch == nil {
+		return
+	}
+	g.botMatch.stop()
+	g.botMatch = nil
+}
@@ -1,33 +1,74 @@
 package game
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net"
+	"math"
+	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"codeberg.org/tslocum/bgammon"
 	"codeberg.org/tslocum/gotext"
-	"github.com/coder/websocket"
 )
 
 const clientTimeout = 40 * time.Second
 
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+)
+
 type Client struct {
 	Address       string
+	Email         string // Email address of the account being registered.
 	Username      string
 	Password      string
 	Events        chan interface{}
-	Out           chan []byte
+	Transport     Transport // Overrides the Transport selected by address scheme.
 	connecting    bool
 	loggedIn      bool
+	register      bool
 	resetPassword bool
 	local         bool
+	lanHost       bool // Whether clients on the local network may join matches created by the local client.
 	close         func()
+	out           *commandQueue
+	status        statusSink
+
+	reconnectAttempts int
+	playerName        string    // Name assigned by the server, only accessed while reading events.
+	gameID            int       // Match to rejoin after reconnecting.
+	gamePassword      string    // Password of the match to rejoin, only accessed while reading events.
+	joinPassword      string    // Password sent with the last command which joined or created a match.
+	lastTermination   time.Time // Time the server last terminated the connection.
+	joinLock          *sync.Mutex
+
+	latency *latencyTracker
+}
+
+// statusSink receives the status messages of a client.
+type statusSink interface {
+	// addStatus adds a status message.
+	addStatus(s string)
+
+	// replaceStatus replaces the last status message.
+	replaceStatus(s string)
+}
+
+// statusBufferSink shows the status messages of a client in the status buffer.
+type statusBufferSink struct{}
+
+func (statusBufferSink) addStatus(s string) {
+	ls(s)
+}
+
+func (statusBufferSink) replaceStatus(s string) {
+	lsReplace(s)
 }
 
 func newClient(address string, username string, password string, resetPassword bool) *Client {
@@ -37,8 +78,11 @@ func newClient(address string, username string, password string, resetPassword b
 		Username:      username,
 		Password:      password,
 		Events:        make(chan interface{}, bufferSize),
-		Out:           make(chan []byte, bufferSize),
+		out:           newCommandQueue(),
+		joinLock:      &sync.Mutex{},
+		latency:       newLatencyTracker(),
 		resetPassword: resetPassword,
+		status:        statusBufferSink{},
 	}
 }
 
@@ -48,15 +92,11 @@ func (c *Client) Connect() {
 	}
 	c.connecting = true
 
-	if c.Address == "" {
+	if c.Address == "" && c.Transport == nil {
 		c.Address = DefaultServerAddress
 	}
 
-	if strings.HasPrefix(c.Address, "ws://") || strings.HasPrefix(c.Address, "wss://") {
-		c.connectWebSocket()
-		return
-	}
-	c.connectTCP(nil)
+	c.connect()
 }
 
 func (c *Client) Disconnect() {
@@ -69,13 +109,27 @@ func (c *Client) Disconnect() {
 	}
 }
 
+// Send queues a command to be sent to the server. Commands are held while the
+// client is disconnected. Send never blocks.
+func (c *Client) Send(command []byte) {
+	for _, line := range bytes.Split(command, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if password, ok := matchPassword(line); ok {
+			c.joinLock.Lock()
+			c.joinPassword = password
+			c.joinLock.Unlock()
+		}
+		c.out.push(line)
+	}
+}
+
 func (c *Client) logIn() []byte {
 	if c.resetPassword {
 		return []byte(fmt.Sprintf("resetpassword %s\n", c.Username))
-	} else if game.register {
-		c.Username = game.Username
-		c.Password = game.Password
-		return []byte(fmt.Sprintf("rj %s-%s/%s %s %s %s\n", AppName, AppVersion, AppLanguage, game.Email, game.Username, game.Password))
+	} else if c.register {
+		return []byte(fmt.Sprintf("rj %s-%s/%s %s %s %s\n", AppName, AppVersion, AppLanguage, c.Email, c.Username, c.Password))
 	}
 	loginInfo := strings.ReplaceAll(c.Username, " ", "_")
 	if !c.local && c.Username != "" && c.Password != "" {
@@ -88,20 +142,19 @@ func (c *Client) LoggedIn() bool {
 	return c.connecting
 }
 
-func (c *Client) connectWebSocket() {
+func (c *Client) connect() {
 	if !c.connecting {
 		return
 	}
 
-	connectTime := time.Now()
 	reconnect := func() {
-		if c.resetPassword || time.Since(connectTime) < 20*time.Second {
-			if !c.resetPassword && time.Since(game.lastTermination) > 5*time.Second {
+		if c.resetPassword || c.local || !c.loggedIn {
+			if !c.resetPassword && !c.local && time.Since(c.lastTermination) > 5*time.Second {
 				address := c.Address
 				if address == "" {
 					address = DefaultServerAddress
 				}
-				ls(fmt.Sprintf("*** %s", gotext.Get("Failed to connect to %s", address)))
+				c.status.addStatus(fmt.Sprintf("*** %s", gotext.Get("Failed to connect to %s", address)))
 			}
 			c.connecting = false
 			return
@@ -114,22 +167,36 @@ func (c *Client) connectWebSocket() {
 				time.Sleep(2 * time.Second)
 				continue
 			}
-			ls(fmt.Sprintf("*** %s...", gotext.Get("Reconnecting")))
-			time.Sleep(2 * time.Second)
-			go c.connectWebSocket()
+			delay := reconnectDelay(c.reconnectAttempts)
+			c.reconnectAttempts++
+			if !c.reconnectCountdown(delay) {
+				return
+			}
+			go c.connect()
 			break
 		}
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 10*time.Second)
+	t := c.Transport
+	if t == nil {
+		var err error
+		t, err = newTransport(c.Address)
+		if err != nil {
+			log.Printf("warning: %s", err)
+			reconnect()
+			return
+		}
+	}
 
-	conn, _, err := websocket.Dial(ctx, c.Address, dialOptions)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	err := t.Dial(ctx, c.Address)
+	cancel()
 	if err != nil {
 		reconnect()
 		return
 	}
 	c.close = func() {
-		conn.Close(websocket.StatusNormalClosure, "")
+		t.Close()
 	}
 
 	for _, msg := range bytes.Split(c.logIn(), []byte("\n")) {
@@ -137,68 +204,99 @@ func (c *Client) connectWebSocket() {
 			continue
 		}
 
-		ctx, _ = context.WithTimeout(context.Background(), 10*time.Second)
-
-		err = conn.Write(ctx, websocket.MessageText, msg)
+		err = t.WriteLine(msg)
 		if err != nil {
+			t.Close()
 			reconnect()
 			return
 		}
+		recorder.record("->", redactCommand(msg))
 	}
 
-	go c.handleWebSocketWrite(conn)
-	c.handleWebSocketRead(conn)
+	if c.loggedIn {
+		c.out.dropStale()
+	}
+
+	c.latency.setConnected(true)
+
+	done := make(chan struct{})
+	go c.handleWrite(t, done)
+	if !c.local {
+		go c.handleLatency(done)
+	}
+	err = c.handleRead(t)
+	close(done)
+
+	c.latency.setConnected(false)
+
+	if errors.Is(err, ErrSessionEnded) {
+		if c.connecting {
+			c.status.addStatus("*** " + gotext.Get("Session ended."))
+		}
+		c.connecting = false
+		return
+	}
 
 	reconnect()
 }
 
-func (c *Client) handleWebSocketWrite(conn *websocket.Conn) {
-	var ctx context.Context
-	for buf := range c.Out {
-		split := bytes.Split(buf, []byte("\n"))
-		for i := range split {
-			if len(split[i]) == 0 {
-				continue
-			}
+func (c *Client) handleWrite(t Transport, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.out.ready:
+		}
 
-			ctx, _ = context.WithTimeout(context.Background(), 10*time.Second)
+		for {
+			queued, ok := c.out.pop()
+			if !ok {
+				break
+			}
+			command := queued.command
 
-			err := conn.Write(ctx, websocket.MessageText, split[i])
+			err := t.WriteLine(command)
 			if err != nil {
-				conn.Close(websocket.StatusNormalClosure, gotext.Get("Write error"))
+				c.out.pushFront(queued)
+				t.Close()
 				return
 			}
 
+			recorder.record("->", redactCommand(command))
+
+			if isListCommand(command) {
+				c.latency.requested(queued.probe)
+			}
+
 			if Debug > 0 {
-				log.Printf("-> %s", split[i])
+				log.Printf("-> %s", command)
 			}
 		}
 	}
 }
 
-func (c *Client) handleWebSocketRead(conn *websocket.Conn) {
+// handleRead passes events read from the server to the user interface until
+// reading fails. The error is returned.
+func (c *Client) handleRead(t Transport) error {
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
-		msgType, msg, err := conn.Read(ctx)
-		cancel()
-		if err != nil || msgType != websocket.MessageText {
-			conn.Close(websocket.StatusNormalClosure, gotext.Get("Read error"))
-			return
+		msg, err := t.ReadEvent()
+		if err != nil {
+			t.Close()
+			return err
 		}
 
+		recorder.record("<-", msg)
+
 		ev, err := bgammon.DecodeEvent(msg)
 		if err != nil {
 			log.Printf("warning: failed to parse message: %s", msg)
-			ls("*** " + gotext.Get("Warning: Received unrecognized event from server."))
-			ls("*** " + gotext.Get("You may need to upgrade your client."))
+			c.status.addStatus("*** " + gotext.Get("Warning: Received unrecognized event from server."))
+			c.status.addStatus("*** " + gotext.Get("You may need to upgrade your client."))
 			continue
 		}
-		if !c.loggedIn {
-			if _, ok := ev.(*bgammon.EventWelcome); ok {
-				c.loggedIn = true
-			}
+		if !c.trackEvent(ev) {
+			c.Events <- ev
 		}
-		c.Events <- ev
 
 		if Debug > 0 {
 			log.Printf("<- %s", msg)
@@ -206,143 +304,101 @@ func (c *Client) handleWebSocketRead(conn *websocket.Conn) {
 	}
 }
 
-func (c *Client) connectTCP(conn net.Conn) {
-	if !c.connecting {
-		return
-	}
-
-	address := c.Address
-	if strings.HasPrefix(c.Address, "tcp://") {
-		address = c.Address[6:]
-	}
-
-	connectTime := time.Now()
-	reconnect := func() {
-		if c.resetPassword || time.Since(connectTime) < 20*time.Second {
-			if !c.resetPassword && time.Since(game.lastTermination) > 5*time.Second {
-				address := c.Address
-				if address == "" {
-					address = DefaultServerAddress
-				}
-				ls(fmt.Sprintf("*** %s", gotext.Get("Failed to connect to %s", address)))
-			}
-			c.connecting = false
-			return
+// matchPassword returns the password sent with a command which joins or
+// creates a match. It returns false when the command does not join or create
+// a match.
+func matchPassword(command []byte) (string, bool) {
+	split := bytes.Split(command, []byte(" "))
+	switch string(bytes.ToLower(split[0])) {
+	case "j", "join":
+		if len(split) < 2 {
+			return "", false
 		}
-		for {
-			if !c.connecting {
-				return
-			}
-			if !focused() {
-				time.Sleep(2 * time.Second)
-				continue
-			}
-			ls(fmt.Sprintf("*** %s...", gotext.Get("Reconnecting")))
-			time.Sleep(2 * time.Second)
-			go c.connectTCP(nil)
-			break
+		return string(bytes.Join(split[2:], []byte(" "))), true
+	case "c", "create":
+		if len(split) < 3 || !bytes.EqualFold(split[1], []byte("private")) {
+			return "", true
 		}
+		return string(split[2]), true
+	default:
+		return "", false
 	}
+}
 
-	if conn == nil {
-		var err error
-		conn, err = net.DialTimeout("tcp", address, 10*time.Second)
-		if err != nil {
-			reconnect()
-			return
-		}
-	}
-	c.close = func() {
-		conn.Close()
+// reconnectDelay returns the capped exponential backoff delay for the
+// specified reconnection attempt, with up to half of the delay randomized.
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < 16 && reconnectBaseDelay<<attempt < reconnectMaxDelay {
+		delay = reconnectBaseDelay << attempt
 	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
 
-	// Read a single line of text and parse remaining output as JSON.
-	buf := make([]byte, 1)
-	var readBytes int
+// reconnectCountdown displays the time remaining until the next connection
+// attempt. It returns false when the client is disconnected while waiting.
+func (c *Client) reconnectCountdown(delay time.Duration) bool {
+	until := time.Now().Add(delay)
+	var shown bool
 	for {
-		_, err := conn.Read(buf)
-		if err != nil {
-			reconnect()
-			return
+		if !c.connecting {
+			return false
 		}
-
-		if buf[0] == '\n' {
+		remaining := time.Until(until)
+		if remaining <= 0 {
 			break
 		}
-
-		readBytes++
-		if readBytes == 512 {
-			reconnect()
-			return
-		}
-	}
-
-	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-
-	_, err := conn.Write(c.logIn())
-	if err != nil {
-		reconnect()
-		return
-	}
-
-	go c.handleTCPWrite(conn)
-	c.handleTCPRead(conn)
-
-	reconnect()
-}
-
-func (c *Client) handleTCPWrite(conn net.Conn) {
-	for buf := range c.Out {
-		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-
-		_, err := conn.Write(buf)
-		if err != nil {
-			conn.Close()
-			return
-		}
-
-		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-
-		_, err = conn.Write([]byte("\n"))
-		if err != nil {
-			conn.Close()
-			return
-		}
-
-		if Debug > 0 {
-			log.Printf("-> %s", buf)
+		seconds := int(math.Ceil(remaining.Seconds()))
+		msg := fmt.Sprintf("*** %s...", gotext.GetN("Reconnecting in %d second", "Reconnecting in %d seconds", seconds, seconds))
+		if !shown {
+			c.status.addStatus(msg)
+			shown = true
+		} else {
+			c.status.replaceStatus(msg)
 		}
+		time.Sleep(remaining - time.Duration(seconds-1)*time.Second)
 	}
+	c.status.replaceStatus(fmt.Sprintf("*** %s...", gotext.Get("Reconnecting")))
+	return true
 }
 
-func (c *Client) handleTCPRead(conn net.Conn) {
-	conn.SetReadDeadline(time.Now().Add(clientTimeout))
-
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		if scanner.Err() != nil {
-			conn.Close()
-			return
+// trackEvent updates the connection state of the client before an event is
+// passed to the user interface. It returns whether the event was handled by
+// the client and should not be passed to the user interface.
+func (c *Client) trackEvent(ev interface{}) bool {
+	switch ev := ev.(type) {
+	case *bgammon.EventWelcome:
+		c.playerName = ev.PlayerName
+		if c.loggedIn && c.gameID != 0 {
+			c.status.addStatus(fmt.Sprintf("*** %s...", gotext.Get("Rejoining match")))
+			c.Send([]byte(strings.TrimSpace(fmt.Sprintf("j %d %s", c.gameID, c.gamePassword))))
 		}
-
-		ev, err := bgammon.DecodeEvent(scanner.Bytes())
-		if err != nil {
-			log.Printf("warning: failed to parse message: %s", scanner.Bytes())
-			ls("*** " + gotext.Get("Warning: Received unrecognized event from server."))
-			ls("*** " + gotext.Get("You may need to upgrade your client."))
-			continue
+		c.loggedIn = true
+		c.register = false
+		c.reconnectAttempts = 0
+	case *bgammon.EventJoined:
+		if ev.Player == c.playerName {
+			c.joinLock.Lock()
+			c.gameID, c.gamePassword = ev.GameID, c.joinPassword
+			c.joinLock.Unlock()
+			c.latency.setInMatch(true)
 		}
-		if !c.loggedIn {
-			if _, ok := ev.(*bgammon.EventWelcome); ok {
-				c.loggedIn = true
-			}
+	case *bgammon.EventLeft:
+		if ev.Player == c.playerName {
+			c.gameID, c.gamePassword = 0, ""
+			c.latency.setInMatch(false)
 		}
-		c.Events <- ev
-
-		if Debug > 0 {
-			log.Printf("<- %s", scanner.Bytes())
+	case *bgammon.EventFailedJoin:
+		c.gameID, c.gamePassword = 0, ""
+		c.latency.setInMatch(false)
+	case *bgammon.EventNotice:
+		if strings.HasPrefix(ev.Message, "Connection terminated") {
+			c.lastTermination = time.Now()
 		}
-
-		conn.SetReadDeadline(time.Now().Add(clientTimeout))
+	case *bgammon.EventList:
+		// Replies to latency probes are not shown, as the match list is
+		// refreshed by the lobby while it is visible.
+		return c.latency.received()
 	}
+	return false
 }
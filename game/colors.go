@@ -1,16 +1,40 @@
 package game
 
-import "image/color"
+import (
+	"image/color"
+
+	"codeberg.org/tslocum/boxcars/render"
+)
 
 var (
 	tableColor     = color.RGBA{0, 102, 51, 255}
-	frameColor     = color.RGBA{65, 40, 14, 255}
-	borderColor    = color.RGBA{0, 0, 0, 255}
-	faceColor      = color.RGBA{120, 63, 25, 255}
+	frameColor     = render.FrameColor
+	borderColor    = render.BorderColor
+	faceColor      = render.FaceColor
 	hintColor      = color.RGBA{27, 18, 0, 255}
-	triangleA      = color.RGBA{225, 188, 125, 255}
+	triangleA      = render.TriangleA
 	triangleALight = color.RGBA{255, 218, 155, 255}
-	triangleB      = color.RGBA{120, 17, 0, 255}
+	triangleB      = render.TriangleB
+)
+
+// Connection indicator colors.
+var (
+	connectionGoodColor     = color.RGBA{96, 192, 96, 255}
+	connectionDegradedColor = color.RGBA{240, 192, 64, 255}
+	connectionOfflineColor  = color.RGBA{224, 80, 64, 255}
+)
+
+// Replay analysis colors.
+var (
+	moveBestColor       = color.RGBA{96, 192, 96, 255}
+	moveInaccuracyColor = color.RGBA{240, 192, 64, 255}
+	moveBlunderColor    = color.RGBA{224, 80, 64, 255}
+)
+
+// Replay timeline colors.
+var (
+	replayTimelineGameColor = color.RGBA{255, 218, 155, 255}
+	replayTimelineCubeColor = color.RGBA{240, 192, 64, 255}
 )
 
 /*
@@ -0,0 +1,274 @@
+package game
+
+import (
+	"image/color"
+	"strconv"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/etk"
+	"codeberg.org/tslocum/gotext"
+)
+
+// positionEditor holds the controls used to set up a position in the board
+// editor. Checkers are placed by dragging them on the board.
+type positionEditor struct {
+	turn      *etk.Select
+	roll1     *etk.Select
+	roll2     *etk.Select
+	cubeValue *etk.Select
+	cubeOwner *etk.Select
+	points    *etk.Select
+	score1    *etk.Select
+	score2    *etk.Select
+
+	grid *etk.Grid
+}
+
+func (e *positionEditor) selects() []*etk.Select {
+	return []*etk.Select{e.turn, e.roll1, e.roll2, e.cubeValue, e.cubeOwner, e.points, e.score1, e.score2}
+}
+
+func (b *board) createEditorControls() {
+	e := &positionEditor{}
+	newSelect := func(set func(g *bgammon.Game, index int), options ...string) *etk.Select {
+		s := etk.NewSelect(game.itemHeight(), b.editorSelectFunc(set))
+		s.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+		for _, option := range options {
+			s.AddOption(option)
+		}
+		return s
+	}
+	numbers := func(start int, end int) []string {
+		var options []string
+		for i := start; i <= end; i++ {
+			options = append(options, strconv.Itoa(i))
+		}
+		return options
+	}
+
+	e.turn = newSelect(func(g *bgammon.Game, index int) {
+		g.Turn = int8(index) + 1
+	}, gotext.Get("You"), gotext.Get("Bot"))
+	dice := append([]string{"-"}, numbers(1, 6)...)
+	e.roll1 = newSelect(func(g *bgammon.Game, index int) {
+		g.Roll1 = int8(index)
+	}, dice...)
+	e.roll2 = newSelect(func(g *bgammon.Game, index int) {
+		g.Roll2 = int8(index)
+	}, dice...)
+	var cubeValues []string
+	for i := 0; i <= 6; i++ {
+		cubeValues = append(cubeValues, strconv.Itoa(1<<i))
+	}
+	e.cubeValue = newSelect(func(g *bgammon.Game, index int) {
+		g.DoubleValue = 1 << index
+	}, cubeValues...)
+	e.cubeOwner = newSelect(func(g *bgammon.Game, index int) {
+		g.DoublePlayer = int8(index)
+	}, gotext.Get("Centered"), gotext.Get("You"), gotext.Get("Bot"))
+	e.points = newSelect(func(g *bgammon.Game, index int) {
+		g.Points = int8(index) + 1
+	}, numbers(1, 25)...)
+	e.score1 = newSelect(func(g *bgammon.Game, index int) {
+		g.Player1.Points = int8(index)
+	}, numbers(0, 24)...)
+	e.score2 = newSelect(func(g *bgammon.Game, index int) {
+		g.Player2.Points = int8(index)
+	}, numbers(0, 24)...)
+
+	itemHeight := game.itemHeight()
+	e.grid = etk.NewGrid()
+	e.grid.SetColumnSizes(-1, -1, -1)
+	e.grid.SetRowPadding(etk.Scale(5))
+	var gridY int
+	addRow := func(label string, selects ...*etk.Select) {
+		l := resizeText(label)
+		l.SetVertical(etk.AlignCenter)
+		e.grid.AddChildAt(l, 0, gridY, 1, 1)
+		if len(selects) == 1 {
+			e.grid.AddChildAt(selects[0], 1, gridY, 2, 1)
+		} else {
+			for i, s := range selects {
+				e.grid.AddChildAt(s, 1+i, gridY, 1, 1)
+			}
+		}
+		gridY++
+	}
+	addRow(gotext.Get("Turn"), e.turn)
+	addRow(gotext.Get("Dice"), e.roll1, e.roll2)
+	addRow(gotext.Get("Cube"), e.cubeValue, e.cubeOwner)
+	addRow(gotext.Get("Points"), e.points)
+	addRow(gotext.Get("Score"), e.score1, e.score2)
+
+	buttonGrid := etk.NewGrid()
+	buttonGrid.SetColumnPadding(etk.Scale(5))
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Clear"), b.selectEditorClear), 0, 0, 1, 1)
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Reset"), b.selectEditorReset), 1, 0, 1, 1)
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Play"), b.selectEditorPlay), 2, 0, 1, 1)
+	e.grid.AddChildAt(buttonGrid, 0, gridY, 3, 1)
+	gridY++
+
+	rowSizes := make([]int, gridY)
+	for i := range rowSizes {
+		rowSizes[i] = itemHeight
+	}
+	rowSizes[len(rowSizes)-1] = etk.Scale(baseButtonHeight)
+	e.grid.SetRowSizes(rowSizes...)
+
+	b.editor = e
+}
+
+// startEditing shows the board editor with the provided position, or the
+// starting position when no position is provided.
+func (b *board) startEditing(position *bgammon.Game) {
+	b.Lock()
+	defer b.Unlock()
+
+	var g *bgammon.Game
+	if position != nil {
+		g = position.Copy(true)
+	} else {
+		g = bgammon.NewGame(bgammon.VariantBackgammon)
+		g.Turn = 1
+	}
+	g.Player1.Name, g.Player2.Name = b.gameState.Player1.Name, b.gameState.Player2.Name
+	g.Winner = 0
+	g.Moves = nil
+	g.DoubleOffered = false
+	*b.gameState = bgammon.GameState{
+		Game:         g,
+		PlayerNumber: 1,
+	}
+	b.playerRoll1, b.playerRoll2, b.playerRoll3 = 0, 0, 0
+	b.opponentRoll1, b.opponentRoll2, b.opponentRoll3 = 0, 0, 0
+	b.playerMoves, b.opponentMoves = nil, nil
+	b.dragging = nil
+
+	e := b.editor
+	e.turn.SetSelectedItem(int(g.Turn - 1))
+	e.roll1.SetSelectedItem(int(g.Roll1))
+	e.roll2.SetSelectedItem(int(g.Roll2))
+	var cubeIndex int
+	for v := g.DoubleValue; v > 1; v /= 2 {
+		cubeIndex++
+	}
+	e.cubeValue.SetSelectedItem(cubeIndex)
+	e.cubeOwner.SetSelectedItem(int(g.DoublePlayer))
+	e.points.SetSelectedItem(int(g.Points - 1))
+	e.score1.SetSelectedItem(int(g.Player1.Points))
+	e.score2.SetSelectedItem(int(g.Player2.Points))
+
+	b.editing = true
+	b.recreateUIGrid()
+	b.processState()
+	scheduleFrame()
+}
+
+// stopEditing hides the board editor.
+func (b *board) stopEditing() {
+	if !b.editing {
+		return
+	}
+	b.editing = false
+	for _, s := range b.editor.selects() {
+		s.SetMenuVisible(false)
+	}
+	b.recreateUIGrid()
+}
+
+// editMoveChecker moves a checker in the board editor. Checkers may be moved
+// to any space which is not occupied by the opponent.
+func (b *board) editMoveChecker(s *Sprite, from int8, to int8) {
+	player, sign := int8(1), int8(1)
+	if s.colorWhite != b.flipBoard {
+		player, sign = 2, -1
+	}
+	switch to {
+	case bgammon.SpaceHomePlayer, bgammon.SpaceHomeOpponent:
+		to = bgammon.SpaceHomePlayer
+		if player == 2 {
+			to = bgammon.SpaceHomeOpponent
+		}
+	case bgammon.SpaceBarPlayer, bgammon.SpaceBarOpponent:
+		to = bgammon.SpaceBarPlayer
+		if player == 2 {
+			to = bgammon.SpaceBarOpponent
+		}
+	}
+	board := b.gameState.Board
+	if from == to || from < 0 || board[from]*sign <= 0 || board[to]*sign < 0 {
+		return
+	}
+	board[from] -= sign
+	board[to] += sign
+	playSoundEffect(effectMove)
+}
+
+// editorSelectFunc returns a function which applies the option selected in
+// one of the editor controls to the position.
+func (b *board) editorSelectFunc(set func(g *bgammon.Game, index int)) func(index int) (accept bool) {
+	return func(index int) (accept bool) {
+		b.Lock()
+		defer b.Unlock()
+
+		if !b.editing {
+			return false
+		}
+		set(b.gameState.Game, index)
+		b.processState()
+		scheduleFrame()
+		return true
+	}
+}
+
+func (b *board) selectEditorClear() error {
+	b.Lock()
+	defer b.Unlock()
+
+	board := make([]int8, bgammon.BoardSpaces)
+	board[bgammon.SpaceHomePlayer], board[bgammon.SpaceHomeOpponent] = 15, -15
+	b.gameState.Board = board
+	b.processState()
+	scheduleFrame()
+	return nil
+}
+
+func (b *board) selectEditorReset() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.gameState.Board = bgammon.NewBoard(bgammon.VariantBackgammon)
+	b.processState()
+	scheduleFrame()
+	return nil
+}
+
+func (b *board) selectEditorPlay() error {
+	b.Lock()
+	g := b.gameState.Game.Copy(true)
+	b.Unlock()
+
+	var reason string
+	switch {
+	case g.Board[bgammon.SpaceHomePlayer] == 15 || g.Board[bgammon.SpaceHomeOpponent] == -15:
+		reason = gotext.Get("Each player must have at least one checker on the board.")
+	case (g.Roll1 == 0) != (g.Roll2 == 0):
+		reason = gotext.Get("Select both dice or neither die.")
+	case g.Player1.Points >= g.Points || g.Player2.Points >= g.Points:
+		reason = gotext.Get("Scores must be less than the match points.")
+	case g.Points == 1 && g.DoubleValue != 1:
+		reason = gotext.Get("The cube may not be used in a single point match.")
+	case (g.DoubleValue == 1) != (g.DoublePlayer == 0):
+		reason = gotext.Get("The cube must be centered when its value is 1.")
+	}
+	if reason != "" {
+		ls("*** " + gotext.Get("Failed to play position: %s", reason))
+		return nil
+	}
+
+	b.Lock()
+	b.stopEditing()
+	b.Unlock()
+	game.playPosition(g)
+	return nil
+}
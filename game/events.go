@@ -0,0 +1,187 @@
+package game
+
+import (
+	"fmt"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/gotext"
+)
+
+// The functions and types in this file handle server events without
+// depending on a user interface. They are shared by the graphical client and
+// the terminal client.
+
+func welcomeMessage(ev *bgammon.EventWelcome) string {
+	clients := gotext.GetN("There is %d client", "There are %d clients", ev.Clients, ev.Clients)
+	matches := gotext.GetN("%d match", "%d matches", ev.Games, ev.Games)
+	return "*** " + gotext.Get("Welcome, %[1]s. %[2]s playing %[3]s.", ev.PlayerName, clients, matches)
+}
+
+func sayMessage(player string, message string) string {
+	return fmt.Sprintf("<%s> %s", player, message)
+}
+
+func winMessages(ev *bgammon.EventWin) []string {
+	var messages []string
+	if ev.Resigned != "" {
+		messages = append(messages, gotext.Get("%s resigned.", ev.Resigned))
+	}
+	var message string
+	if ev.Points <= 1 {
+		message = gotext.Get("%s wins!", ev.Player)
+	} else {
+		message = gotext.GetN("%[1]s wins %[2]d point!", "%[1]s wins %[2]d points!", int(ev.Points), ev.Player, ev.Points)
+	}
+	if ev.Rating != 0 {
+		message += fmt.Sprintf(" (+%d)", ev.Rating)
+	}
+	return append(messages, message)
+}
+
+func failedMoveMessages(ev *bgammon.EventFailedMove, available [][]int8) []string {
+	var extra string
+	if ev.From != 0 || ev.To != 0 {
+		extra = " " + gotext.Get("from %s to %s", bgammon.FormatSpace(ev.From), bgammon.FormatSpace(ev.To))
+	}
+	return []string{
+		"*** " + gotext.Get("Failed to move checker%s: %s", extra, ev.Reason),
+		"*** " + gotext.Get("Legal moves: %s", bgammon.FormatMoves(available)),
+	}
+}
+
+// turnPlayerName returns the name of the player whose turn it is.
+func turnPlayerName(gs *bgammon.GameState) string {
+	if gs.Turn == 2 {
+		return gs.Player2.Name
+	}
+	return gs.Player1.Name
+}
+
+// rollLogMessage returns the game log entry for the current roll.
+func rollLogMessage(gs *bgammon.GameState) string {
+	var extra string
+	if gs.Turn != 0 && len(gs.Available) > 0 {
+		extra = ":"
+	}
+	return turnPlayerName(gs) + " " + formatRoll(gs.Roll1, gs.Roll2, gs.Roll3) + extra
+}
+
+// moveLogMessage returns the game log entry for the current roll and moves.
+func moveLogMessage(gs *bgammon.GameState) string {
+	var moves string
+	if len(gs.Moves) > 0 {
+		moves = string(bgammon.FormatMoves(gs.Moves))
+	}
+	return turnPlayerName(gs) + " " + formatRoll(gs.Roll1, gs.Roll2, gs.Roll3) + ": " + moves
+}
+
+// sessionState tracks the lobby and match state reported by the server.
+type sessionState struct {
+	username  string
+	games     []bgammon.GameListing
+	gameID    int
+	gameState *bgammon.GameState
+
+	incomingRoll bool
+	incomingMove bool
+}
+
+func newSessionState() *sessionState {
+	return &sessionState{
+		gameState: &bgammon.GameState{
+			Game: bgammon.NewGame(bgammon.VariantBackgammon),
+		},
+	}
+}
+
+// inMatch returns whether the player has joined a match.
+func (s *sessionState) inMatch() bool {
+	return s.gameID != 0
+}
+
+// apply updates the session state using the provided event. It returns the
+// messages to add to the status log and the game log.
+func (s *sessionState) apply(e interface{}) (status []string, gameLog []string) {
+	switch ev := e.(type) {
+	case *bgammon.EventWelcome:
+		s.username = ev.PlayerName
+		status = append(status, welcomeMessage(ev))
+	case *bgammon.EventNotice:
+		status = append(status, "*** "+ev.Message)
+	case *bgammon.EventSay:
+		status = append(status, sayMessage(ev.Player, ev.Message))
+	case *bgammon.EventList:
+		s.games = ev.Games
+	case *bgammon.EventFailedCreate:
+		status = append(status, "*** "+gotext.Get("Failed to create match: %s", ev.Reason))
+	case *bgammon.EventJoined:
+		if ev.Player == s.username {
+			s.gameID = ev.GameID
+			s.gameState = &bgammon.GameState{
+				Game:         bgammon.NewGame(bgammon.VariantBackgammon),
+				PlayerNumber: ev.PlayerNumber,
+			}
+		} else {
+			gameLog = append(gameLog, gotext.Get("%s joined the match.", ev.Player))
+		}
+		if ev.PlayerNumber == 1 {
+			s.gameState.Player1.Name = ev.Player
+		} else if ev.PlayerNumber == 2 {
+			s.gameState.Player2.Name = ev.Player
+		}
+	case *bgammon.EventFailedJoin:
+		status = append(status, "*** "+gotext.Get("Failed to join match: %s", ev.Reason))
+	case *bgammon.EventFailedLeave:
+		status = append(status, "*** "+gotext.Get("Failed to leave match: %s", ev.Reason))
+	case *bgammon.EventLeft:
+		if ev.Player == s.username {
+			s.gameID = 0
+		} else {
+			if s.gameState.Player1.Name == ev.Player {
+				s.gameState.Player1.Name = ""
+			} else if s.gameState.Player2.Name == ev.Player {
+				s.gameState.Player2.Name = ""
+			}
+			gameLog = append(gameLog, gotext.Get("%s left the match.", ev.Player))
+		}
+	case *bgammon.EventBoard:
+		gs := ev.GameState
+		gs.Game = ev.GameState.Game.Copy(false)
+		s.gameState = &gs
+		if s.incomingRoll && gs.Roll1 != 0 && gs.Roll2 != 0 {
+			gameLog = append(gameLog, rollLogMessage(s.gameState))
+		}
+		if s.incomingMove && gs.Roll1 != 0 && gs.Roll2 != 0 {
+			gameLog = append(gameLog, moveLogMessage(s.gameState))
+		}
+		s.incomingRoll, s.incomingMove = false, false
+	case *bgammon.EventRolled:
+		gs := s.gameState
+		gs.Roll1, gs.Roll2, gs.Roll3 = ev.Roll1, ev.Roll2, ev.Roll3
+		if gs.Turn == 0 {
+			roll := formatRoll(ev.Roll1, 0, 0)
+			if gs.Player1.Name != ev.Player {
+				roll = formatRoll(0, ev.Roll2, 0)
+			}
+			gameLog = append(gameLog, gotext.Get("%s rolled %s", ev.Player, roll))
+		} else if gs.Roll1 != 0 && gs.Roll2 != 0 {
+			s.incomingRoll = true
+		}
+	case *bgammon.EventFailedRoll:
+		status = append(status, fmt.Sprintf("*** %s: %s", gotext.Get("Failed to roll"), ev.Reason))
+	case *bgammon.EventMoved:
+		s.incomingMove, s.incomingRoll = true, false
+	case *bgammon.EventFailedMove:
+		status = append(status, failedMoveMessages(ev, s.gameState.Available)...)
+	case *bgammon.EventFailedOk:
+		status = append(status, "*** "+gotext.Get("Failed to submit moves: %s", ev.Reason))
+	case *bgammon.EventWin:
+		gameLog = append(gameLog, winMessages(ev)...)
+	case *bgammon.EventPing, *bgammon.EventSettings, *bgammon.EventAchievements, *bgammon.EventReplay, *bgammon.EventHistory:
+		// These events do not affect the session state.
+	default:
+		status = append(status, "*** "+gotext.Get("Warning: Received unknown event: %+v", ev))
+		status = append(status, "*** "+gotext.Get("You may need to upgrade your client."))
+	}
+	return status, gameLog
+}
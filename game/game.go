@@ -3,6 +3,7 @@ package game
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
 	"image"
@@ -25,6 +26,8 @@ import (
 	"codeberg.org/tslocum/bgammon"
 	"codeberg.org/tslocum/bgammon-bei-bot/bot"
 	"codeberg.org/tslocum/bgammon/pkg/server"
+	"codeberg.org/tslocum/boxcars/render"
+	"codeberg.org/tslocum/boxcars/replay"
 	"codeberg.org/tslocum/etk"
 	"codeberg.org/tslocum/etk/kibodo"
 	"codeberg.org/tslocum/gotext"
@@ -91,7 +94,7 @@ var (
 )
 
 var (
-	checkerColor = color.RGBA{232, 211, 162, 255}
+	checkerColor = render.CheckerColor
 )
 
 const maxStatusWidthRatio = 0.5
@@ -191,6 +194,16 @@ func ls(s string) {
 	scheduleFrame()
 }
 
+// lsReplace replaces the last line of the status buffer.
+func lsReplace(s string) {
+	if !statusLogged {
+		ls(s)
+		return
+	}
+	statusBuffer.SetLast(time.Now().Format("[3:04]") + " " + s)
+	scheduleFrame()
+}
+
 func lg(s string) {
 	t := time.Now().Format("[3:04]")
 	m := t + " " + s
@@ -542,7 +555,7 @@ func setViewBoard(view bool) {
 	}
 
 	if refreshLobby && game.client != nil {
-		game.client.Out <- []byte("list")
+		game.client.Send([]byte("list"))
 	}
 
 	scheduleFrame()
@@ -603,6 +616,9 @@ type Game struct {
 	loggedIn      bool
 
 	JoinGame   int
+	Playback   string
+	Profile    string
+	Locale     string // Locale specified when starting the application.
 	Mute       bool
 	Instant    bool
 	Fullscreen bool
@@ -625,6 +641,11 @@ type Game struct {
 	connectUsername *Input
 	connectPassword *Input
 	connectServer   *Input
+	connectProfile  *etk.Select
+	connectLAN      *etk.Select
+
+	lanAddresses       []string // Addresses of the servers listed in connectLAN.
+	lanPreviousAddress string   // Server address before a LAN server was selected.
 
 	registerEmail    *Input
 	registerUsername *Input
@@ -641,6 +662,13 @@ type Game struct {
 	aboutDialog *Dialog
 	quitDialog  *Dialog
 
+	profileDialog       *Dialog
+	profileName         *Input
+	profileLocale       *Input
+	profileSavePassword *etk.Checkbox
+	profileDeleteDialog *Dialog
+	profileDeleteLabel  *etk.Text
+
 	bufferFontSize int
 
 	pressedKeys  []ebiten.Key
@@ -670,6 +698,7 @@ type Game struct {
 
 	savedUsername string
 	savedPassword string
+	profiles      *profileConfig
 
 	initialized bool
 	loaded      bool
@@ -678,17 +707,32 @@ type Game struct {
 	showReset    bool
 
 	downloadReplay int
+	downloadFormat replay.Format // Format of the replay being downloaded.
+	replayFormat   replay.Format // Format selected for downloading replays.
 
-	replay       bool
-	replayData   []byte
-	replayFrame  int
-	replayFrames []*replayFrame
+	replay          bool
+	replayData      []byte
+	replayFrame     int
+	replayFrames    []*replayFrame
+	replayAnalysis  chan *replayAnalysisResult // Receives the analysis of each move while a replay is analyzed.
+	replayExporting bool
+	replayLibrary   *replayLibrary
 
 	leavingMatch bool
 
-	localServer chan net.Conn
+	localServer       chan net.Conn
+	beiConns          chan net.Conn
+	lanListener       net.Listener
+	lanAnnounceCancel context.CancelFunc // Stops announcing the server hosted via lanListener.
+	botMatch          *botMatch          // Bot match being watched.
+	hotSeat           *hotSeat
+	offlineTurn       int8 // Turn of the last saved offline match.
+	offlineUnsaved    bool // Whether the player was told the offline match will not be saved.
 
-	lastTermination time.Time
+	practice            *practiceServer
+	practicePosition    *bgammon.Game // Last position set up in the board editor.
+	practiceReplay      []byte        // Replay resumed when the practice game ends.
+	practiceReplayFrame int           // Frame of the replay which was taken over.
 
 	*sync.Mutex
 }
@@ -811,6 +855,16 @@ func (g *Game) initialize() {
 		labelWidth /= 2
 	}
 
+	profiles, err := loadProfiles()
+	if err != nil {
+		log.Printf("warning: failed to load server profiles: %s", err)
+		profiles = &profileConfig{}
+	}
+	g.profiles = profiles
+	if g.Profile == "" {
+		g.Profile = profiles.Selected
+	}
+
 	connectAddress := game.ServerAddress
 	if connectAddress == "" {
 		connectAddress = DefaultServerAddress
@@ -1132,25 +1186,85 @@ func (g *Game) initialize() {
 			return nil
 		})
 
+		var resumeButton *etk.Button
+		if saved, _ := loadOfflineMatch(); saved != nil && saved.Game != nil && saved.Game.Variant == bgammon.VariantBackgammon {
+			resumeButton = etk.NewButton(gotext.Get("Resume Offline Match"), g.resumeOffline)
+		}
+
+		var extraButtons []*etk.Button
+		if lanSupported {
+			extraButtons = append(extraButtons, etk.NewButton(gotext.Get("Host LAN Game"), g.hostLAN))
+
+			g.connectLAN = etk.NewSelect(g.itemHeight(), g.selectLANServer)
+			g.connectLAN.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+			g.connectLAN.AddOption(gotext.Get("None"))
+		}
+		extraButtons = append(extraButtons, etk.NewButton(gotext.Get("Watch Bots"), g.watchBots))
+		extraButtons = append(extraButtons, etk.NewButton(gotext.Get("Set Up Position"), g.editPosition))
+		if ReplayDir() != "" {
+			extraButtons = append(extraButtons, etk.NewButton(gotext.Get("Saved Replays"), g.showReplayLibrary))
+		}
+		if resumeButton != nil {
+			extraButtons = append(extraButtons, resumeButton)
+		}
+
+		showProfiles := profilesSupported
+
 		grid := etk.NewGrid()
 		grid.SetColumnPadding(int(g.board.horizontalBorderSize / 2))
 		grid.SetRowPadding(yPadding)
+		rowSizes := []int{fieldHeight, fieldHeight}
+		if showProfiles {
+			rowSizes = append(rowSizes, fieldHeight)
+		}
 		if ShowServerSettings {
-			grid.SetRowSizes(fieldHeight, fieldHeight, fieldHeight, etk.Scale(baseButtonHeight), etk.Scale(baseButtonHeight))
-		} else {
-			grid.SetRowSizes(fieldHeight, fieldHeight, etk.Scale(baseButtonHeight), etk.Scale(baseButtonHeight))
+			rowSizes = append(rowSizes, fieldHeight)
 		}
+		if lanSupported {
+			rowSizes = append(rowSizes, fieldHeight)
+		}
+		rowSizes = append(rowSizes, etk.Scale(baseButtonHeight), etk.Scale(baseButtonHeight))
+		rowSizes = append(rowSizes, etk.Scale(baseButtonHeight))
+		grid.SetRowSizes(rowSizes...)
 		grid.SetColumnSizes(xPadding, labelWidth, -1, -1, xPadding)
-		grid.AddChildAt(nameLabel, 1, 0, 2, 1)
-		grid.AddChildAt(g.connectUsername, 2, 0, 2, 1)
-		grid.AddChildAt(passwordLabel, 1, 1, 2, 1)
-		grid.AddChildAt(g.connectPassword, 2, 1, 2, 1)
-		g.connectGridY = 2
+		g.connectGridY = 0
+		if showProfiles {
+			profileLabel := newCenteredText(gotext.Get("Profile"))
+
+			g.connectProfile = etk.NewSelect(g.itemHeight(), g.selectProfile)
+			g.connectProfile.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+			g.connectProfile.AddOption(gotext.Get("None"))
+			for _, p := range g.profiles.Profiles {
+				g.connectProfile.AddOption(p.Name)
+			}
+
+			subGrid := etk.NewGrid()
+			subGrid.SetColumnSizes(-1, yPadding, -1)
+			subGrid.AddChildAt(etk.NewButton(gotext.Get("Save"), g.selectSaveProfile), 0, 0, 1, 1)
+			subGrid.AddChildAt(etk.NewButton(gotext.Get("Delete"), g.selectDeleteProfile), 2, 0, 1, 1)
+
+			grid.AddChildAt(profileLabel, 1, g.connectGridY, 2, 1)
+			grid.AddChildAt(g.connectProfile, 2, g.connectGridY, 1, 1)
+			grid.AddChildAt(subGrid, 3, g.connectGridY, 1, 1)
+			g.connectGridY++
+		}
+		grid.AddChildAt(nameLabel, 1, g.connectGridY, 2, 1)
+		grid.AddChildAt(g.connectUsername, 2, g.connectGridY, 2, 1)
+		g.connectGridY++
+		grid.AddChildAt(passwordLabel, 1, g.connectGridY, 2, 1)
+		grid.AddChildAt(g.connectPassword, 2, g.connectGridY, 2, 1)
+		g.connectGridY++
 		if ShowServerSettings {
 			grid.AddChildAt(serverLabel, 1, g.connectGridY, 2, 1)
 			grid.AddChildAt(g.connectServer, 2, g.connectGridY, 2, 1)
 			g.connectGridY++
 		}
+		if lanSupported {
+			lanLabel := newCenteredText(gotext.Get("LAN"))
+			grid.AddChildAt(lanLabel, 1, g.connectGridY, 2, 1)
+			grid.AddChildAt(g.connectLAN, 2, g.connectGridY, 2, 1)
+			g.connectGridY++
+		}
 		{
 			subGrid := etk.NewGrid()
 			subGrid.SetColumnSizes(-1, yPadding, -1)
@@ -1168,6 +1282,21 @@ func (g *Game) initialize() {
 			subGrid.AddChildAt(offlineButton, 2, 0, 1, 1)
 			grid.AddChildAt(subGrid, 1, g.connectGridY, 3, 1)
 		}
+		{
+			g.connectGridY++
+			subGrid := etk.NewGrid()
+			var columnSizes []int
+			for i, button := range extraButtons {
+				if i > 0 {
+					columnSizes = append(columnSizes, yPadding)
+				}
+				columnSizes = append(columnSizes, -1)
+				subGrid.AddChildAt(button, i*2, 0, 1, 1)
+			}
+			subGrid.SetColumnSizes(columnSizes...)
+			subGrid.SetRowSizes(-1, yPadding, -1)
+			grid.AddChildAt(subGrid, 1, g.connectGridY, 3, 1)
+		}
 		connectGrid = grid
 
 		{
@@ -1186,6 +1315,8 @@ func (g *Game) initialize() {
 			d.SetVisible(false)
 		}
 
+		g.createProfileDialogs()
+
 		{
 			header := gotext.Get("%s - Free Online Backgammon", "bgammon.org")
 			info := gotext.Get("To log in as a guest, enter a username (if you want) and do not enter a password.")
@@ -1193,6 +1324,16 @@ func (g *Game) initialize() {
 			connectFrame.SetPositionChildren(true)
 			connectFrame.AddChild(etk.NewFrame(g.aboutDialog))
 			connectFrame.AddChild(etk.NewFrame(g.quitDialog))
+			if g.connectProfile != nil {
+				// Draw the profile list above the other fields.
+				connectFrame.AddChild(etk.NewFrame(g.connectProfile.Children()...))
+				connectFrame.AddChild(etk.NewFrame(g.profileDialog))
+				connectFrame.AddChild(etk.NewFrame(g.profileDeleteDialog))
+			}
+			if g.connectLAN != nil {
+				// Draw the LAN server list above the other fields.
+				connectFrame.AddChild(etk.NewFrame(g.connectLAN.Children()...))
+			}
 		}
 	}
 
@@ -1258,6 +1399,29 @@ func (g *Game) initialize() {
 		tabulaGrid.AddChildAt(g.lobby.createGameTabulaCheckbox, 0, 0, 1, 1)
 		tabulaGrid.AddChildAt(tabulaLabel, 2, 0, 1, 1)
 
+		g.lobby.createGameHotSeatCheckbox = etk.NewCheckbox(nil)
+		g.lobby.createGameHotSeatCheckbox.SetBorderColor(triangleA)
+		g.lobby.createGameHotSeatCheckbox.SetCheckColor(triangleA)
+		g.lobby.createGameHotSeatCheckbox.SetSelected(false)
+
+		hotSeatCheckboxLabel := &ClickableText{
+			Text: newCenteredText(gotext.Get("Two players on this device")),
+			onSelected: func() {
+				g.lobby.createGameHotSeatCheckbox.SetSelected(!g.lobby.createGameHotSeatCheckbox.Selected())
+			},
+		}
+		hotSeatCheckboxLabel.SetVertical(etk.AlignCenter)
+
+		g.lobby.createGameHotSeatGrid = etk.NewGrid()
+		g.lobby.createGameHotSeatGrid.SetColumnSizes(fieldHeight, xPadding, -1)
+		g.lobby.createGameHotSeatGrid.SetRowSizes(fieldHeight, -1)
+		g.lobby.createGameHotSeatGrid.AddChildAt(g.lobby.createGameHotSeatCheckbox, 0, 0, 1, 1)
+		g.lobby.createGameHotSeatGrid.AddChildAt(hotSeatCheckboxLabel, 2, 0, 1, 1)
+		g.lobby.createGameHotSeatGrid.SetVisible(false)
+
+		g.lobby.createGameHotSeatLabel = newCenteredText(gotext.Get("Hot-seat"))
+		g.lobby.createGameHotSeatLabel.SetVisible(false)
+
 		variantPadding := 20
 		variantWidth := 400
 		if smallScreen {
@@ -1276,7 +1440,7 @@ func (g *Game) initialize() {
 
 		subGrid := etk.NewGrid()
 		subGrid.SetRowPadding(yPadding)
-		subGrid.SetRowSizes(fieldHeight, fieldHeight, fieldHeight, -1)
+		subGrid.SetRowSizes(fieldHeight, fieldHeight, fieldHeight, 0, -1)
 		subGrid.SetColumnSizes(xPadding, labelWidth, -1, xPadding)
 		subGrid.AddChildAt(nameLabel, 1, 0, 1, 1)
 		subGrid.AddChildAt(g.lobby.createGameName, 2, 0, 1, 1)
@@ -1284,8 +1448,11 @@ func (g *Game) initialize() {
 		subGrid.AddChildAt(g.lobby.createGamePoints, 2, 1, 1, 1)
 		subGrid.AddChildAt(passwordLabel, 1, 2, 1, 1)
 		subGrid.AddChildAt(g.lobby.createGamePassword, 2, 2, 1, 1)
-		subGrid.AddChildAt(variantFrame, 1, 3, 1, 1)
-		subGrid.AddChildAt(variantFlex, 2, 3, 1, 1)
+		subGrid.AddChildAt(g.lobby.createGameHotSeatLabel, 1, 3, 1, 1)
+		subGrid.AddChildAt(g.lobby.createGameHotSeatGrid, 2, 3, 1, 1)
+		subGrid.AddChildAt(variantFrame, 1, 4, 1, 1)
+		subGrid.AddChildAt(variantFlex, 2, 4, 1, 1)
+		g.lobby.createGameOptions = subGrid
 
 		subFrame := etk.NewFrame(subGrid)
 		subFrame.SetPositionChildren(true)
@@ -1479,10 +1646,18 @@ func (g *Game) initialize() {
 			d.SetVisible(false)
 		}
 
+		g.lobby.historyFormat = etk.NewSelect(g.itemHeight(), g.selectReplayFormat)
+		g.lobby.historyFormat.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+		for _, format := range replay.Formats {
+			g.lobby.historyFormat.AddOption(fmt.Sprintf("%s (%s)", format, format.Extension()))
+		}
+		g.lobby.historyFormat.SetSelectedItem(int(g.replayFormat))
+
 		pageControlGrid := etk.NewGrid()
 		pageControlGrid.AddChildAt(etk.NewButton("<- "+gotext.Get("Previous"), g.selectHistoryPrevious), 0, 0, 1, 1)
 		pageControlGrid.AddChildAt(g.lobby.historyPageButton, 1, 0, 1, 1)
 		pageControlGrid.AddChildAt(etk.NewButton(gotext.Get("Next")+" ->", g.selectHistoryNext), 2, 0, 1, 1)
+		pageControlGrid.AddChildAt(g.lobby.historyFormat, 3, 0, 1, 1)
 
 		historyRatingBackground := etk.NewBox()
 		historyRatingBackground.SetBackground(bufferBackgroundColor)
@@ -1512,6 +1687,7 @@ func (g *Game) initialize() {
 		historyFrame.SetPositionChildren(true)
 		historyFrame.AddChild(historyContainer)
 		historyFrame.AddChild(etk.NewFrame(g.lobby.historyPageDialog))
+		historyFrame.AddChild(etk.NewFrame(g.lobby.historyFormat.Children()...))
 
 		dividerA := etk.NewBox()
 		dividerA.SetBackground(bufferTextColor)
@@ -1581,16 +1757,34 @@ func (g *Game) initialize() {
 
 		g.lobby.historyButton = etk.NewButton(gotext.Get("History"), game.selectHistory)
 
+		g.lobby.botStrength = etk.NewSelect(g.itemHeight(), g.selectBotStrength)
+		g.lobby.botStrength.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+		for _, label := range botStrengthLabels() {
+			g.lobby.botStrength.AddOption(label)
+		}
+		g.lobby.botStrength.SetSelectedItem(int(botStrength.Load()))
+		g.lobby.botStrength.SetVisible(false)
+
+		g.lobby.connectionLabel = newCenteredText("")
+		g.lobby.connectionLabel.SetFollow(false)
+		g.lobby.connectionLabel.SetScrollBarVisible(false)
+		g.lobby.connectionLabel.SetSingleLine(true)
+		if smallScreen {
+			g.lobby.connectionLabel.SetFont(etk.Style.TextFont, etk.Scale(mediumFontSize))
+		}
+
 		indentA, indentB := etk.Scale(lobbyIndentA), etk.Scale(lobbyIndentB)
 
 		headerGrid := etk.NewGrid()
-		headerGrid.SetColumnSizes(indentA, indentB-indentA, indentB-indentA, -1, 200)
-		headerGrid.AddChildAt(backgroundBox, 0, 0, 5, 1)
+		headerGrid.SetColumnSizes(indentA, indentB-indentA, indentB-indentA, -1, 250, 200)
+		headerGrid.AddChildAt(backgroundBox, 0, 0, 6, 1)
 		headerGrid.AddChildAt(statusLabel, 0, 0, 1, 1)
 		headerGrid.AddChildAt(ratingLabel, 1, 0, 1, 1)
 		headerGrid.AddChildAt(pointsLabel, 2, 0, 1, 1)
 		headerGrid.AddChildAt(nameLabel, 3, 0, 1, 1)
-		headerGrid.AddChildAt(g.lobby.historyButton, 4, 0, 1, 1)
+		headerGrid.AddChildAt(g.lobby.connectionLabel, 4, 0, 1, 1)
+		headerGrid.AddChildAt(g.lobby.historyButton, 5, 0, 1, 1)
+		headerGrid.AddChildAt(g.lobby.botStrength, 5, 0, 1, 1)
 
 		listGamesContainer = etk.NewGrid()
 		listGamesContainer.AddChildAt(headerGrid, 0, 0, 1, 1)
@@ -1603,6 +1797,7 @@ func (g *Game) initialize() {
 		listGamesFrame.SetPositionChildren(true)
 		listGamesFrame.AddChild(listGamesContainer)
 		listGamesFrame.AddChild(g.tutorialFrame)
+		listGamesFrame.AddChild(etk.NewFrame(g.lobby.botStrength.Children()...))
 	}
 
 	statusBuffer.SetScrollBarColors(etk.Style.ScrollAreaColor, etk.Style.ScrollHandleColor)
@@ -1626,7 +1821,11 @@ func (g *Game) initialize() {
 
 	g.setRoot(connectFrame)
 
-	if g.savedUsername != "" {
+	if i := g.profiles.index(g.Profile); i != -1 && g.connectProfile != nil {
+		g.connectProfile.SetSelectedItem(i + 1)
+		g.selectProfile(i + 1)
+		etk.SetFocus(g.connectPassword)
+	} else if g.savedUsername != "" {
 		g.connectUsername.SetText(g.savedUsername)
 		g.connectPassword.SetText(g.savedPassword)
 		etk.SetFocus(g.connectPassword)
@@ -1656,7 +1855,7 @@ func (g *Game) initialize() {
 		go func() {
 			for {
 				if g.client.loggedIn {
-					g.client.Out <- []byte(fmt.Sprintf("j %d", g.JoinGame))
+					g.client.Send([]byte(fmt.Sprintf("j %d", g.JoinGame)))
 					break
 				}
 				time.Sleep(100 * time.Millisecond)
@@ -1665,21 +1864,42 @@ func (g *Game) initialize() {
 	}
 }
 
+func (g *Game) selectReplayFormat(index int) (accept bool) {
+	if index < 0 || index >= len(replay.Formats) {
+		return false
+	}
+	g.replayFormat = replay.Formats[index]
+	return true
+}
+
+func (g *Game) selectBotStrength(index int) (accept bool) {
+	SetBotStrength(int32(index))
+	return true
+}
+
 func (g *Game) playOffline() {
 	go hideKeyboard()
 	if g.loggedIn {
 		return
 	}
 
+	g.startLocalServer()
+
+	// Connect the player.
+	go g.ConnectLocal(<-g.localServer)
+}
+
+// startLocalServer starts the local bgammon server and connects the bots.
+func (g *Game) startLocalServer() {
 	if g.localServer == nil {
 		// Start the local BEI server.
 		beiServer := &tabula.BEIServer{
 			Verbose: true,
 		}
-		beiConns := beiServer.ListenLocal()
+		g.beiConns = beiServer.ListenLocal()
 
 		// Connect to the local BEI server.
-		beiClient := bot.NewLocalBEIClient(<-beiConns, false)
+		beiClient := bot.NewLocalBEIClient(weakenEngine(<-g.beiConns), false)
 
 		// Start the local bgammon server.
 		op := &server.Options{
@@ -1696,9 +1916,6 @@ func (g *Game) playOffline() {
 		// Wait for the bots to finish creating matches.
 		time.Sleep(250 * time.Millisecond)
 	}
-
-	// Connect the player.
-	go g.ConnectLocal(<-g.localServer)
 }
 
 func (g *Game) clearBuffers() {
@@ -1723,6 +1940,17 @@ func (g *Game) showMainMenu(clearBuffers bool) {
 	if g.client == nil {
 		return
 	}
+	if g.hotSeat != nil {
+		for _, c := range g.hotSeat.seats {
+			if c != nil && c != g.client {
+				c.Disconnect()
+			}
+		}
+		g.hotSeat = nil
+		g.board.passDeviceDialog.SetVisible(false)
+	}
+	g.stopBotMatch()
+	g.stopHostingLAN()
 	g.client.Disconnect()
 	g.client = nil
 
@@ -1754,6 +1982,7 @@ func (g *Game) showMainMenu(clearBuffers bool) {
 func (g *Game) handleUpdateTimeLabels() {
 	lastTimerHour, lastTimerMinute := -1, -1
 	lastClockHour, lastClockMinute := -1, -1
+	var lastLatency, lastStatus string
 
 	t := time.NewTicker(3 * time.Second)
 	var now time.Time
@@ -1792,6 +2021,26 @@ func (g *Game) handleUpdateTimeLabels() {
 			scheduleFrame()
 		}
 
+		// Update connection indicator.
+		var latency, status string
+		quality := connectionOffline
+		if g.client != nil && !g.client.local {
+			var rtt time.Duration
+			quality, rtt = g.client.latency.status()
+			latency, status = connectionLatencyText(quality, rtt), connectionStatusText(quality, rtt)
+		}
+		if latency != lastLatency || status != lastStatus {
+			c := connectionColor(quality)
+			g.board.latencyLabel.SetForeground(c)
+			g.board.latencyLabel.SetText(latency)
+			if g.lobby.connectionLabel != nil {
+				g.lobby.connectionLabel.SetForeground(c)
+				g.lobby.connectionLabel.SetText(status)
+			}
+			lastLatency, lastStatus = latency, status
+			scheduleFrame()
+		}
+
 		<-t.C
 	}
 }
@@ -1802,6 +2051,15 @@ func (g *Game) setRoot(w etk.Widget) {
 	}
 	displayFrame.Clear()
 	displayFrame.AddChild(w, g.keyboardFrame)
+
+	// Only discover servers on the local network while they may be selected.
+	if g.connectLAN != nil {
+		if w == connectFrame {
+			startLANDiscovery(g.updateLANServers)
+		} else {
+			stopLANDiscovery()
+		}
+	}
 }
 
 func (g *Game) setBufferRects() {
@@ -1842,7 +2100,7 @@ func (g *Game) handleAutoRefresh() {
 		}
 
 		if g.client != nil && g.client.Username != "" {
-			g.client.Out <- []byte("ls")
+			g.client.Send([]byte("ls"))
 			g.lastRefresh = time.Now()
 		}
 	}
@@ -1866,21 +2124,15 @@ func (g *Game) handleEvent(e interface{}) {
 			go saveCredentials(username, password)
 		}
 
-		clients := gotext.GetN("There is %d client", "There are %d clients", ev.Clients, ev.Clients)
-		matches := gotext.GetN("%d match", "%d matches", ev.Games, ev.Games)
-		msg := gotext.Get("Welcome, %[1]s. %[2]s playing %[3]s.", ev.PlayerName, clients, matches)
-		ls(fmt.Sprintf("*** " + msg))
+		ls(welcomeMessage(ev))
 
 		if strings.HasPrefix(g.client.Username, "Guest_") && g.savedUsername == "" && g.JoinGame == 0 {
 			g.tutorialFrame.AddChild(NewTutorialWidget())
 		}
 	case *bgammon.EventNotice:
-		if strings.HasPrefix(ev.Message, "Connection terminated") {
-			g.lastTermination = time.Now()
-		}
 		ls(fmt.Sprintf("*** %s", ev.Message))
 	case *bgammon.EventSay:
-		ls(fmt.Sprintf("<%s> %s", ev.Player, ev.Message))
+		ls(sayMessage(ev.Player, ev.Message))
 		playSoundEffect(effectSay)
 	case *bgammon.EventList:
 		g.lobby.setGameList(ev.Games)
@@ -1889,6 +2141,7 @@ func (g *Game) handleEvent(e interface{}) {
 		}
 	case *bgammon.EventFailedCreate:
 		g.lobby.createGamePending, g.lobby.createGameShown = false, false
+		g.hotSeat = nil
 		g.lobby.rebuildButtonsGrid()
 
 		ls("*** " + gotext.Get("Failed to create match: %s", ev.Reason))
@@ -1918,6 +2171,10 @@ func (g *Game) handleEvent(e interface{}) {
 		setViewBoard(true)
 
 		if ev.Player == g.client.Username {
+			if g.hotSeat != nil && g.hotSeat.seats[1] == nil {
+				g.startHotSeat(ev.GameID)
+			}
+			g.offlineUnsaved = false
 			gameBuffer.SetText("")
 			gameLogged = false
 			newGameLogMessage = true
@@ -1947,6 +2204,9 @@ func (g *Game) handleEvent(e interface{}) {
 		g.board.Unlock()
 		if ev.Player == g.client.Username {
 			setViewBoard(false)
+			g.endHotSeat()
+			g.stopBotMatch()
+			g.endPractice()
 		} else {
 			lg(gotext.Get("%s left the match.", ev.Player))
 			playSoundEffect(effectJoinLeave)
@@ -2000,19 +2260,7 @@ func (g *Game) handleEvent(e interface{}) {
 
 		if incomingGameLogRoll {
 			if g.board.gameState.Roll1 != 0 && g.board.gameState.Roll2 != 0 {
-				roll := formatRoll(g.board.gameState.Roll1, g.board.gameState.Roll2, g.board.gameState.Roll3)
-
-				var extra string
-				if g.board.gameState.Turn != 0 && len(g.board.gameState.Available) > 0 {
-					extra = ":"
-				}
-
-				name := g.board.gameState.Player1.Name
-				if game.board.gameState.Turn == 2 {
-					name = g.board.gameState.Player2.Name
-				}
-
-				lg(name + " " + roll + extra)
+				lg(rollLogMessage(g.board.gameState))
 				newGameLogMessage = false
 			}
 			incomingGameLogRoll = false
@@ -2020,15 +2268,7 @@ func (g *Game) handleEvent(e interface{}) {
 
 		if incomingGameLogMove {
 			if g.board.gameState.Roll1 != 0 && g.board.gameState.Roll2 != 0 {
-				name := g.board.gameState.Player1.Name
-				if game.board.gameState.Turn == 2 {
-					name = g.board.gameState.Player2.Name
-				}
-				var moves string
-				if len(g.board.gameState.Moves) > 0 {
-					moves = string(bgammon.FormatMoves(g.board.gameState.Moves))
-				}
-				msg := name + " " + formatRoll(g.board.gameState.Roll1, g.board.gameState.Roll2, g.board.gameState.Roll3) + ": " + moves
+				msg := moveLogMessage(g.board.gameState)
 				if !newGameLogMessage {
 					if lastGameLogTime == "" {
 						lastGameLogTime = time.Now().Format("[3:04]")
@@ -2043,11 +2283,17 @@ func (g *Game) handleEvent(e interface{}) {
 			incomingGameLogMove = false
 		}
 
-		if !g.board.gameState.Spectating && (g.board.gameState.Player1.Points >= g.board.gameState.Points || g.board.gameState.Player2.Points >= g.board.gameState.Points) {
+		if !g.board.gameState.Spectating && (g.board.gameState.Player1.Points >= g.board.gameState.Points || g.board.gameState.Player2.Points >= g.board.gameState.Points || (g.practice != nil && g.board.gameState.Winner != 0)) {
 			g.board.rematchButton.SetVisible(true)
 		}
 
 		setViewBoard(true)
+
+		g.checkHotSeat()
+		g.saveOfflineMatch()
+		if g.botMatch != nil && g.board.gameState.Spectating {
+			g.botMatch.start()
+		}
 	case *bgammon.EventRolled:
 		playSound := SoundEffect(-1)
 		g.board.Lock()
@@ -2133,32 +2379,19 @@ func (g *Game) handleEvent(e interface{}) {
 		}
 		g.board.Unlock()
 	case *bgammon.EventFailedMove:
-		g.client.Out <- []byte("board") // Refresh game state.
+		g.client.Send([]byte("board")) // Refresh game state.
 
-		var extra string
-		if ev.From != 0 || ev.To != 0 {
-			extra = " " + gotext.Get("from %s to %s", bgammon.FormatSpace(ev.From), bgammon.FormatSpace(ev.To))
+		for _, msg := range failedMoveMessages(ev, g.board.gameState.Available) {
+			ls(msg)
 		}
-		ls("*** " + gotext.Get("Failed to move checker%s: %s", extra, ev.Reason))
-		ls("*** " + gotext.Get("Legal moves: %s", bgammon.FormatMoves(g.board.gameState.Available)))
 	case *bgammon.EventFailedOk:
-		g.client.Out <- []byte("board") // Refresh game state.
+		g.client.Send([]byte("board")) // Refresh game state.
 		ls("*** " + gotext.Get("Failed to submit moves: %s", ev.Reason))
 	case *bgammon.EventWin:
 		g.board.Lock()
-		if ev.Resigned != "" {
-			lg(gotext.Get("%s resigned.", ev.Resigned))
-		}
-		var message string
-		if ev.Points <= 1 {
-			message = gotext.Get("%s wins!", ev.Player)
-		} else {
-			message = gotext.GetN("%[1]s wins %[2]d point!", "%[1]s wins %[2]d points!", int(ev.Points), ev.Player, ev.Points)
-		}
-		if ev.Rating != 0 {
-			message += fmt.Sprintf(" (+%d)", ev.Rating)
+		for _, msg := range winMessages(ev) {
+			lg(msg)
 		}
-		lg(message)
 		g.board.Unlock()
 	case *bgammon.EventSettings:
 		g.board.stateLock.Lock()
@@ -2170,7 +2403,7 @@ func (g *Game) handleEvent(e interface{}) {
 		}
 	case *bgammon.EventReplay:
 		if game.downloadReplay == ev.ID {
-			err := saveReplay(ev.ID, ev.Content)
+			err := saveReplay(ev.ID, ev.Content, game.downloadFormat)
 			if err != nil {
 				ls("*** " + gotext.Get("Failed to download replay: %s", err))
 			}
@@ -2275,7 +2508,7 @@ func (g *Game) handleEvent(e interface{}) {
 		}
 		scheduleFrame()
 	case *bgammon.EventPing:
-		g.client.Out <- []byte(fmt.Sprintf("pong %s", ev.Message))
+		g.client.Send([]byte(fmt.Sprintf("pong %s", ev.Message)))
 	default:
 		ls("*** " + gotext.Get("Warning: Received unknown event: %+v", ev))
 		ls("*** " + gotext.Get("You may need to upgrade your client."))
@@ -2287,6 +2520,14 @@ func (g *Game) handleEvents(c *Client) {
 		g.board.Lock()
 		g.Lock()
 		g.board.Unlock()
+		if c != g.client {
+			// Only events received by the client in control are displayed.
+			if g.hotSeat != nil {
+				g.hotSeat.handleInactiveEvent(c, e)
+			}
+			g.Unlock()
+			continue
+		}
 		g.handleEvent(e)
 		g.Unlock()
 	}
@@ -2302,18 +2543,28 @@ func (g *Game) Connect() {
 	ls("*** " + gotext.Get("Connecting..."))
 
 	g.lobby.historyButton.SetVisible(true)
+	g.lobby.botStrength.SetVisible(false)
 
 	g.setRoot(listGamesFrame)
 	etk.SetFocus(game.lobby.availableMatchesList)
 
 	address := g.ServerAddress
-	if address == "" {
+	if g.Playback != "" {
+		address = PlaybackAddress(g.Playback)
+	} else if address == "" {
 		address = DefaultServerAddress
 	}
 	g.client = newClient(address, g.Username, g.Password, false)
+	g.client.Email = g.Email
+	g.client.register = g.register
 	g.lobby.c = g.client
 	g.board.client = g.client
 
+	if g.Playback != "" {
+		// Recorded sessions are played back locally.
+		g.client.local = true
+	}
+
 	g.lobby.loaded = false
 
 	go g.handleEvents(g.client)
@@ -2354,6 +2605,7 @@ func (g *Game) ConnectLocal(conn net.Conn) {
 	ls("*** " + gotext.Get("Playing offline."))
 
 	g.lobby.historyButton.SetVisible(false)
+	g.lobby.botStrength.SetVisible(true)
 
 	g.setRoot(listGamesFrame)
 	etk.SetFocus(game.lobby.availableMatchesList)
@@ -2362,14 +2614,15 @@ func (g *Game) ConnectLocal(conn net.Conn) {
 	g.lobby.c = g.client
 	g.board.client = g.client
 
+	g.client.Transport = NewConnTransport(conn)
 	g.client.local = true
-	g.client.connecting = true
+	g.client.lanHost = g.lanListener != nil
 
 	g.lobby.loaded = false
 
 	go g.handleEvents(g.client)
 
-	go g.client.connectTCP(conn)
+	go g.client.Connect()
 }
 
 func (g *Game) selectRegister() error {
@@ -2444,10 +2697,118 @@ func (g *Game) selectConnect() error {
 	if ShowServerSettings {
 		g.ServerAddress = g.connectServer.Text()
 	}
+	if p := g.profiles.find(g.Profile); p != nil && g.connectProfile != nil {
+		updated := *p
+		updated.Address = g.ServerAddress
+		updated.Username = g.Username
+		if p.Password != "" {
+			updated.Password = g.Password
+		}
+		*p = updated
+		go func() {
+			err := SaveProfile(&updated)
+			if err != nil {
+				log.Printf("warning: %s", err)
+			}
+		}()
+	}
 	g.Connect()
 	return nil
 }
 
+// selectLANServer connects to the selected server on the local network.
+func (g *Game) selectLANServer(index int) (accept bool) {
+	if index < 0 || index > len(g.lanAddresses) {
+		return false
+	}
+	selected := g.ServerAddress
+	if ShowServerSettings {
+		selected = g.connectServer.Text()
+	}
+	var address string
+	if index == 0 {
+		if !g.isLANAddress(selected) {
+			return true
+		}
+		address = g.lanPreviousAddress
+	} else {
+		if !g.isLANAddress(selected) {
+			g.lanPreviousAddress = selected
+		}
+		address = g.lanAddresses[index-1]
+	}
+	g.ServerAddress = address
+	if ShowServerSettings {
+		g.connectServer.SetText(address)
+	}
+	return true
+}
+
+func (g *Game) isLANAddress(address string) bool {
+	for _, a := range g.lanAddresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// updateLANServers updates the list of servers discovered on the local network.
+func (g *Game) updateLANServers() {
+	servers := discoveredLANServers()
+
+	g.Lock()
+	defer g.Unlock()
+
+	selected := g.ServerAddress
+	if ShowServerSettings {
+		selected = g.connectServer.Text()
+	}
+	selectedIndex := 0
+	wasLAN := g.isLANAddress(selected)
+
+	g.lanAddresses = g.lanAddresses[:0]
+	g.connectLAN.Clear()
+	g.connectLAN.AddOption(gotext.Get("None"))
+	for i, server := range servers {
+		g.lanAddresses = append(g.lanAddresses, server.Address)
+		g.connectLAN.AddOption(server.Name)
+		if server.Address == selected {
+			selectedIndex = i + 1
+		}
+	}
+	g.connectLAN.SetSelectedItem(selectedIndex)
+	if wasLAN && selectedIndex == 0 {
+		// The selected server is no longer available.
+		g.ServerAddress = g.lanPreviousAddress
+		if ShowServerSettings {
+			g.connectServer.SetText(g.lanPreviousAddress)
+		}
+	}
+	scheduleFrame()
+}
+
+// selectProfile fills in the connect screen using the selected server profile.
+func (g *Game) selectProfile(index int) (accept bool) {
+	if index < 0 || index > len(g.profiles.Profiles) {
+		return false
+	} else if index == 0 {
+		g.Profile = ""
+		g.loadProfileLocale(nil)
+		return true
+	}
+	p := g.profiles.Profiles[index-1]
+	g.Profile = p.Name
+	if p.Address != "" {
+		g.ServerAddress = p.Address
+		g.connectServer.SetText(p.Address)
+	}
+	g.connectUsername.SetText(p.Username)
+	g.connectPassword.SetText(p.Password)
+	g.loadProfileLocale(p)
+	return true
+}
+
 func (g *Game) showAboutDialog() error {
 	g.aboutDialog.SetVisible(true)
 	return nil
@@ -2456,6 +2817,8 @@ func (g *Game) showAboutDialog() error {
 func (g *Game) closeDialogs() {
 	g.aboutDialog.SetVisible(false)
 	g.quitDialog.SetVisible(false)
+	g.profileDialog.SetVisible(false)
+	g.profileDeleteDialog.SetVisible(false)
 }
 
 func (g *Game) searchMatches(username string) {
@@ -2468,7 +2831,7 @@ func (g *Game) searchMatches(username string) {
 	g.lobby.historyList.Clear()
 	g.lobby.historyList.SetSelectionMode(etk.SelectNone)
 	g.lobby.historyList.AddChildAt(loadingText, 0, 0)
-	g.client.Out <- []byte(fmt.Sprintf("history %s", username))
+	g.client.Send([]byte(fmt.Sprintf("history %s", username)))
 }
 
 func (g *Game) viewHistory(search string) error {
@@ -2480,7 +2843,7 @@ func (g *Game) viewHistory(search string) error {
 	}
 	go hideKeyboard()
 	if len(g.lobby.achievementInfo) == 0 {
-		g.client.Out <- []byte("achievements")
+		g.client.Send([]byte("achievements"))
 	}
 	g.lobby.showHistory = true
 	g.setRoot(historyFrame)
@@ -2510,7 +2873,7 @@ func (g *Game) selectHistoryPrevious() error {
 	if g.lobby.historyUsername.Text() == "" || g.lobby.historyPage == 1 {
 		return nil
 	}
-	g.client.Out <- []byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), g.lobby.historyPage-1))
+	g.client.Send([]byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), g.lobby.historyPage-1)))
 	return nil
 }
 
@@ -2519,7 +2882,7 @@ func (g *Game) selectHistoryNext() error {
 	if g.lobby.historyUsername.Text() == "" || g.lobby.historyPage == g.lobby.historyPages {
 		return nil
 	}
-	g.client.Out <- []byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), g.lobby.historyPage+1))
+	g.client.Send([]byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), g.lobby.historyPage+1)))
 	return nil
 }
 
@@ -2540,7 +2903,7 @@ func (g *Game) confirmHistoryPage(text string) bool {
 	} else if page > g.lobby.historyPages {
 		page = g.lobby.historyPages
 	}
-	g.client.Out <- []byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), page))
+	g.client.Send([]byte(fmt.Sprintf("history %s %d", g.lobby.historyUsername.Text(), page)))
 	return true
 }
 
@@ -2558,6 +2921,10 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 	}
 
 	if !g.loggedIn {
+		if g.replayLibrary != nil && g.rootWidget == g.replayLibrary.frame {
+			g.replayLibrary.handleKeys(keys)
+			return nil
+		}
 		for _, key := range keys {
 			switch key {
 			case ebiten.KeyTab:
@@ -2599,6 +2966,12 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 					g.aboutDialog.SetVisible(false)
 					g.ignoreEnter = true
 					return nil
+				} else if g.profileDialog.Visible() {
+					g.confirmSaveProfile()
+					return nil
+				} else if g.profileDeleteDialog.Visible() {
+					g.confirmDeleteProfile()
+					return nil
 				} else if g.showRegister {
 					g.selectConfirmRegister()
 					return nil
@@ -2616,6 +2989,10 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 				if g.aboutDialog.Visible() {
 					g.aboutDialog.SetVisible(false)
 					return nil
+				} else if g.profileDialog.Visible() || g.profileDeleteDialog.Visible() {
+					g.profileDialog.SetVisible(false)
+					g.profileDeleteDialog.SetVisible(false)
+					return nil
 				} else if g.showRegister || g.showReset {
 					g.selectCancel()
 					return nil
@@ -2653,6 +3030,9 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 				} else if g.board.leaveMatchDialog.Visible() {
 					g.board.leaveMatchDialog.SetVisible(false)
 					return nil
+				} else if g.board.exportGIFDialog.Visible() {
+					g.board.exportGIFDialog.SetVisible(false)
+					return nil
 				} else {
 					g.board.menuGrid.SetVisible(true)
 					return nil
@@ -2738,6 +3118,34 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 		}
 	}
 
+	if viewBoard && g.replay && !g.board.menuGrid.Visible() && !g.board.settingsDialog.Visible() && !g.board.leaveMatchDialog.Visible() {
+		for _, key := range keys {
+			switch key {
+			case ebiten.KeyLeft:
+				g.board.selectReplayStepBack()
+				return nil
+			case ebiten.KeyRight:
+				g.board.selectReplayStepForward()
+				return nil
+			case ebiten.KeyUp, ebiten.KeyPageUp:
+				g.board.selectReplayJumpBack()
+				return nil
+			case ebiten.KeyDown, ebiten.KeyPageDown:
+				g.board.selectReplayJumpForward()
+				return nil
+			case ebiten.KeyHome:
+				g.board.selectReplayStart()
+				return nil
+			case ebiten.KeyEnd:
+				g.board.selectReplayEnd()
+				return nil
+			case ebiten.KeySpace:
+				g.board.selectReplayPause()
+				return nil
+			}
+		}
+	}
+
 	if viewBoard {
 		for _, key := range keys {
 			switch key {
@@ -2752,6 +3160,19 @@ func (g *Game) handleInput(keys []ebiten.Key) error {
 						etk.SetFocus(g.board.changePasswordOld)
 						return nil
 					}
+				} else if g.board.exportGIFDialog.Visible() {
+					focusedWidget := etk.Focused()
+					switch focusedWidget {
+					case g.board.exportGIFWidth:
+						etk.SetFocus(g.board.exportGIFHeight)
+						return nil
+					case g.board.exportGIFHeight:
+						etk.SetFocus(g.board.exportGIFDelay)
+						return nil
+					case g.board.exportGIFDelay:
+						etk.SetFocus(g.board.exportGIFWidth)
+						return nil
+					}
 				}
 			case ebiten.KeyBackspace:
 				if len(inputBuffer.Text()) == 0 && !g.board.gameState.Spectating && g.board.gameState.Turn == g.board.gameState.PlayerNumber && len(g.board.gameState.Moves) > 0 && !g.board.menuGrid.Visible() && !g.board.settingsDialog.Visible() && !g.board.changePasswordDialog.Visible() && !g.board.leaveMatchDialog.Visible() {
@@ -2830,7 +3251,7 @@ func (g *Game) Update() error {
 		g.loaded = true
 
 		// Auto-connect
-		if g.Username != "" || g.Password != "" {
+		if g.Username != "" || g.Password != "" || g.Playback != "" {
 			g.Connect()
 		}
 	}
@@ -2864,6 +3285,8 @@ func (g *Game) Update() error {
 		}
 	}
 
+	g.updateReplayAnalysis()
+
 	err = etk.Update()
 	if err != nil {
 		return err
@@ -2939,10 +3362,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 				} else if game.lobby.createGameTabulaCheckbox.Selected() {
 					variant = bgammon.VariantTabula
 				}
-				g.lobby.c.Out <- []byte(fmt.Sprintf("c %s %d %d %s", typeAndPassword, points, variant, game.lobby.createGameName.Text()))
+				if g.lobby.c.local && (!g.lobby.c.lanHost || g.lobby.createGameHotSeatCheckbox.Selected()) {
+					// Offline matches are played by two players on the same device,
+					// unless the match is hosted for clients on the local network.
+					g.hotSeat = &hotSeat{
+						seats:    [2]*Client{g.lobby.c},
+						password: hotSeatPassword(),
+					}
+					typeAndPassword = fmt.Sprintf("private %s", g.hotSeat.password)
+				}
+				g.lobby.c.Send([]byte(fmt.Sprintf("c %s %d %d %s", typeAndPassword, points, variant, game.lobby.createGameName.Text())))
 				g.lobby.createGameShown = true
 			} else if g.lobby.joiningGameID != 0 && !g.lobby.joiningGameShown {
-				g.lobby.c.Out <- []byte(fmt.Sprintf("j %d %s", g.lobby.joiningGameID, g.lobby.joiningGamePassword))
+				g.lobby.c.Send([]byte(fmt.Sprintf("j %d %s", g.lobby.joiningGameID, g.lobby.joiningGamePassword)))
 				g.lobby.joiningGameShown = true
 			}
 		}
@@ -3026,6 +3458,31 @@ func (g *Game) layoutConnect() {
 			y = 0
 		}
 		g.quitDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
+		g.profileDeleteDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
+	}
+
+	{
+		dialogWidth := etk.Scale(620)
+		if dialogWidth > game.screenW {
+			dialogWidth = game.screenW
+		}
+		dialogHeight := 72 + (fieldHeight+20)*3 + etk.Scale(baseButtonHeight)
+		if dialogHeight > game.screenH {
+			dialogHeight = game.screenH
+		}
+
+		x, y := game.screenW/2-dialogWidth/2, game.screenH/2-dialogHeight/2
+		if x < 0 {
+			x = 0
+		}
+		if y < 0 {
+			y = 0
+		}
+		g.profileDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
+	}
+
+	if g.replayLibrary != nil {
+		g.replayLibrary.layout()
 	}
 }
 
@@ -3163,16 +3620,27 @@ func acceptInput(text string) (handled bool) {
 
 	if text[0] == '/' {
 		text = text[1:]
-		if strings.ToLower(text) == "download" {
+		split := strings.Fields(strings.ToLower(text))
+		if len(split) > 0 && split[0] == "download" {
+			format := game.replayFormat
+			if len(split) > 1 {
+				var err error
+				format, err = replay.ParseFormat(split[1])
+				if err != nil {
+					ls("*** " + gotext.Get("Failed to download replay: %s", err))
+					return true
+				}
+			}
 			if game.replay {
-				err := saveReplay(-1, game.replayData)
+				err := saveReplay(-1, game.replayData, format)
 				if err != nil {
 					ls("*** " + gotext.Get("Failed to download replay: %s", err))
 				}
 			} else {
 				if game.downloadReplay == 0 {
 					game.downloadReplay = -1
-					game.client.Out <- []byte("replay")
+					game.downloadFormat = format
+					game.client.Send([]byte("replay"))
 				} else {
 					ls("*** " + gotext.Get("Replay download already in progress."))
 				}
@@ -3184,7 +3652,7 @@ func acceptInput(text string) (handled bool) {
 		text = "say " + text
 	}
 
-	game.client.Out <- []byte(text)
+	game.client.Send([]byte(text))
 	go hideKeyboard()
 	return true
 }
@@ -3365,6 +3833,9 @@ func LoadLocale(forceLanguage string) error {
 	useLanguage, index, _ := language.NewMatcher(availableTags).Match(preferred...)
 	useLanguageCode := useLanguage.String()
 	if index <= 0 || useLanguageCode == "" {
+		// Revert to English when a locale was previously loaded.
+		AppLanguage = "en"
+		gotext.GetStorage().AddTranslator("boxcars", gotext.NewPo())
 		return nil
 	}
 	useLanguageName := availableNames[index]
@@ -3494,14 +3965,12 @@ func centerNumericInput(input *NumericInput) {
 	input.SetPadding(etk.Scale(5))
 }
 
-func saveReplay(id int, content []byte) error {
-	if id <= 0 {
-		return nil
-	}
-
+func saveReplay(id int, content []byte, format replay.Format) error {
 	replayDir := ReplayDir()
 	if replayDir == "" {
-		ls(fmt.Sprintf("*** %s https://bgammon.org/match/%d", gotext.Get("To download this replay visit"), id))
+		if id > 0 {
+			ls(fmt.Sprintf("*** %s https://bgammon.org/match/%d", gotext.Get("To download this replay visit"), id))
+		}
 		return nil
 	}
 
@@ -3532,9 +4001,14 @@ func saveReplay(id int, content []byte) error {
 		}
 	}
 
+	converted, err := replay.Convert(content, format)
+	if err != nil {
+		return err
+	}
+
 	_ = os.MkdirAll(replayDir, 0700)
-	filePath := path.Join(replayDir, fmt.Sprintf("%d_%s_%s.match", timestamp, player1, player2))
-	err = os.WriteFile(filePath, content, 0600)
+	filePath := path.Join(replayDir, fmt.Sprintf("%d_%s_%s%s", timestamp, player1, player2, format.Extension()))
+	err = os.WriteFile(filePath, converted, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to write replay to %s: %s", filePath, err)
 	}
@@ -3638,7 +4112,7 @@ func (w *achievementWidget) Cursor() ebiten.CursorShapeType {
 
 func (w *achievementWidget) HandleMouse(cursor image.Point, pressed bool, clicked bool) (handled bool, err error) {
 	if clicked && w.replay > 0 {
-		game.client.Out <- []byte(fmt.Sprintf("replay %d", w.replay))
+		game.client.Send([]byte(fmt.Sprintf("replay %d", w.replay)))
 	}
 	return true, nil
 }
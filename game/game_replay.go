@@ -1,335 +1,110 @@
 package game
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/replay"
 	"codeberg.org/tslocum/etk"
 	"codeberg.org/tslocum/gotext"
 )
 
 type replayFrame struct {
-	Game  *bgammon.Game
-	Event []byte
-}
+	Game     *bgammon.Game
+	Record   replay.Record // Record which follows the frame.
+	Analysis *moveAnalysis // Analysis of the move played, when the record is a roll.
 
-func (g *Game) _handleReplay(gs *bgammon.GameState, line []byte, lineNumber int, sendEvent bool, haveLock bool) bool {
-	if !haveLock {
-		g.Lock()
-		defer g.Unlock()
-	}
+	gameStart     bool // Whether the frame is the first frame of a game.
+	moveLabel     *etk.Text
+	analysisLabel *etk.Text
+}
 
+// playReplayRecord sends the events which correspond to a replay record and
+// applies the record to the game state.
+func (g *Game) playReplayRecord(gs *bgammon.GameState, record replay.Record) bool {
 	if !g.replay {
 		return false
 	}
 
-	split := bytes.Split(line, []byte(" "))
-	if len(split) < 2 {
-		log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-		return false
-	}
-	switch {
-	case bytes.Equal(split[0], []byte("bgammon-replay")):
-		return true
-	case bytes.Equal(split[0], []byte("i")):
-		if len(split) < 10 {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
-		}
-
-		if sendEvent {
-			ev := &bgammon.EventJoined{
-				GameID: 1,
-			}
-			ev.PlayerNumber = 1
-			ev.Player = game.client.Username
-			g.client.Events <- ev
-		}
-
-		variant, err := strconv.Atoi(string(split[9]))
-		if err != nil || variant < 0 || variant > 2 {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
+	sendBoard := func() {
+		ev := &bgammon.EventBoard{
+			GameState: bgammon.GameState{
+				Game:         gs.Game.Copy(true),
+				PlayerNumber: 1,
+				Available:    gs.Available,
+				Spectating:   true,
+			},
 		}
-
-		*gs = bgammon.GameState{
-			Game:         bgammon.NewGame(int8(variant)),
-			PlayerNumber: 1,
-			Spectating:   true,
+		g.client.Events <- ev
+	}
+	playerName := func(player int8) string {
+		if player == 2 {
+			return gs.Player2.Name
 		}
-		gs.Turn = 0
-
-		gs.Player1.Name, gs.Player2.Name = string(split[2]), string(split[3])
+		return gs.Player1.Name
+	}
 
-		points, err := strconv.Atoi(string(split[4]))
-		if err != nil || gs.Points < 1 {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
+	switch r := record.(type) {
+	case *replay.Double:
+		resultText := gotext.Get("%s accepts.", playerName(3-r.Player))
+		if !r.Accepted {
+			resultText = gotext.Get("%s declines.", playerName(3-r.Player))
 		}
-		gs.Points = int8(points)
-
-		points, err = strconv.Atoi(string(split[5]))
-		if err != nil || gs.Player1.Points < 0 {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
+		ls(fmt.Sprintf("*** %s %s", gotext.GetN("%s offers a double (%d point).", "%s offers a double (%d points).", int(r.Value), playerName(r.Player), r.Value), resultText))
+	case *replay.Roll:
+		if gs.Turn == 0 {
+			gs.Turn = r.Player
+			gs.Available = nil
+			gs.Moves = nil
+			sendBoard()
 		}
-		gs.Player1.Points = int8(points)
 
-		points, err = strconv.Atoi(string(split[6]))
-		if err != nil || gs.Player1.Points < 0 {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
+		ev := &bgammon.EventRolled{
+			Roll1: r.Roll1,
+			Roll2: r.Roll2,
+			Roll3: r.Roll3,
 		}
-		gs.Player2.Points = int8(points)
-
-		if sendEvent {
-			ev := &bgammon.EventBoard{
-				GameState: bgammon.GameState{
-					Game:         gs.Game.Copy(true),
-					PlayerNumber: 1,
-					Available:    gs.Available,
-					Spectating:   true,
-				},
+		ev.Player = playerName(r.Player)
+		g.client.Events <- ev
+
+		roll := *r
+		roll.Moves = nil
+		roll.Apply(gs.Game)
+		gs.Available = gs.LegalMoves(true)
+		sendBoard()
+
+		for _, move := range r.Moves {
+			ev := &bgammon.EventMoved{
+				Moves: [][]int8{move},
 			}
+			ev.Player = playerName(r.Player)
 			g.client.Events <- ev
 		}
+	case *replay.Resign:
+		ev := &bgammon.EventWin{}
+		ev.Player = playerName(3 - r.Player)
+		ev.Resigned = playerName(r.Player)
+		g.client.Events <- ev
+		return true
+	}
 
-		timestamp, err := strconv.ParseInt(string(split[1]), 10, 64)
-		if err != nil {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
-		}
-		gs.Started = timestamp
-		gs.Ended = gs.Started
-	case bytes.Equal(split[0], []byte("1")), bytes.Equal(split[0], []byte("2")):
-		if len(split) < 2 || (!bytes.Equal(split[1], []byte("t")) && len(split) < 3) {
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
-		}
-		var player int8 = 1
-		if bytes.Equal(split[0], []byte("2")) {
-			player = 2
-		}
-		for i := range split {
-			split[i] = bytes.ReplaceAll(split[i], []byte(","), nil)
-		}
-		switch {
-		case bytes.Equal(split[1], []byte("d")):
-			if len(split) < 4 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			doubleValue, err := strconv.Atoi(string(split[2]))
-			if err != nil || doubleValue < 2 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			resultValue, err := strconv.Atoi(string(split[3]))
-			if err != nil || resultValue < 0 || resultValue > 1 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			resultText := "accepts"
-			if resultValue == 0 {
-				resultText = "declines"
-			}
-			ls(fmt.Sprintf("*** %s offers a double (%d points). %s %s.", gs.Player1.Name, doubleValue, gs.Player2.Name, resultText))
-		case bytes.Equal(split[1], []byte("r")):
-			rollSplit := bytes.Split(split[2], []byte("-"))
-			if len(rollSplit) < 2 || len(rollSplit[0]) != 1 || len(rollSplit[1]) != 1 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			r1, err := strconv.Atoi(string(rollSplit[0]))
-			if err != nil || r1 < 1 || r1 > 6 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			r2, err := strconv.Atoi(string(rollSplit[1]))
-			if err != nil || r2 < 1 || r2 > 6 {
-				log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-				return false
-			}
-			var r3 int
-			if len(rollSplit) > 2 {
-				r3, err = strconv.Atoi(string(rollSplit[2]))
-				if err != nil || r3 < 1 || r3 > 6 {
-					log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-					return false
-				}
-			}
-
-			gs.Moves = nil
-			if gs.Turn == 0 {
-				gs.Turn = player
-				gs.Available = nil
-				gs.Moves = nil
-				if sendEvent {
-					ev := &bgammon.EventBoard{
-						GameState: bgammon.GameState{
-							Game:         gs.Game.Copy(true),
-							PlayerNumber: 1,
-							Available:    gs.Available,
-							Spectating:   true,
-						},
-					}
-					g.client.Events <- ev
-				}
-			}
-
-			playerName := gs.Player1.Name
-			if player == 2 {
-				playerName = gs.Player2.Name
-			}
-
-			if sendEvent {
-				ev := &bgammon.EventRolled{
-					Roll1: int8(r1),
-					Roll2: int8(r2),
-					Roll3: int8(r3),
-				}
-				ev.Player = playerName
-				g.client.Events <- ev
-			}
-
-			gs.Roll1, gs.Roll2, gs.Roll3 = int8(r1), int8(r2), int8(r3)
-			gs.Turn = player
-			gs.Available = gs.LegalMoves(true)
-			gs.Moves = nil
-
-			if sendEvent {
-				ev := &bgammon.EventBoard{
-					GameState: bgammon.GameState{
-						Game:         gs.Game.Copy(true),
-						PlayerNumber: 1,
-						Available:    gs.Available,
-						Spectating:   true,
-					},
-				}
-				g.client.Events <- ev
-			}
-
-			if len(split) == 3 {
-				return true
-			}
-			for _, move := range split[3:] {
-				moveSplit := bytes.Split(move, []byte("/"))
-				if len(moveSplit) != 2 || len(moveSplit[0]) > 3 || len(moveSplit[1]) > 3 {
-					log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-					return false
-				}
-				from, to := bgammon.ParseSpace(string(moveSplit[0])), bgammon.ParseSpace(string(moveSplit[1]))
-				if from < 0 || to < 0 || from == to {
-					log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-					return false
-				} else if from == bgammon.SpaceBarPlayer && player == 2 {
-					from = bgammon.SpaceBarOpponent
-				} else if from == bgammon.SpaceHomePlayer && player == 2 {
-					from = bgammon.SpaceHomeOpponent
-				}
-				if to == bgammon.SpaceHomePlayer && player == 2 {
-					to = bgammon.SpaceHomeOpponent
-				}
-				if sendEvent {
-					ev := &bgammon.EventMoved{
-						Moves: [][]int8{{from, to}},
-					}
-					ev.Player = playerName
-					g.client.Events <- ev
-				}
-				ok, _ := gs.AddMoves([][]int8{{from, to}}, false)
-				if !ok {
-					log.Panicf("failed to move checkers during replay from %d to %d", from, to)
-				}
-			}
-
-			if gs.Winner != 0 {
-				playerBar := bgammon.SpaceBarPlayer
-				opponentHome := bgammon.SpaceHomeOpponent
-				var opponent int8 = 2
-				if player == 2 {
-					playerBar = bgammon.SpaceBarOpponent
-					opponentHome = bgammon.SpaceHomePlayer
-					opponent = 1
-				}
-
-				backgammon := bgammon.PlayerCheckers(gs.Board[playerBar], opponent) != 0
-				if !backgammon {
-					homeStart, homeEnd := bgammon.HomeRange(gs.Winner, gs.Variant)
-					bgammon.IterateSpaces(homeStart, homeEnd, gs.Variant, func(space int8, spaceCount int8) {
-						if bgammon.PlayerCheckers(gs.Board[space], opponent) != 0 {
-							backgammon = true
-						}
-					})
-				}
-
-				var winPoints int8
-				switch gs.Variant {
-				case bgammon.VariantBackgammon:
-					if backgammon {
-						winPoints = 3 // Award backgammon.
-					} else if gs.Board[opponentHome] == 0 {
-						winPoints = 2 // Award gammon.
-					} else {
-						winPoints = 1
-					}
-				case bgammon.VariantAceyDeucey:
-					for space := int8(0); space < bgammon.BoardSpaces; space++ {
-						if (space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent) && ((opponent == 1 && gs.Player1.Entered) || (opponent == 2 && gs.Player2.Entered)) {
-							continue
-						}
-						winPoints += bgammon.PlayerCheckers(gs.Board[space], opponent)
-					}
-				case bgammon.VariantTabula:
-					winPoints = 1
-				}
-
-				if sendEvent {
-					ev := &bgammon.EventWin{
-						Points: winPoints * gs.DoubleValue,
-					}
-					ev.Player = playerName
-					g.client.Events <- ev
-				}
-			}
+	err := record.Apply(gs.Game)
+	if err != nil {
+		log.Printf("warning: failed to read replay: %s", err)
+		return false
+	}
 
-			if sendEvent {
-				ev := &bgammon.EventBoard{
-					GameState: bgammon.GameState{
-						Game:         gs.Game.Copy(true),
-						PlayerNumber: 1,
-						Available:    gs.Available,
-						Spectating:   true,
-					},
-				}
-				g.client.Events <- ev
-			}
-		case bytes.Equal(split[1], []byte("t")):
-			if !sendEvent {
-				return true
-			}
-			winPlayer := gs.Player2.Name
-			resignPlayer := gs.Player1.Name
-			if player == 2 {
-				winPlayer, resignPlayer = resignPlayer, winPlayer
-			}
-			ev := &bgammon.EventWin{}
-			ev.Player = winPlayer
-			ev.Resigned = resignPlayer
-			g.client.Events <- ev
-		default:
-			log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-			return false
+	if r, ok := record.(*replay.Roll); ok && gs.Winner != 0 {
+		ev := &bgammon.EventWin{
+			Points: replay.WinPoints(gs.Game, gs.Winner) * gs.DoubleValue,
 		}
-	default:
-		log.Printf("warning: failed to read replay: failed to parse line %d", lineNumber)
-		return false
+		ev.Player = playerName(r.Player)
+		g.client.Events <- ev
 	}
+	sendBoard()
 	return true
 }
 
@@ -361,10 +136,18 @@ func (g *Game) showReplayFrame(replayFrame int, showInfo bool) {
 
 	if replayFrame == 0 && showInfo {
 		ls(fmt.Sprintf("*** "+gotext.Get("Replaying %s vs. %s", "%s", "%s")+" (%s)", frame.Game.Player2.Name, frame.Game.Player1.Name, time.Unix(frame.Game.Started, 0).Format("2006-01-02 15:04")))
+	} else if showInfo {
+		g.replayFrames[replayFrame-1].showAnalysis()
 	}
 }
 
-func (g *Game) HandleReplay(replay []byte) {
+func (g *Game) HandleReplay(data []byte) {
+	data, err := replay.Import(data)
+	if err != nil {
+		ls("*** " + gotext.Get("Failed to open replay: %s", err))
+		return
+	}
+
 	g.Lock()
 	if g.replay {
 		g.Unlock()
@@ -373,9 +156,20 @@ func (g *Game) HandleReplay(replay []byte) {
 	g.replay = true
 	g.replayFrame = 0
 	g.replayFrames = g.replayFrames[:0]
-	g.replayData = replay
+	g.replayData = data
 	g.Unlock()
 
+	// failed stops replaying when the replay may not be shown.
+	failed := func(reason string) {
+		ls("*** " + gotext.Get("Failed to open replay: %s", reason))
+
+		g.Lock()
+		g.replay = false
+		g.replayFrames = g.replayFrames[:0]
+		g.replayData = nil
+		g.Unlock()
+	}
+
 	g.board.rematchButton.SetVisible(false)
 
 	if !g.loggedIn {
@@ -383,6 +177,12 @@ func (g *Game) HandleReplay(replay []byte) {
 		time.Sleep(500 * time.Millisecond)
 	}
 
+	match, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		failed(err.Error())
+		return
+	}
+
 	gs := &bgammon.GameState{
 		Game:         bgammon.NewGame(bgammon.VariantBackgammon),
 		PlayerNumber: 1,
@@ -391,105 +191,167 @@ func (g *Game) HandleReplay(replay []byte) {
 
 	g.board.replayList.Clear()
 	var listY int
-
-	var lineNumber int
-	scanner := bufio.NewScanner(bytes.NewReader(replay))
-	for scanner.Scan() {
-		if !bytes.HasPrefix(scanner.Bytes(), []byte("bgammon-reply")) && !bytes.HasPrefix(scanner.Bytes(), []byte("i ")) {
-			g.replayFrames = append(g.replayFrames, &replayFrame{
-				Game:  gs.Game.Copy(true),
-				Event: scanner.Bytes(),
-			})
+	var rowUsed bool // Whether player 2 has acted in the current row.
+	endRow := func() {
+		if rowUsed {
+			listY++
+			rowUsed = false
 		}
-		lineNumber++
-		if !g._handleReplay(gs, scanner.Bytes(), lineNumber, false, false) {
-			return
+	}
+	addRow := func(frame int, text1 string, text2 string) {
+		endRow()
+		for i, text := range [2]string{text1, text2} {
+			if text == "" {
+				continue
+			}
+			btn := g.replayListButton(frame)
+			btn.AddChild(&etk.WithoutMouse{Widget: newReplayListText(text)})
+			g.board.replayList.AddChildAt(btn, replayListColumn(int8(i+1)), listY)
 		}
+		listY++
+	}
 
-		if bytes.HasPrefix(scanner.Bytes(), []byte("1 r ")) || bytes.HasPrefix(scanner.Bytes(), []byte("2 r ")) {
-			player := 1
-			if bytes.HasPrefix(scanner.Bytes(), []byte("2")) {
-				player = 2
+	for i, matchGame := range match.Games {
+		matchGame.Header.Apply(gs.Game)
+		h := matchGame.Header
+		if h.Points > 1 && len(matchGame.Records) != 0 {
+			addRow(len(g.replayFrames), gotext.Get("Score: %d", h.Score1), gotext.Get("Score: %d", h.Score2))
+		}
+		for j, record := range matchGame.Records {
+			g.replayFrames = append(g.replayFrames, &replayFrame{
+				Game:      gs.Game.Copy(true),
+				Record:    record,
+				gameStart: j == 0,
+			})
+			err := record.Apply(gs.Game)
+			if err != nil {
+				failed(err.Error())
+				return
 			}
+			frame := len(g.replayFrames)
 
-			label := scanner.Bytes()[4:]
-			split := bytes.SplitN(label, []byte(" "), 2)
-			var roll []byte
-			var move []byte
-			l := len(split)
-			if l > 0 {
-				roll = split[0]
-				if l == 2 {
-					move = split[1]
+			switch r := record.(type) {
+			case *replay.Double:
+				response := gotext.Get("Takes")
+				if !r.Accepted {
+					response = gotext.Get("Drops")
+				}
+				text1, text2 := gotext.Get("Doubles to %d", r.Value), response
+				if r.Player == 2 {
+					text1, text2 = text2, text1
 				}
+				addRow(frame, text1, text2)
+				continue
+			case *replay.Resign:
+				text1, text2 := gotext.Get("Resigns"), ""
+				if r.Player == 2 {
+					text1, text2 = text2, text1
+				}
+				addRow(frame, text1, text2)
+				continue
 			}
 
-			var mv []byte
-			var last byte
-			for _, r := range move {
-				if r == ' ' && last != ',' {
-					mv = append(mv, []byte(", ")...)
-				} else {
-					mv = append(mv, r)
-				}
-				last = r
+			roll, ok := record.(*replay.Roll)
+			if !ok {
+				continue
+			}
+			player := roll.Player
+			mv := bgammon.FormatMoves(roll.Moves)
+			if len(roll.Moves) == 0 {
+				mv = nil
 			}
 
-			var x int
-			if player == 1 {
-				x = 1
+			if player == 2 {
+				endRow()
 			}
-			frame := len(g.replayFrames)
-			btn := etk.NewButton("", func() error {
-				if !game.board.replayAuto.IsZero() {
-					game.board.replayAuto = time.Time{}
-					game.board.replayPauseButton.SetText("▶")
-				}
-				g.showReplayFrame(frame, true)
-				return nil
-			})
+			rollFrame := g.replayFrames[len(g.replayFrames)-1]
+			btn := g.replayListButton(frame)
 			rollWidth := 50
 			if gs.Variant == bgammon.VariantTabula {
 				rollWidth = 75
 			}
 			grid := etk.NewGrid()
-			grid.SetColumnSizes(etk.Scale(rollWidth), -1)
-			rollLabel := etk.NewText(string(roll))
-			rollLabel.SetPadding(etk.Scale(etk.Style.ButtonBorderSize + 2))
-			rollLabel.SetVertical(etk.AlignCenter)
-			rollLabel.SetAutoResize(true)
-			rollLabel.SetForeground(etk.Style.ButtonTextColor)
-			moveLabel := etk.NewText(string(mv))
-			moveLabel.SetPadding(etk.Scale(etk.Style.ButtonBorderSize + 2))
-			moveLabel.SetVertical(etk.AlignCenter)
-			moveLabel.SetAutoResize(true)
-			moveLabel.SetForeground(etk.Style.ButtonTextColor)
+			grid.SetColumnSizes(etk.Scale(rollWidth), -1, etk.Scale(75))
+			rollLabel := newReplayListText(roll.Dice())
+			moveLabel := newReplayListText(string(mv))
+			analysisLabel := newReplayListText("")
 			grid.AddChildAt(&etk.WithoutMouse{Widget: rollLabel}, 0, 0, 1, 1)
 			grid.AddChildAt(&etk.WithoutMouse{Widget: moveLabel}, 1, 0, 1, 1)
+			grid.AddChildAt(&etk.WithoutMouse{Widget: analysisLabel}, 2, 0, 1, 1)
+			rollFrame.moveLabel, rollFrame.analysisLabel = moveLabel, analysisLabel
 			btn.AddChild(&etk.WithoutMouse{Widget: grid})
-			g.board.replayList.AddChildAt(btn, x, listY)
+			g.board.replayList.AddChildAt(btn, replayListColumn(player), listY)
 
 			if player == 1 {
 				listY++
+				rowUsed = false
+			} else {
+				rowUsed = true
 			}
 		}
-	}
-	if scanner.Err() != nil {
-		log.Printf("warning: failed to read replay: %s", scanner.Err())
-		return
-	}
 
+		var next *replay.Header
+		if i < len(match.Games)-1 {
+			next = match.Games[i+1].Header
+		}
+		winner, points := matchGame.Result(gs.Game, next)
+		if winner == 0 || len(matchGame.Records) == 0 {
+			continue
+		}
+		result := gotext.GetN("Wins %d point", "Wins %d points", int(points), points)
+		if winner == 1 {
+			addRow(len(g.replayFrames), result, "")
+		} else {
+			addRow(len(g.replayFrames), "", result)
+		}
+		if h.Points > 1 && next == nil {
+			score1, score2 := h.Score1, h.Score2
+			if winner == 1 {
+				score1 += points
+			} else {
+				score2 += points
+			}
+			addRow(len(g.replayFrames), gotext.Get("Score: %d", score1), gotext.Get("Score: %d", score2))
+		}
+	}
 	if len(g.replayFrames) < 2 {
-		log.Printf("warning: failed to read replay: no frames were loaded")
+		failed(gotext.Get("no moves were played"))
 		return
 	}
 
 	g.replayFrames = append(g.replayFrames, &replayFrame{
-		Game:  gs.Game.Copy(true),
-		Event: nil,
+		Game: gs.Game.Copy(true),
 	})
 
 	g.Lock()
 	g.showReplayFrame(0, true)
 	g.Unlock()
 }
+
+// replayListButton returns a button in the replay list which shows the
+// provided frame when selected.
+func (g *Game) replayListButton(frame int) *etk.Button {
+	return etk.NewButton("", func() error {
+		g.board.stopReplayAuto()
+		g.showReplayFrame(frame, true)
+		return nil
+	})
+}
+
+func newReplayListText(text string) *etk.Text {
+	t := etk.NewText(text)
+	t.SetPadding(etk.Scale(etk.Style.ButtonBorderSize + 2))
+	t.SetVertical(etk.AlignCenter)
+	t.SetAutoResize(true)
+	t.SetForeground(etk.Style.ButtonTextColor)
+	return t
+}
+
+// replayListColumn returns the column of the replay list where the actions of
+// the provided player are listed.
+func replayListColumn(player int8) int {
+	if player == 1 {
+		return 1
+	}
+	return 0
+}
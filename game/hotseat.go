@@ -0,0 +1,178 @@
+package game
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/gotext"
+)
+
+// hotSeatSwitchDelay is the amount of time the board remains visible after a
+// player finishes their turn, before control is passed to the other player.
+const hotSeatSwitchDelay = time.Second
+
+// hotSeat allows two players to play an offline match on the same device.
+// Each player is connected to the local server using their own client. Only
+// the events received by the client of the player in control are handled by
+// the user interface.
+type hotSeat struct {
+	seats    [2]*Client
+	active   int
+	gameID   int
+	password string
+	pending  bool // Whether control is about to be passed to the other player.
+}
+
+// hotSeatSettings are the settings of hot-seat matches. They are saved locally,
+// as the server only stores the settings of registered accounts.
+type hotSeatSettings struct {
+	PassScreen bool // Hide the board while the device is passed to the other player.
+	FixedBoard bool // Keep the board perspective of the first player.
+}
+
+func defaultHotSeatSettings() *hotSeatSettings {
+	return &hotSeatSettings{
+		PassScreen: true,
+	}
+}
+
+// hotSeatPassword returns a random password used to prevent the bots from
+// joining hot-seat matches.
+func hotSeatPassword() string {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "hotseat"
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (h *hotSeat) inactive() *Client {
+	return h.seats[1-h.active]
+}
+
+// startHotSeat connects the second player to the local server and joins the
+// match created by the first player.
+func (g *Game) startHotSeat(gameID int) {
+	if g.localServer == nil || g.hotSeat == nil {
+		return
+	}
+	h := g.hotSeat
+	h.gameID = gameID
+
+	name := gotext.Get("Player 2")
+	c := newClient("", strings.ReplaceAll(name, " ", "_"), "", false)
+	c.Transport = NewConnTransport(<-g.localServer)
+	c.local = true
+	h.seats[1] = c
+
+	go g.handleEvents(c)
+	go c.Connect()
+}
+
+// handleInactiveEvent handles an event received by the client of the player
+// who is not in control.
+func (h *hotSeat) handleInactiveEvent(c *Client, e interface{}) {
+	switch ev := e.(type) {
+	case *bgammon.EventWelcome:
+		c.Username = ev.PlayerName
+		if h.gameID != 0 {
+			c.Send([]byte(fmt.Sprintf("j %d %s", h.gameID, h.password)))
+		}
+	case *bgammon.EventPing:
+		c.Send([]byte(fmt.Sprintf("pong %s", ev.Message)))
+	}
+}
+
+// mayAct returns whether the player viewing the provided game state must
+// take an action.
+func mayAct(gs *bgammon.GameState) bool {
+	if gs.Winner != 0 {
+		return true
+	}
+	return gs.MayRoll() || gs.MayOK() || gs.MayDecline() || (gs.Turn != 0 && gs.Turn == gs.PlayerNumber && !gs.DoubleOffered)
+}
+
+// checkHotSeat passes control to the other player when the player in control
+// has finished their turn.
+func (g *Game) checkHotSeat() {
+	h := g.hotSeat
+	if h == nil || h.pending || h.seats[1] == nil || h.inactive().Username == "" {
+		return
+	}
+	gs := g.board.gameState
+	if gs.Player1.Name == "" || gs.Player2.Name == "" || mayAct(gs) {
+		return
+	}
+	h.pending = true
+
+	time.AfterFunc(hotSeatSwitchDelay, func() {
+		g.board.Lock()
+		g.Lock()
+		g.board.Unlock()
+		defer g.Unlock()
+
+		h.pending = false
+		if g.hotSeat != h || mayAct(g.board.gameState) {
+			return
+		}
+		g.switchHotSeat()
+	})
+}
+
+// switchHotSeat passes control to the other player.
+func (g *Game) switchHotSeat() {
+	h := g.hotSeat
+	h.active = 1 - h.active
+	c := h.seats[h.active]
+
+	g.client = c
+	g.lobby.c = c
+	g.board.client = c
+
+	g.board.Lock()
+	g.board.playerRoll1, g.board.playerRoll2, g.board.playerRoll3 = 0, 0, 0
+	g.board.opponentRoll1, g.board.opponentRoll2, g.board.opponentRoll3 = 0, 0, 0
+	g.board.playerRollStale = false
+	g.board.opponentRollStale = false
+	g.board.playerMoves = nil
+	g.board.opponentMoves = nil
+	g.board.dragging = nil
+	g.board.rotated = g.board.hotSeatFixedBoard && h.active == 1
+	if g.board.hotSeatPassScreen {
+		g.board.showPassDevice(c.Username)
+	}
+	g.board.Unlock()
+
+	c.Send([]byte("board"))
+	scheduleFrame()
+}
+
+// endHotSeat disconnects the second player. When the second player is in
+// control, control is returned to the first player, who then leaves the match.
+func (g *Game) endHotSeat() {
+	h := g.hotSeat
+	if h == nil {
+		return
+	}
+	g.hotSeat = nil
+
+	if h.active == 1 {
+		c := h.seats[0]
+		g.client = c
+		g.lobby.c = c
+		g.board.client = c
+		c.Send([]byte("leave"))
+	}
+	if h.seats[1] != nil {
+		h.seats[1].Disconnect()
+	}
+	g.board.Lock()
+	g.board.rotated = false
+	g.board.passDeviceDialog.SetVisible(false)
+	g.board.Unlock()
+}
@@ -0,0 +1,285 @@
+//go:build !js || !wasm
+
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/gotext"
+)
+
+const (
+	lanPort              = 1337
+	lanDiscoveryPort     = 1339
+	lanAnnounceInterval  = 2 * time.Second
+	lanServerExpiration  = 3 * lanAnnounceInterval
+	lanAnnouncementMagic = "boxcars-lan"
+)
+
+const lanSupported = true
+
+// lanServer is a server hosted by another client on the local network.
+type lanServer struct {
+	Name     string
+	Address  string
+	lastSeen time.Time
+}
+
+var (
+	lanServers     = make(map[string]*lanServer)
+	lanServersLock = &sync.Mutex{}
+
+	lanDiscovery     net.PacketConn // Connection receiving announcements while discovering servers.
+	lanDiscoveryLock = &sync.Mutex{}
+)
+
+// hostLAN plays offline while also accepting connections from other clients
+// on the local network. The server is announced via UDP broadcast.
+func (g *Game) hostLAN() error {
+	go hideKeyboard()
+	if g.loggedIn {
+		return nil
+	}
+
+	g.startLocalServer()
+
+	var listenErr error
+	if g.lanListener == nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", lanPort))
+		if err != nil {
+			log.Printf("warning: failed to host LAN game: %s", err)
+			listenErr = err
+		} else {
+			ctx, cancel := context.WithCancel(context.Background())
+			g.lanListener, g.lanAnnounceCancel = listener, cancel
+			go g.handleLANListener(listener)
+			go announceLAN(ctx, g.connectUsername.Text())
+		}
+	}
+
+	go func() {
+		g.ConnectLocal(<-g.localServer)
+		if listenErr != nil {
+			ls("*** " + gotext.Get("Failed to host LAN game: %s", listenErr))
+		} else {
+			ls("*** " + gotext.Get("Hosting LAN game on port %d.", lanPort))
+		}
+	}()
+	return nil
+}
+
+// handleLANListener connects clients on the local network to the local server.
+func (g *Game) handleLANListener(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("warning: failed to accept LAN connection: %s", err)
+			return
+		}
+		go bridgeConns(conn, <-g.localServer)
+	}
+}
+
+// stopHostingLAN stops accepting connections from clients on the local
+// network and stops announcing the hosted server.
+func (g *Game) stopHostingLAN() {
+	if g.lanListener == nil {
+		return
+	}
+	g.lanAnnounceCancel()
+	g.lanListener.Close()
+	g.lanListener, g.lanAnnounceCancel = nil, nil
+}
+
+// bridgeConns copies data between two connections until either is closed.
+func bridgeConns(a net.Conn, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// announceLAN periodically broadcasts the hosted server to the local network
+// until the provided context is canceled.
+func announceLAN(ctx context.Context, name string) {
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	name = strings.ReplaceAll(strings.TrimSpace(name), "\n", " ")
+
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		log.Printf("warning: failed to announce LAN game: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	broadcast := &net.UDPAddr{IP: net.IPv4bcast, Port: lanDiscoveryPort}
+	announcement := []byte(fmt.Sprintf("%s %d %s", lanAnnouncementMagic, lanPort, name))
+	t := time.NewTicker(lanAnnounceInterval)
+	defer t.Stop()
+	for {
+		_, err = conn.WriteTo(announcement, broadcast)
+		if err != nil {
+			log.Printf("warning: failed to announce LAN game: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// startLANDiscovery listens for servers announced on the local network until
+// stopLANDiscovery is called. The provided function is called when the list of
+// servers changes.
+func startLANDiscovery(changed func()) {
+	lanDiscoveryLock.Lock()
+	defer lanDiscoveryLock.Unlock()
+	if lanDiscovery != nil {
+		return
+	}
+
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", lanDiscoveryPort))
+	if err != nil {
+		log.Printf("warning: failed to listen for LAN games: %s", err)
+		return
+	}
+	lanDiscovery = conn
+
+	done := make(chan struct{})
+	go discoverLAN(conn, changed, done)
+	go expireLANServers(changed, done)
+}
+
+// stopLANDiscovery stops listening for servers announced on the local network.
+func stopLANDiscovery() {
+	lanDiscoveryLock.Lock()
+	defer lanDiscoveryLock.Unlock()
+	if lanDiscovery == nil {
+		return
+	}
+	lanDiscovery.Close()
+	lanDiscovery = nil
+}
+
+// discoverLAN reads server announcements until the provided connection is
+// closed.
+func discoverLAN(conn net.PacketConn, changed func(), done chan struct{}) {
+	defer close(done)
+
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			log.Printf("warning: failed to listen for LAN games: %s", err)
+			return
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		split := strings.SplitN(string(buf[:n]), " ", 3)
+		if len(split) < 2 || split[0] != lanAnnouncementMagic {
+			continue
+		}
+		port, err := strconv.Atoi(split[1])
+		if err != nil || port <= 0 || port > 65535 {
+			continue
+		}
+		name := udpAddr.IP.String()
+		if len(split) == 3 && split[2] != "" {
+			name = split[2]
+		}
+		address := "tcp://" + net.JoinHostPort(udpAddr.IP.String(), strconv.Itoa(port))
+
+		lanServersLock.Lock()
+		server := lanServers[address]
+		added := server == nil
+		if added {
+			server = &lanServer{Address: address}
+			lanServers[address] = server
+		}
+		added = added || server.Name != name
+		server.Name = name
+		server.lastSeen = time.Now()
+		lanServersLock.Unlock()
+
+		if added {
+			changed()
+		}
+	}
+}
+
+// expireLANServers removes servers which are no longer announced until the
+// provided channel is closed.
+func expireLANServers(changed func(), done chan struct{}) {
+	t := time.NewTicker(lanAnnounceInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+
+		var removed bool
+		lanServersLock.Lock()
+		for address, server := range lanServers {
+			if time.Since(server.lastSeen) > lanServerExpiration {
+				delete(lanServers, address)
+				removed = true
+			}
+		}
+		lanServersLock.Unlock()
+
+		if removed {
+			changed()
+		}
+	}
+}
+
+// discoveredLANServers returns the servers discovered on the local network,
+// sorted by name.
+func discoveredLANServers() []*lanServer {
+	lanServersLock.Lock()
+	defer lanServersLock.Unlock()
+
+	servers := make([]*lanServer, 0, len(lanServers))
+	for _, server := range lanServers {
+		s := *server
+		servers = append(servers, &s)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Name == servers[j].Name {
+			return servers[i].Address < servers[j].Address
+		}
+		return servers[i].Name < servers[j].Name
+	})
+	return servers
+}
@@ -0,0 +1,220 @@
+package game
+
+import (
+	"bytes"
+	"image/color"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/gotext"
+)
+
+const (
+	latencyProbeInterval = 10 * time.Second
+	latencyProbeTimeout  = 5 * time.Second
+	degradedLatency      = 300 * time.Millisecond
+	degradedJitter       = 100 * time.Millisecond
+)
+
+type connectionQuality int
+
+const (
+	connectionOffline connectionQuality = iota
+	connectionGood
+	connectionDegraded
+)
+
+// latencyTracker measures the round-trip time of the connection to the
+// server. The server does not respond to pings sent by the client, and it has
+// no command intended for measuring latency. Instead, the time between
+// requesting the match list and receiving it is measured.
+//
+// The server replies to commands in the order they are received, so each
+// match list received is matched to the oldest outstanding request. The match
+// list sent after logging in is ignored, as are match lists received while no
+// request is outstanding. A match list sent by the server without being
+// requested while a request is outstanding can not be distinguished from a
+// reply, and results in an inaccurate sample.
+//
+// Probes are only sent while the client is in the lobby. The match list is not
+// shown during a match, and requesting it would only add load to the server.
+type latencyTracker struct {
+	connected bool
+	inMatch   bool             // Whether the client has joined a match.
+	loginList bool             // Whether the match list sent after logging in is expected.
+	requests  []latencyRequest // Outstanding match list requests, oldest first.
+	rtt       time.Duration
+	jitter    time.Duration
+	measured  bool
+	*sync.Mutex
+}
+
+// latencyRequest is a match list request awaiting a reply.
+type latencyRequest struct {
+	sent  time.Time
+	probe bool // Whether the match list was requested to measure latency.
+}
+
+// latencyProbeCommand is sent to measure latency. The replies to probes are
+// not handled by the user interface.
+const latencyProbeCommand = "ls"
+
+// isListCommand returns whether the command requests the match list.
+func isListCommand(command []byte) bool {
+	return bytes.EqualFold(command, []byte("ls")) || bytes.EqualFold(command, []byte("list"))
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (t *latencyTracker) setConnected(connected bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.connected = connected
+	t.loginList = connected
+	t.inMatch = false
+	t.requests = t.requests[:0]
+	if !connected {
+		t.rtt, t.jitter, t.measured = 0, 0, false
+	}
+}
+
+// setInMatch is called when the client joins or leaves a match.
+func (t *latencyTracker) setInMatch(inMatch bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.inMatch = inMatch
+}
+
+// probe returns whether a probe should be sent. Probes are not sent during a
+// match, or while a probe is outstanding, unless it has likely been lost.
+func (t *latencyTracker) probe() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.connected || t.inMatch {
+		return false
+	}
+	for _, r := range t.requests {
+		if r.probe && time.Since(r.sent) < latencyProbeInterval*3 {
+			return false
+		}
+	}
+	return true
+}
+
+// requested is called when a match list request is sent to the server.
+func (t *latencyTracker) requested(probe bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	if !t.connected {
+		return
+	}
+	t.requests = append(t.requests, latencyRequest{sent: time.Now(), probe: probe})
+}
+
+// received is called when a match list is received. It returns whether the
+// match list was requested to measure latency.
+func (t *latencyTracker) received() bool {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.loginList {
+		t.loginList = false
+		return false
+	} else if len(t.requests) == 0 {
+		return false
+	}
+	r := t.requests[0]
+	t.requests = t.requests[1:]
+	sample := time.Since(r.sent)
+
+	if !t.measured {
+		t.rtt, t.jitter, t.measured = sample, 0, true
+		return r.probe
+	}
+	diff := sample - t.rtt
+	if diff < 0 {
+		diff = -diff
+	}
+	t.jitter += (diff - t.jitter) / 4
+	t.rtt += (sample - t.rtt) / 4
+	return r.probe
+}
+
+// status returns the connection quality and smoothed round-trip time.
+func (t *latencyTracker) status() (connectionQuality, time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	switch {
+	case !t.connected:
+		return connectionOffline, 0
+	case len(t.requests) != 0 && time.Since(t.requests[0].sent) > latencyProbeTimeout:
+		return connectionDegraded, time.Since(t.requests[0].sent)
+	case t.rtt > degradedLatency || t.jitter > degradedJitter:
+		return connectionDegraded, t.rtt
+	default:
+		return connectionGood, t.rtt
+	}
+}
+
+func connectionColor(quality connectionQuality) color.RGBA {
+	switch quality {
+	case connectionGood:
+		return connectionGoodColor
+	case connectionDegraded:
+		return connectionDegradedColor
+	default:
+		return connectionOfflineColor
+	}
+}
+
+// connectionLatencyText returns a compact description of the connection
+// quality. The quality is indicated by the color of the text.
+func connectionLatencyText(quality connectionQuality, rtt time.Duration) string {
+	if quality == connectionOffline {
+		return gotext.Get("Offline")
+	} else if rtt == 0 {
+		return "-"
+	}
+	return gotext.Get("%d ms", rtt.Milliseconds())
+}
+
+// connectionStatusText returns a short description of the connection quality.
+func connectionStatusText(quality connectionQuality, rtt time.Duration) string {
+	ms := int(rtt.Milliseconds())
+	switch quality {
+	case connectionGood:
+		if ms == 0 {
+			return gotext.Get("Good")
+		}
+		return gotext.Get("Good (%d ms)", ms)
+	case connectionDegraded:
+		return gotext.Get("Degraded (%d ms)", ms)
+	default:
+		return gotext.Get("Offline")
+	}
+}
+
+func (c *Client) handleLatency(done chan struct{}) {
+	t := time.NewTicker(latencyProbeInterval)
+	defer t.Stop()
+	for {
+		if c.loggedIn && c.latency.probe() {
+			c.out.pushProbe([]byte(latencyProbeCommand))
+		}
+
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
+}
@@ -60,6 +60,11 @@ type lobby struct {
 	createGameAceyCheckbox   *etk.Checkbox
 	createGameTabulaCheckbox *etk.Checkbox
 
+	createGameOptions         *etk.Grid
+	createGameHotSeatLabel    *etk.Text
+	createGameHotSeatGrid     *etk.Grid
+	createGameHotSeatCheckbox *etk.Checkbox
+
 	createGamePending bool
 	createGameShown   bool
 
@@ -90,12 +95,16 @@ type lobby struct {
 
 	historyPageDialog      *Dialog
 	historyPageDialogInput *NumericInput
+	historyFormat          *etk.Select // Format of downloaded replays.
 
 	availableMatchesList *etk.List
 
 	historyButton *etk.Button
+	botStrength   *etk.Select // Strength of the bots when playing offline.
 	buttonsGrid   *etk.Grid
 
+	connectionLabel *etk.Text
+
 	achievementInfo map[int][2]string
 }
 
@@ -149,6 +158,20 @@ func NewLobby() *lobby {
 	return l
 }
 
+// showCreateGameHotSeat sets whether the option to play the match being created
+// by two players on this device is shown. When hosting a LAN game, matches
+// are only played on this device when the option is selected.
+func (l *lobby) showCreateGameHotSeat(show bool) {
+	rowSize := 0
+	if show {
+		rowSize = fieldHeight
+	}
+	l.createGameOptions.SetRowSizes(fieldHeight, fieldHeight, fieldHeight, rowSize, -1)
+	l.createGameHotSeatLabel.SetVisible(show)
+	l.createGameHotSeatGrid.SetVisible(show)
+	l.createGameHotSeatCheckbox.SetSelected(false)
+}
+
 func (l *lobby) toggleVariantAcey() error {
 	l.createGameTabulaCheckbox.SetSelected(false)
 	return nil
@@ -344,26 +367,24 @@ func (l *lobby) selectButton(buttonIndex int) func() error {
 				if selected >= 0 && selected < len(l.historyMatches) {
 					match := l.historyMatches[selected]
 					game.downloadReplay = match.ID
-					game.client.Out <- []byte(fmt.Sprintf("replay %d", match.ID))
+					game.downloadFormat = game.replayFormat
+					game.client.Send([]byte(fmt.Sprintf("replay %d", match.ID)))
 				}
 			case lobbyButtonHistoryView:
 				_, selected := l.historyList.SelectedItem()
 				if selected >= 0 && selected < len(l.historyMatches) {
 					match := l.historyMatches[selected]
-					game.client.Out <- []byte(fmt.Sprintf("replay %d", match.ID))
+					game.client.Send([]byte(fmt.Sprintf("replay %d", match.ID)))
 				}
 			}
 			return nil
 		}
 		switch buttonIndex {
 		case lobbyButtonRefresh:
-			l.c.Out <- []byte("ls")
+			l.c.Send([]byte("ls"))
 		case lobbyButtonCreate:
 			if l.c.Username == "" {
 				return nil
-			} else if l.c.local {
-				ls("*** Failed to create match: Offline human versus human matches are not supported yet. Stay tuned.")
-				return nil
 			}
 
 			l.showCreateGame = true
@@ -379,6 +400,7 @@ func (l *lobby) selectButton(buttonIndex int) func() error {
 			l.createGameName.SetText(namePlural + " match")
 			l.createGamePoints.SetText("1")
 			l.createGamePassword.SetText("")
+			l.showCreateGameHotSeat(l.c.local && l.c.lanHost)
 			l.rebuildButtonsGrid()
 			scheduleFrame()
 		case lobbyButtonJoin:
@@ -464,5 +486,5 @@ func (l *lobby) confirmSelectHistory(selected int) {
 		return
 	}
 	match := l.historyMatches[selected]
-	l.c.Out <- []byte(fmt.Sprintf("replay %d", match.ID))
+	l.c.Send([]byte(fmt.Sprintf("replay %d", match.ID)))
 }
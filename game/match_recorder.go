@@ -0,0 +1,153 @@
+package game
+
+import (
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/replay"
+)
+
+// matchRecorder records the games of a match from the perspective of a
+// spectator.
+type matchRecorder struct {
+	games []*replay.Game // Completed games.
+
+	started int64
+	header  *replay.Header // Header of the game being recorded.
+	records []replay.Record
+
+	turn    int8
+	roll    [3]int8
+	moves   [][]int8
+	pending bool // Whether a roll is being recorded.
+
+	doublePlayer  int8
+	doubleValue   int8
+	doublePending bool
+
+	state *bgammon.GameState // Last game state received.
+}
+
+func newMatchRecorder() *matchRecorder {
+	return &matchRecorder{}
+}
+
+// handleEvent records an event received by a spectator.
+func (r *matchRecorder) handleEvent(e interface{}) {
+	switch ev := e.(type) {
+	case *bgammon.EventBoard:
+		r.handleBoard(&ev.GameState)
+	case *bgammon.EventMoved:
+		if r.pending {
+			r.moves = append(r.moves, ev.Moves...)
+		}
+	case *bgammon.EventWin:
+		r.handleWin(ev)
+	}
+}
+
+func (r *matchRecorder) handleBoard(gs *bgammon.GameState) {
+	if gs.Started != 0 && gs.Started != r.started && gs.Winner == 0 {
+		r.started = gs.Started
+		r.header = &replay.Header{
+			Started: gs.Started,
+			Player1: gs.Player1.Name,
+			Player2: gs.Player2.Name,
+			Points:  gs.Points,
+			Score1:  gs.Player1.Points,
+			Score2:  gs.Player2.Points,
+			Variant: gs.Variant,
+		}
+		r.records = nil
+		r.pending, r.doublePending = false, false
+	}
+
+	if gs.DoubleOffered && !r.doublePending {
+		r.flushRoll()
+		r.doublePending, r.doublePlayer, r.doubleValue = true, gs.Turn, gs.DoubleValue*2
+	} else if !gs.DoubleOffered && r.doublePending && gs.Winner == 0 {
+		r.records = append(r.records, &replay.Double{Player: r.doublePlayer, Value: r.doubleValue, Accepted: true})
+		r.doublePending = false
+	}
+
+	if gs.Turn != 0 && gs.Roll1 != 0 && gs.Roll2 != 0 {
+		roll := [3]int8{gs.Roll1, gs.Roll2, gs.Roll3}
+		if r.pending && (r.turn != gs.Turn || (r.roll != roll && len(gs.Moves) == 0)) {
+			r.flushRoll()
+		}
+		if !r.pending {
+			r.pending, r.turn, r.roll, r.moves = true, gs.Turn, roll, nil
+		}
+	} else if r.pending && gs.Turn != r.turn {
+		r.flushRoll()
+	}
+
+	state := *gs
+	game := *gs.Game
+	state.Game = &game
+	r.state = &state
+}
+
+func (r *matchRecorder) handleWin(ev *bgammon.EventWin) {
+	if r.started == 0 || r.state == nil {
+		return
+	}
+	gs := r.state
+
+	var winner int8 = 1
+	if ev.Player == gs.Player2.Name {
+		winner = 2
+	}
+	r.flushRoll()
+	if r.doublePending {
+		r.records = append(r.records, &replay.Double{Player: r.doublePlayer, Value: r.doubleValue})
+		r.doublePending = false
+	} else if ev.Resigned != "" {
+		r.records = append(r.records, &replay.Resign{Player: 3 - winner})
+	}
+
+	header := *r.header
+	header.Winner, header.DoubleValue = winner, gs.DoubleValue
+	r.games = append(r.games, &replay.Game{
+		Header:  &header,
+		Records: r.records,
+	})
+	r.started = 0
+	r.records = nil
+}
+
+// flushRoll records the pending roll and the moves played.
+func (r *matchRecorder) flushRoll() {
+	if !r.pending {
+		return
+	}
+	r1, r2, r3 := r.roll[0], r.roll[1], r.roll[2]
+	if r2 > r1 {
+		r1, r2 = r2, r1
+	}
+	if r3 > r1 {
+		r1, r3 = r3, r1
+	}
+	if r3 > r2 {
+		r2, r3 = r3, r2
+	}
+	r.records = append(r.records, &replay.Roll{
+		Player: r.turn,
+		Roll1:  r1,
+		Roll2:  r2,
+		Roll3:  r3,
+		Moves:  r.moves,
+	})
+	r.pending = false
+}
+
+// match returns the recorded games, and then clears the recorded games. Nil
+// is returned when no games have been recorded.
+func (r *matchRecorder) match() *replay.Match {
+	if len(r.games) == 0 {
+		return nil
+	}
+	m := &replay.Match{
+		Games: r.games,
+	}
+	r.games = nil
+	return m
+}
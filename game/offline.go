@@ -0,0 +1,97 @@
+package game
+
+import (
+	"log"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/bgammon-bei-bot/bot"
+	"codeberg.org/tslocum/gotext"
+)
+
+// offlineMatch is the state of an offline match against a bot. It is saved
+// after every turn so that the match may be resumed after restarting.
+type offlineMatch struct {
+	Saved int64 // Unix timestamp.
+	Game  *bgammon.GameState
+}
+
+// offlineMatchOver returns whether the provided match has been won.
+func offlineMatchOver(gs *bgammon.GameState) bool {
+	return gs.Winner != 0 && (gs.Player1.Points >= gs.Points || gs.Player2.Points >= gs.Points)
+}
+
+// saveOfflineMatch saves the current offline match when the turn has
+// changed. The saved match is removed once the match has been won. Only
+// backgammon matches against a bot are saved, as they are resumed on a
+// practice server. The player is told when the match will not be saved.
+func (g *Game) saveOfflineMatch() {
+	if g.client == nil || !g.client.local || (g.practice != nil && !g.practice.match) {
+		return
+	}
+	gs := g.board.gameState
+	if gs.Spectating || gs.Player1.Name == "" || gs.Player2.Name == "" {
+		return
+	} else if g.hotSeat != nil || gs.Variant != bgammon.VariantBackgammon {
+		if !g.offlineUnsaved {
+			g.offlineUnsaved = true
+			ls("*** " + gotext.Get("This match will not be saved. Only backgammon matches against a bot may be resumed."))
+		}
+		return
+	} else if offlineMatchOver(gs) {
+		err := removeOfflineMatch()
+		if err != nil {
+			log.Printf("warning: failed to remove saved offline match: %s", err)
+		}
+		g.offlineTurn = 0
+		return
+	} else if gs.Turn == g.offlineTurn {
+		return
+	}
+	g.offlineTurn = gs.Turn
+
+	state := *gs
+	game := *gs.Game
+	state.Game = &game
+	err := saveOfflineMatch(&offlineMatch{
+		Saved: time.Now().Unix(),
+		Game:  &state,
+	})
+	if err != nil {
+		log.Printf("warning: failed to save offline match: %s", err)
+	}
+}
+
+// resumeOffline plays the saved offline match against the tabula engine. The
+// position, score, doubling cube and turn of the saved match are restored.
+func (g *Game) resumeOffline() error {
+	go hideKeyboard()
+	if g.loggedIn {
+		return nil
+	}
+
+	m, err := loadOfflineMatch()
+	if err != nil {
+		log.Printf("warning: failed to load saved offline match: %s", err)
+		return nil
+	} else if m == nil || m.Game == nil || m.Game.Game == nil {
+		return nil
+	} else if m.Game.Variant != bgammon.VariantBackgammon {
+		ls("*** " + gotext.Get("Only backgammon matches may be resumed."))
+		return nil
+	}
+	position := m.Game.Game
+	if m.Game.PlayerNumber == 2 {
+		position = flipPosition(position)
+	}
+
+	g.startLocalServer()
+	engine := bot.NewLocalBEIClient(weakenEngine(<-g.beiConns), true)
+	practice, conn := newPracticeServer(engine, true)
+	g.practice = practice
+	g.offlineTurn = 0
+	g.ConnectLocal(conn)
+	go practice.play(position)
+	ls("*** " + gotext.Get("Resuming offline match saved on %s.", time.Unix(m.Saved, 0).Format("2006-01-02 15:04")))
+	return nil
+}
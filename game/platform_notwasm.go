@@ -4,13 +4,24 @@ package game
 
 import (
 	"bufio"
+	"encoding/json"
+	"net/http"
 	"os"
 	"path"
 
+	"codeberg.org/tslocum/boxcars/proxy"
 	"github.com/coder/websocket"
 )
 
+// profilesSupported is whether server profiles may be saved.
+const profilesSupported = true
+
 var dialOptions = &websocket.DialOptions{
+	HTTPClient: &http.Client{
+		Transport: &http.Transport{
+			Proxy: proxy.Request,
+		},
+	},
 	CompressionMode: websocket.CompressionContextTakeover,
 }
 
@@ -51,3 +62,113 @@ func saveCredentials(username string, password string) {
 	_ = os.MkdirAll(configDir, 0700)
 	_ = os.WriteFile(path.Join(configDir, "config"), []byte(username+"\n"+password), 0600)
 }
+
+func loadProfiles() (*profileConfig, error) {
+	config := &profileConfig{}
+	configDir := userConfigDir()
+	if configDir == "" {
+		return config, nil
+	}
+	buf, err := os.ReadFile(path.Join(configDir, "profiles.json"))
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, config)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func saveProfiles(config *profileConfig) error {
+	configDir := userConfigDir()
+	if configDir == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(configDir, 0700)
+	return os.WriteFile(path.Join(configDir, "profiles.json"), buf, 0600)
+}
+
+func loadHotSeatSettings() (*hotSeatSettings, error) {
+	settings := defaultHotSeatSettings()
+	configDir := userConfigDir()
+	if configDir == "" {
+		return settings, nil
+	}
+	buf, err := os.ReadFile(path.Join(configDir, "hotseat.json"))
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(buf, settings)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func saveHotSeatSettings(settings *hotSeatSettings) error {
+	configDir := userConfigDir()
+	if configDir == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(settings, "", "\t")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(configDir, 0700)
+	return os.WriteFile(path.Join(configDir, "hotseat.json"), buf, 0600)
+}
+
+func loadOfflineMatch() (*offlineMatch, error) {
+	configDir := userConfigDir()
+	if configDir == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path.Join(configDir, "offline.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := &offlineMatch{}
+	err = json.Unmarshal(buf, m)
+	if err != nil {
+		return nil, err
+	} else if m.Game == nil || m.Game.Game == nil {
+		return nil, nil
+	}
+	return m, nil
+}
+
+func saveOfflineMatch(m *offlineMatch) error {
+	configDir := userConfigDir()
+	if configDir == "" {
+		return nil
+	}
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(configDir, 0700)
+	return os.WriteFile(path.Join(configDir, "offline.json"), buf, 0600)
+}
+
+func removeOfflineMatch() error {
+	configDir := userConfigDir()
+	if configDir == "" {
+		return nil
+	}
+	err := os.Remove(path.Join(configDir, "offline.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
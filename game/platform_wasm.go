@@ -73,6 +73,36 @@ func saveCredentials(username string, password string) {
 	document.Set("cookie", fmt.Sprintf("boxcars_password=%s; path=/", password))
 }
 
+const profilesSupported = false
+
+func loadProfiles() (*profileConfig, error) {
+	return &profileConfig{}, nil
+}
+
+func saveProfiles(config *profileConfig) error {
+	return nil
+}
+
+func loadHotSeatSettings() (*hotSeatSettings, error) {
+	return defaultHotSeatSettings(), nil
+}
+
+func saveHotSeatSettings(settings *hotSeatSettings) error {
+	return nil
+}
+
+func loadOfflineMatch() (*offlineMatch, error) {
+	return nil, nil
+}
+
+func saveOfflineMatch(m *offlineMatch) error {
+	return nil
+}
+
+func removeOfflineMatch() error {
+	return nil
+}
+
 func GetLocale() (string, error) {
 	return js.Global().Get("navigator").Get("language").String(), nil
 }
@@ -88,3 +118,27 @@ func ReplayDir() string {
 func isSteamDeck() bool {
 	return false
 }
+
+const lanSupported = false
+
+type lanServer struct {
+	Name    string
+	Address string
+}
+
+func (g *Game) hostLAN() error {
+	return nil
+}
+
+func (g *Game) stopHostingLAN() {
+}
+
+func startLANDiscovery(changed func()) {
+}
+
+func stopLANDiscovery() {
+}
+
+func discoveredLANServers() []*lanServer {
+	return nil
+}
@@ -0,0 +1,747 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/bei"
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/bgammon-bei-bot/bot"
+	"codeberg.org/tslocum/boxcars/replay"
+	"codeberg.org/tslocum/gotext"
+)
+
+const practiceBotName = "BOT_tabula"
+
+// practiceServer plays a position set up in the board editor, or a saved
+// offline match, against the tabula engine. The player is always player 1.
+//
+// The game state and client handling of the bgammon server are unexported,
+// and the server always starts games from the opening position, so a position
+// may not be loaded into a game on the local server. Practice games are instead
+// played on a connection which implements the subset of the bgammon protocol
+// used by the client, relying on bgammon.Game for the rules of the game. Any
+// command or event the client starts using must also be handled here until
+// the bgammon server offers a way to start a game from a position. Unknown
+// commands are ignored, and unknown events are logged and dropped.
+type practiceServer struct {
+	conn     net.Conn
+	engine   *bot.BEIClient
+	player   string
+	position *bgammon.Game // Position played when starting or restarting the game.
+	game     *bgammon.Game
+	match    bool // Whether games are played until either player wins the match.
+	*sync.Mutex
+}
+
+// newPracticeServer returns a practice server and a connection to it. When
+// match is true, the games which follow the position are played until either
+// player wins the match.
+func newPracticeServer(engine *bot.BEIClient, match bool) (*practiceServer, net.Conn) {
+	client, server := net.Pipe()
+	s := &practiceServer{
+		conn:   server,
+		engine: engine,
+		game:   bgammon.NewGame(bgammon.VariantBackgammon),
+		match:  match,
+		Mutex:  &sync.Mutex{},
+	}
+	go s.handleConn()
+	return s, client
+}
+
+func (s *practiceServer) handleConn() {
+	scanner := bufio.NewScanner(s.conn)
+	for scanner.Scan() {
+		s.Lock()
+		s.handleCommand(scanner.Bytes())
+		s.Unlock()
+	}
+}
+
+func (s *practiceServer) handleCommand(command []byte) {
+	split := bytes.Fields(command)
+	if len(split) == 0 {
+		return
+	}
+	keyword, params := string(split[0]), split[1:]
+
+	if s.player == "" {
+		if keyword != "lj" && keyword != bgammon.CommandLoginJSON {
+			return
+		}
+		s.player = "Guest"
+		if len(params) > 1 {
+			s.player = string(params[1])
+		}
+		s.game.Player1.Name, s.game.Player2.Name = s.player, practiceBotName
+
+		ev := &bgammon.EventWelcome{
+			PlayerName: s.player,
+			Clients:    2,
+			Games:      1,
+		}
+		s.send(ev)
+		// The board is sent once the position set up in the editor is played.
+		s.sendJoined()
+		if s.position != nil {
+			s.start()
+		}
+		return
+	}
+
+	switch keyword {
+	case bgammon.CommandBoard, "b":
+		if s.position != nil {
+			s.sendBoard()
+		}
+	case bgammon.CommandRoll, "r":
+		if s.game.Winner != 0 || s.game.Turn != 1 || s.game.Roll1 != 0 || s.game.DoubleOffered || s.game.Started == 0 {
+			s.send(&bgammon.EventFailedRoll{Reason: gotext.Get("It is not your turn to roll.")})
+			return
+		}
+		s.roll()
+		s.sendBoard()
+	case bgammon.CommandMove, "m", "mv":
+		s.move(params)
+	case bgammon.CommandReset:
+		if s.game.Winner != 0 || s.game.Turn != 1 || len(s.game.Moves) == 0 {
+			return
+		}
+		l := len(s.game.Moves)
+		undoMoves := make([][]int8, l)
+		for i, move := range s.game.Moves {
+			undoMoves[l-1-i] = []int8{move[1], move[0]}
+		}
+		ok, _ := s.game.AddMoves(undoMoves, false)
+		if !ok {
+			s.sendBoard()
+			return
+		}
+		ev := &bgammon.EventMoved{
+			Moves: undoMoves,
+		}
+		ev.Player = s.player
+		s.send(ev)
+		s.sendBoard()
+	case bgammon.CommandOk, "k":
+		s.ok()
+	case bgammon.CommandDouble, "d":
+		s.double()
+	case bgammon.CommandResign:
+		s.resign()
+	case bgammon.CommandRematch, "rm":
+		if s.position == nil {
+			return
+		} else if s.match {
+			if s.game.Player1.Points < s.game.Points && s.game.Player2.Points < s.game.Points {
+				return
+			}
+			// Start a new match of the same length.
+			s.position = bgammon.NewGame(bgammon.VariantBackgammon)
+			s.position.Points = s.game.Points
+		}
+		s.start()
+	case bgammon.CommandLeave, "l":
+		ev := &bgammon.EventLeft{}
+		ev.Player = s.player
+		s.send(ev)
+	}
+}
+
+// play starts a practice game from the provided position. When the player has
+// not yet logged in, the game starts once they log in.
+func (s *practiceServer) play(position *bgammon.Game) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.position = position.Copy(true)
+	if s.player != "" {
+		s.start()
+	}
+}
+
+func (s *practiceServer) start() {
+	g := s.position.Copy(true)
+	g.Player1.Name, g.Player2.Name = s.player, practiceBotName
+	g.Started = time.Now().Unix()
+	g.Ended = 0
+	g.Winner = 0
+	g.Moves = nil
+	g.DoubleOffered = false
+	s.game = g
+
+	s.sendJoined()
+	if g.Turn == 0 {
+		s.openingRoll()
+	} else if g.Roll1 == 0 {
+		if !s.mayDouble() {
+			s.roll()
+		}
+	} else {
+		ev := &bgammon.EventRolled{
+			Roll1: g.Roll1,
+			Roll2: g.Roll2,
+		}
+		ev.Player = s.turnPlayer()
+		s.send(ev)
+	}
+	s.sendBoard()
+	if g.Turn == 2 {
+		s.playBot()
+	}
+}
+
+func (s *practiceServer) turnPlayer() string {
+	if s.game.Turn == 2 {
+		return practiceBotName
+	}
+	return s.player
+}
+
+// mayDouble returns whether the player whose turn it is may double.
+func (s *practiceServer) mayDouble() bool {
+	gs := &bgammon.GameState{
+		Game:         s.game,
+		PlayerNumber: s.game.Turn,
+	}
+	return gs.MayDouble()
+}
+
+func (s *practiceServer) roll() {
+	s.game.Roll1 = int8(rand.Intn(6) + 1)
+	s.game.Roll2 = int8(rand.Intn(6) + 1)
+
+	ev := &bgammon.EventRolled{
+		Roll1: s.game.Roll1,
+		Roll2: s.game.Roll2,
+	}
+	ev.Player = s.turnPlayer()
+	s.send(ev)
+}
+
+// openingRoll rolls one die for each player until the dice differ. The player
+// who rolled the higher die plays both dice.
+func (s *practiceServer) openingRoll() {
+	g := s.game
+	g.Roll1, g.Roll2 = 0, 0
+	for g.Roll1 == g.Roll2 {
+		g.Roll1 = int8(rand.Intn(6) + 1)
+		g.Roll2 = int8(rand.Intn(6) + 1)
+
+		ev := &bgammon.EventRolled{
+			Roll1: g.Roll1,
+		}
+		ev.Player = s.player
+		s.send(ev)
+
+		ev = &bgammon.EventRolled{
+			Roll1: g.Roll1,
+			Roll2: g.Roll2,
+		}
+		ev.Player = practiceBotName
+		s.send(ev)
+	}
+	g.Turn = 1
+	if g.Roll2 > g.Roll1 {
+		g.Turn = 2
+	}
+}
+
+func (s *practiceServer) move(params [][]byte) {
+	if s.game.Winner != 0 {
+		s.sendBoard()
+		return
+	} else if s.game.Turn != 1 || s.game.Roll1 == 0 {
+		s.send(&bgammon.EventFailedMove{Reason: gotext.Get("It is not your turn to move.")})
+		return
+	}
+
+	var moves [][]int8
+	for _, param := range params {
+		split := bytes.Split(param, []byte("/"))
+		if len(split) != 2 {
+			s.send(&bgammon.EventFailedMove{Reason: gotext.Get("illegal move")})
+			return
+		}
+		from, to := bgammon.ParseSpace(string(split[0])), bgammon.ParseSpace(string(split[1]))
+		if !bgammon.ValidSpace(from) || !bgammon.ValidSpace(to) {
+			s.send(&bgammon.EventFailedMove{From: from, To: to, Reason: gotext.Get("illegal move")})
+			return
+		}
+		moves = append(moves, []int8{from, to})
+	}
+	if len(moves) == 0 {
+		return
+	}
+
+	ok, expanded := s.game.AddMoves(moves, false)
+	if !ok {
+		s.send(&bgammon.EventFailedMove{Reason: gotext.Get("illegal move")})
+		return
+	}
+	ev := &bgammon.EventMoved{
+		Moves: expanded,
+	}
+	ev.Player = s.player
+	s.send(ev)
+	s.sendBoard()
+
+	if s.game.Winner != 0 {
+		s.handleWin("")
+	}
+}
+
+func (s *practiceServer) ok() {
+	if s.game.Winner != 0 || s.game.Started == 0 {
+		return
+	}
+
+	// Accept a double offered by the bot.
+	if s.game.DoubleOffered && s.game.Turn == 2 {
+		s.game.DoubleOffered = false
+		s.game.DoubleValue *= 2
+		s.game.DoublePlayer = 1
+		s.send(&bgammon.EventNotice{Message: gotext.Get("Accepted double.")})
+		s.sendBoard()
+		s.playBot()
+		return
+	} else if s.game.Turn != 1 || s.game.Roll1 == 0 {
+		return
+	}
+
+	available := s.game.LegalMoves(false)
+	if len(available) != 0 {
+		bgammon.SortMoves(available)
+		s.send(&bgammon.EventFailedOk{Reason: gotext.Get("The following legal moves are available: %s", bgammon.FormatMoves(available))})
+		return
+	}
+	s.nextTurn()
+}
+
+func (s *practiceServer) double() {
+	if s.game.Winner != 0 || s.game.Turn != 1 || s.game.Started == 0 || !s.mayDouble() {
+		s.send(&bgammon.EventNotice{Message: gotext.Get("You may not double at this time.")})
+		return
+	}
+
+	value := s.game.DoubleValue * 2
+	s.send(&bgammon.EventNotice{Message: gotext.GetN("Double offered to opponent (%d point).", "Double offered to opponent (%d points).", int(value), value)})
+
+	take := true
+	event, err := s.engine.Double(practiceEngineState(s.game, 2))
+	if err != nil {
+		log.Printf("warning: failed to retrieve cube evaluation from engine: %s", err)
+	} else if ev, ok := event.(*bei.EventOkDouble); ok {
+		take = ev.Cube.Take
+	}
+	if !take {
+		s.send(&bgammon.EventNotice{Message: gotext.Get("%s declined double offer.", practiceBotName)})
+		s.game.DoubleOffered = true
+		s.game.Winner = 1
+		s.handleWin(practiceBotName)
+		return
+	}
+
+	s.game.DoubleValue = value
+	s.game.DoublePlayer = 2
+	s.send(&bgammon.EventNotice{Message: gotext.Get("%s accepted double.", practiceBotName)})
+	s.sendBoard()
+}
+
+func (s *practiceServer) resign() {
+	if s.game.Winner != 0 || s.game.Started == 0 {
+		return
+	}
+
+	if s.game.DoubleOffered && s.game.Turn == 2 {
+		// Decline the double offered by the bot.
+		s.send(&bgammon.EventNotice{Message: gotext.Get("Declined double offer.")})
+		s.game.Winner = 2
+		s.handleWin(s.player)
+		return
+	} else if s.game.Turn != 1 {
+		s.send(&bgammon.EventNotice{Message: gotext.Get("You may not resign until it is your turn.")})
+		return
+	}
+	s.game.Winner = 2
+	s.handleWin(s.player)
+}
+
+// nextTurn ends the current turn. The dice are rolled automatically when the
+// player may not double.
+func (s *practiceServer) nextTurn() {
+	s.game.NextTurn(false)
+	if s.game.Winner != 0 {
+		return
+	}
+	if s.game.Turn == 2 {
+		s.sendBoard()
+		s.playBot()
+		return
+	}
+	if !s.mayDouble() {
+		s.roll()
+	}
+	s.sendBoard()
+}
+
+// playBot plays the turn of the bot.
+func (s *practiceServer) playBot() {
+	g := s.game
+	if g.Winner != 0 || g.Turn != 2 || g.DoubleOffered {
+		return
+	}
+
+	if g.Roll1 == 0 {
+		if s.mayDouble() {
+			event, err := s.engine.Double(practiceEngineState(g, 2))
+			if err != nil {
+				log.Printf("warning: failed to retrieve cube evaluation from engine: %s", err)
+			} else if ev, ok := event.(*bei.EventOkDouble); ok && ev.Cube.Offer {
+				g.DoubleOffered = true
+				s.send(&bgammon.EventNotice{Message: gotext.GetN("%s offers a double (%d point).", "%s offers a double (%d points).", int(g.DoubleValue*2), practiceBotName, g.DoubleValue*2)})
+				s.sendBoard()
+				return
+			}
+		}
+		s.roll()
+		s.sendBoard()
+	}
+
+	event, err := s.engine.Move(practiceEngineState(g, 2))
+	if err != nil {
+		log.Printf("warning: failed to retrieve move from engine: %s", err)
+	} else if ev, ok := event.(*bei.EventOkMove); ok && len(ev.Moves) != 0 {
+		for _, play := range ev.Moves[0].Play {
+			from, to := practiceEngineSpace(play.From), practiceEngineSpace(play.To)
+			if !s.moveBot([]int8{bgammon.FlipSpace(from, 2, g.Variant), bgammon.FlipSpace(to, 2, g.Variant)}) {
+				log.Printf("warning: engine chose illegal move: %d/%d", play.From, play.To)
+				break
+			}
+			if g.Winner != 0 {
+				s.handleWin("")
+				return
+			}
+		}
+	}
+
+	// Play any moves remaining when the engine failed to choose a legal move.
+	for {
+		available := g.LegalMoves(false)
+		if len(available) == 0 {
+			break
+		} else if !s.moveBot(available[0]) {
+			break
+		}
+		if g.Winner != 0 {
+			s.handleWin("")
+			return
+		}
+	}
+	s.nextTurn()
+}
+
+func (s *practiceServer) moveBot(move []int8) bool {
+	ok, expanded := s.game.AddMoves([][]int8{move}, false)
+	if !ok {
+		return false
+	}
+	ev := &bgammon.EventMoved{
+		Moves: expanded,
+	}
+	ev.Player = practiceBotName
+	s.send(ev)
+	s.sendBoard()
+	return true
+}
+
+// handleWin awards the game to the winner. When a player resigned or declined
+// a double, their name is provided. When a match is played and neither player
+// has won the match, the next game is started.
+func (s *practiceServer) handleWin(resigned string) {
+	g := s.game
+	points := g.DoubleValue
+	if !g.DoubleOffered {
+		points *= replay.WinPoints(g, g.Winner)
+	}
+	g.DoubleOffered = false
+	g.Ended = time.Now().Unix()
+
+	ev := &bgammon.EventWin{
+		Resigned: resigned,
+	}
+	if g.Winner == 1 {
+		ev.Player = s.player
+		g.Player1.Points += points
+	} else {
+		ev.Player = practiceBotName
+		g.Player2.Points += points
+	}
+	if g.Points > 1 {
+		ev.Points = points
+	}
+	next := s.match && g.Player1.Points < g.Points && g.Player2.Points < g.Points
+	if next {
+		g.Reset()
+		g.Started = time.Now().Unix()
+		g.Ended = 0
+	}
+	s.send(ev)
+	s.sendBoard()
+	if !next {
+		return
+	}
+
+	s.openingRoll()
+	s.sendBoard()
+	if g.Turn == 2 {
+		s.playBot()
+	}
+}
+
+func (s *practiceServer) sendJoined() {
+	ev := &bgammon.EventJoined{
+		GameID:       1,
+		PlayerNumber: 1,
+	}
+	ev.Player = s.player
+	s.send(ev)
+
+	ev = &bgammon.EventJoined{
+		GameID:       1,
+		PlayerNumber: 2,
+	}
+	ev.Player = practiceBotName
+	s.send(ev)
+}
+
+func (s *practiceServer) sendBoard() {
+	ev := &bgammon.EventBoard{
+		GameState: bgammon.GameState{
+			Game:         s.game.Copy(true),
+			PlayerNumber: 1,
+			Available:    s.game.LegalMoves(false),
+		},
+	}
+	if s.game.Turn != 1 {
+		ev.Available = nil
+	}
+	bgammon.SortMoves(ev.Available)
+	s.send(ev)
+}
+
+func (s *practiceServer) send(e interface{}) {
+	switch ev := e.(type) {
+	case *bgammon.EventWelcome:
+		ev.Type = bgammon.EventTypeWelcome
+	case *bgammon.EventNotice:
+		ev.Type = bgammon.EventTypeNotice
+	case *bgammon.EventJoined:
+		ev.Type = bgammon.EventTypeJoined
+	case *bgammon.EventLeft:
+		ev.Type = bgammon.EventTypeLeft
+	case *bgammon.EventBoard:
+		ev.Type = bgammon.EventTypeBoard
+	case *bgammon.EventRolled:
+		ev.Type = bgammon.EventTypeRolled
+	case *bgammon.EventFailedRoll:
+		ev.Type = bgammon.EventTypeFailedRoll
+	case *bgammon.EventMoved:
+		ev.Type = bgammon.EventTypeMoved
+	case *bgammon.EventFailedMove:
+		ev.Type = bgammon.EventTypeFailedMove
+	case *bgammon.EventFailedOk:
+		ev.Type = bgammon.EventTypeFailedOk
+	case *bgammon.EventWin:
+		ev.Type = bgammon.EventTypeWin
+	default:
+		log.Printf("warning: failed to send practice event of unknown type: %+v", e)
+		return
+	}
+
+	buf, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("warning: failed to encode practice event: %s", err)
+		return
+	}
+	s.conn.Write(append(buf, '\n'))
+}
+
+// practiceEngineState returns the BEI state of the game from the perspective
+// of the specified player.
+func practiceEngineState(g *bgammon.Game, player int8) []int8 {
+	if player == 2 {
+		g = flipPosition(g)
+	}
+
+	state := make([]int8, bei.CellCount)
+	copy(state, g.Board)
+	state[bei.StateRoll1], state[bei.StateRoll2] = g.Roll1, g.Roll2
+	state[bei.StateTurn1], state[bei.StateTurn2] = 1, 1
+	state[bei.StateCubeValue], state[bei.StateCubePlayer] = g.DoubleValue, g.DoublePlayer
+	state[bei.StatePoints1], state[bei.StatePoints2], state[bei.StateTotalPoints] = g.Player1.Points, g.Player2.Points, g.Points
+	state[bei.StateCrawford] = int8(g.Crawford)
+	state[bei.StateVariant] = g.Variant
+	state[bei.StateEntered1], state[bei.StateEntered2] = 1, 1
+	return state
+}
+
+// practiceEngineSpace converts a space chosen by the engine into a space from
+// the perspective of the player which is moving.
+func practiceEngineSpace(space int) int8 {
+	switch space {
+	case int(bgammon.SpaceBarPlayer), int(bgammon.SpaceBarOpponent):
+		return bgammon.SpaceBarPlayer
+	case int(bgammon.SpaceHomeOpponent):
+		return bgammon.SpaceHomePlayer
+	default:
+		return int8(space)
+	}
+}
+
+// editPosition plays offline against a practice server and opens the board
+// editor.
+func (g *Game) editPosition() error {
+	go hideKeyboard()
+	if g.loggedIn {
+		return nil
+	}
+
+	g.startLocalServer()
+	engine := bot.NewLocalBEIClient(weakenEngine(<-g.beiConns), true)
+	practice, conn := newPracticeServer(engine, false)
+	g.practice = practice
+	g.board.startEditing(g.practicePosition)
+	g.ConnectLocal(conn)
+	ls("*** " + gotext.Get("Drag checkers to set up a position, then select Play."))
+	return nil
+}
+
+// endPractice returns to the main menu after leaving a practice game. When the
+// practice game was started from a replay, the replay is resumed.
+func (g *Game) endPractice() {
+	if g.practice == nil {
+		return
+	}
+	g.practice = nil
+	g.board.stopEditing()
+	g.showMainMenu(false)
+
+	if g.practiceReplay != nil {
+		data, replayFrame := g.practiceReplay, g.practiceReplayFrame
+		g.practiceReplay = nil
+		go func() {
+			g.HandleReplay(data)
+			g.Lock()
+			g.showReplayFrame(replayFrame, false)
+			g.Unlock()
+		}()
+	}
+}
+
+// playPosition starts a practice game from the position set up in the board
+// editor.
+func (g *Game) playPosition(position *bgammon.Game) {
+	if g.practice == nil {
+		return
+	}
+	g.practicePosition = position.Copy(true)
+	go g.practice.play(position)
+}
+
+// takeOverReplay leaves the replay and plays on from the current frame against
+// the tabula engine. The player takes over the player whose turn it is. The
+// replay is resumed at the same frame when the practice game ends.
+func (g *Game) takeOverReplay() {
+	if !g.replay {
+		return
+	} else if g.client == nil || !g.client.local {
+		ls("*** " + gotext.Get("Replays may only be taken over while playing offline."))
+		return
+	}
+
+	position, reason := takeOverPosition(g.replayFrames[g.replayFrame])
+	if reason != "" {
+		ls("*** " + gotext.Get("Failed to take over replay: %s", reason))
+		return
+	}
+	data, replayFrame := g.replayData, g.replayFrame
+
+	g.board.stopReplayAuto()
+	g.replay = false
+	g.board.recreateUIGrid()
+	g.showMainMenu(false)
+
+	g.startLocalServer()
+	engine := bot.NewLocalBEIClient(weakenEngine(<-g.beiConns), true)
+	practice, conn := newPracticeServer(engine, false)
+	g.practice = practice
+	g.practiceReplay, g.practiceReplayFrame = data, replayFrame
+	g.ConnectLocal(conn)
+	g.playPosition(position)
+	ls("*** " + gotext.Get("Leave the match to return to the replay."))
+}
+
+// takeOverPosition returns the position of a replay frame from the perspective
+// of the player whose turn it is. When the frame is followed by a roll, the
+// position includes the dice rolled so the roll may be played differently. When
+// the position may not be played, the reason is returned instead.
+func takeOverPosition(frame *replayFrame) (*bgammon.Game, string) {
+	g := frame.Game.Copy(true)
+	switch {
+	case g.Variant != bgammon.VariantBackgammon:
+		return nil, gotext.Get("Only backgammon games may be taken over.")
+	case g.Winner != 0 || frame.Record == nil:
+		return nil, gotext.Get("The game has ended.")
+	}
+	switch r := frame.Record.(type) {
+	case *replay.Roll:
+		g.Turn = r.Player
+		g.Roll1, g.Roll2 = r.Roll1, r.Roll2
+	case *replay.Double:
+		g.Turn = r.Player
+		g.Roll1, g.Roll2 = 0, 0
+	case *replay.Resign:
+		return nil, gotext.Get("The game has ended.")
+	}
+	if g.Turn == 2 {
+		g = flipPosition(g)
+	}
+	return g, ""
+}
+
+// flipPosition returns a copy of a game where player 1 and player 2 swap sides.
+// Positions are flipped whenever they are evaluated or played from the
+// perspective of player 2, as the engine and the practice server always play
+// as player 1.
+func flipPosition(g *bgammon.Game) *bgammon.Game {
+	flipped := g.Copy(true)
+	for space := int8(0); space < bgammon.BoardSpaces; space++ {
+		flipped.Board[bgammon.FlipSpace(space, 2, g.Variant)] = g.Board[space] * -1
+	}
+	flipped.Player1, flipped.Player2 = g.Player2, g.Player1
+	flipped.Player1.Number, flipped.Player2.Number = 1, 2
+	flipped.Turn = flipPlayer(g.Turn)
+	flipped.DoublePlayer = flipPlayer(g.DoublePlayer)
+	flipped.Winner = flipPlayer(g.Winner)
+	return flipped
+}
+
+// flipPlayer returns the number of a player after the players swap sides.
+func flipPlayer(player int8) int8 {
+	switch player {
+	case 1:
+		return 2
+	case 2:
+		return 1
+	default:
+		return player
+	}
+}
@@ -0,0 +1,249 @@
+package game
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"codeberg.org/tslocum/bei"
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/bgammon-bei-bot/bot"
+	"codeberg.org/tslocum/tabula"
+)
+
+func TestFlipPosition(t *testing.T) {
+	for _, variant := range []int8{bgammon.VariantBackgammon, bgammon.VariantTabula} {
+		g := bgammon.NewGame(variant)
+		g.Board[bgammon.SpaceBarPlayer], g.Board[bgammon.SpaceHomeOpponent] = 1, -2
+		g.Player1.Name, g.Player2.Name = "Alice", "Bob"
+		g.Player1.Points, g.Player2.Points = 1, 3
+		g.Player2.Entered = false
+		g.Turn, g.DoublePlayer = 2, 1
+		original := g.Copy(true)
+
+		flipped := flipPosition(g)
+		for space := int8(0); space < bgammon.BoardSpaces; space++ {
+			if got, expected := flipped.Board[bgammon.FlipSpace(space, 2, variant)], -g.Board[space]; got != expected {
+				t.Errorf("variant %d: unexpected checkers at space %d: expected %d, got %d", variant, space, expected, got)
+			}
+		}
+		if flipped.Player1.Name != "Bob" || flipped.Player2.Name != "Alice" {
+			t.Errorf("variant %d: players were not swapped: %s vs %s", variant, flipped.Player1.Name, flipped.Player2.Name)
+		} else if flipped.Player1.Number != 1 || flipped.Player2.Number != 2 {
+			t.Errorf("variant %d: unexpected player numbers: %d vs %d", variant, flipped.Player1.Number, flipped.Player2.Number)
+		} else if flipped.Player1.Points != 3 || flipped.Player1.Entered {
+			t.Errorf("variant %d: player state was not swapped: %+v", variant, flipped.Player1)
+		} else if flipped.Turn != 1 || flipped.DoublePlayer != 2 || flipped.Winner != 0 {
+			t.Errorf("variant %d: unexpected turn %d, cube owner %d and winner %d", variant, flipped.Turn, flipped.DoublePlayer, flipped.Winner)
+		}
+
+		restored := flipPosition(flipped)
+		for space := range g.Board {
+			if g.Board[space] != original.Board[space] {
+				t.Fatalf("variant %d: original board was modified at space %d", variant, space)
+			} else if restored.Board[space] != g.Board[space] {
+				t.Fatalf("variant %d: flipping twice changed space %d: expected %d, got %d", variant, space, g.Board[space], restored.Board[space])
+			}
+		}
+		if restored.Player1.Name != "Alice" || restored.Turn != 2 || restored.DoublePlayer != 1 {
+			t.Errorf("variant %d: flipping twice did not restore the game: %+v", variant, restored)
+		}
+	}
+}
+
+func TestPracticeEngineState(t *testing.T) {
+	g := bgammon.NewGame(bgammon.VariantBackgammon)
+	g.Board[bgammon.SpaceBarOpponent] = -1
+	g.Board[1] = -1
+	g.Player1.Points, g.Player2.Points, g.Points = 1, 3, 5
+	g.Turn, g.DoublePlayer, g.DoubleValue = 2, 1, 2
+	g.Roll1, g.Roll2 = 6, 4
+
+	state := practiceEngineState(g, 1)
+	for space := 0; space < int(bgammon.BoardSpaces); space++ {
+		if state[space] != g.Board[space] {
+			t.Errorf("player 1: unexpected checkers at space %d: expected %d, got %d", space, g.Board[space], state[space])
+		}
+	}
+
+	state = practiceEngineState(g, 2)
+	flipped := flipPosition(g)
+	for space := 0; space < int(bgammon.BoardSpaces); space++ {
+		if state[space] != flipped.Board[space] {
+			t.Errorf("player 2: unexpected checkers at space %d: expected %d, got %d", space, flipped.Board[space], state[space])
+		}
+	}
+	if state[bgammon.SpaceBarPlayer] != 1 {
+		t.Errorf("player 2: checker on the bar was not moved to the bar of the player: %d", state[bgammon.SpaceBarPlayer])
+	}
+	switch {
+	case state[bei.StateRoll1] != 6 || state[bei.StateRoll2] != 4:
+		t.Errorf("unexpected roll: %d-%d", state[bei.StateRoll1], state[bei.StateRoll2])
+	case state[bei.StatePoints1] != 3 || state[bei.StatePoints2] != 1 || state[bei.StateTotalPoints] != 5:
+		t.Errorf("unexpected points: %d-%d of %d", state[bei.StatePoints1], state[bei.StatePoints2], state[bei.StateTotalPoints])
+	case state[bei.StateCubeValue] != 2 || state[bei.StateCubePlayer] != 2:
+		t.Errorf("unexpected cube: %d owned by %d", state[bei.StateCubeValue], state[bei.StateCubePlayer])
+	}
+}
+
+func TestPracticeEngineSpace(t *testing.T) {
+	testCases := []struct {
+		space    int
+		expected int8
+	}{
+		{1, 1},
+		{24, 24},
+		{int(bgammon.SpaceBarPlayer), bgammon.SpaceBarPlayer},
+		{int(bgammon.SpaceBarOpponent), bgammon.SpaceBarPlayer},
+		{int(bgammon.SpaceHomeOpponent), bgammon.SpaceHomePlayer},
+	}
+	for _, c := range testCases {
+		if got := practiceEngineSpace(c.space); got != c.expected {
+			t.Errorf("space %d: expected %d, got %d", c.space, c.expected, got)
+		}
+	}
+}
+
+// startPracticeServer connects to a practice server playing the provided
+// position and logs in. Events sent by the server are sent to the returned
+// channel.
+func startPracticeServer(t *testing.T, position *bgammon.Game) (net.Conn, chan interface{}) {
+	t.Helper()
+	beiServer := &tabula.BEIServer{}
+	engine := bot.NewLocalBEIClient(<-beiServer.ListenLocal(), true)
+	s, conn := newPracticeServer(engine, false)
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	events := make(chan interface{}, 256)
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			ev, err := bgammon.DecodeEvent(scanner.Bytes())
+			if err != nil {
+				t.Errorf("failed to decode practice event %s: %s", scanner.Bytes(), err)
+				continue
+			}
+			events <- ev
+		}
+		close(events)
+	}()
+
+	s.play(position)
+	sendPracticeCommand(t, conn, "lj test Alice")
+	return conn, events
+}
+
+func sendPracticeCommand(t *testing.T, conn net.Conn, command string) {
+	t.Helper()
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write([]byte(command + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitPracticeEvent returns the first event for which match returns true.
+func waitPracticeEvent(t *testing.T, events chan interface{}, match func(ev interface{}) bool) interface{} {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("connection closed")
+			} else if match(ev) {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestPracticeServerPlayerWins(t *testing.T) {
+	position := bgammon.NewGame(bgammon.VariantBackgammon)
+	position.Board = make([]int8, bgammon.BoardSpaces)
+	position.Board[bgammon.SpaceHomePlayer], position.Board[1] = 14, 1
+	position.Board[7] = -15
+	position.Points, position.Turn = 1, 1
+
+	conn, events := startPracticeServer(t, position)
+	ev := waitPracticeEvent(t, events, func(ev interface{}) bool {
+		b, ok := ev.(*bgammon.EventBoard)
+		return ok && b.Roll1 != 0
+	})
+	if b := ev.(*bgammon.EventBoard); b.Player1.Name != "Alice" || b.Player2.Name != practiceBotName || b.Turn != 1 {
+		t.Fatalf("unexpected board: %+v", b.Game)
+	} else if len(b.Available) == 0 {
+		t.Fatal("no moves available")
+	}
+
+	sendPracticeCommand(t, conn, "move 1/off")
+	ev = waitPracticeEvent(t, events, func(ev interface{}) bool {
+		switch ev.(type) {
+		case *bgammon.EventFailedMove, *bgammon.EventWin:
+			return true
+		}
+		return false
+	})
+	if win, ok := ev.(*bgammon.EventWin); !ok {
+		t.Fatalf("failed to move: %+v", ev)
+	} else if win.Player != "Alice" {
+		t.Errorf("unexpected winner: %s", win.Player)
+	}
+}
+
+func TestPracticeServerBotWins(t *testing.T) {
+	position := bgammon.NewGame(bgammon.VariantBackgammon)
+	position.Board = make([]int8, bgammon.BoardSpaces)
+	position.Board[bgammon.SpaceHomeOpponent], position.Board[24] = -14, -1
+	position.Board[18] = 15
+	position.Points, position.Turn = 1, 2
+
+	_, events := startPracticeServer(t, position)
+	ev := waitPracticeEvent(t, events, func(ev interface{}) bool {
+		_, ok := ev.(*bgammon.EventMoved)
+		return ok
+	})
+	moved := ev.(*bgammon.EventMoved)
+	if moved.Player != practiceBotName || len(moved.Moves) != 1 || moved.Moves[0][0] != 24 || moved.Moves[0][1] != bgammon.SpaceHomeOpponent {
+		t.Fatalf("unexpected move by %s: %v", moved.Player, moved.Moves)
+	}
+
+	ev = waitPracticeEvent(t, events, func(ev interface{}) bool {
+		_, ok := ev.(*bgammon.EventWin)
+		return ok
+	})
+	if win := ev.(*bgammon.EventWin); win.Player != practiceBotName {
+		t.Errorf("unexpected winner: %s", win.Player)
+	}
+}
+
+func TestPracticeServerResign(t *testing.T) {
+	position := bgammon.NewGame(bgammon.VariantBackgammon)
+	position.Points, position.Turn = 1, 1
+
+	conn, events := startPracticeServer(t, position)
+	waitPracticeEvent(t, events, func(ev interface{}) bool {
+		b, ok := ev.(*bgammon.EventBoard)
+		return ok && b.Roll1 != 0
+	})
+
+	sendPracticeCommand(t, conn, "resign")
+	ev := waitPracticeEvent(t, events, func(ev interface{}) bool {
+		_, ok := ev.(*bgammon.EventWin)
+		return ok
+	})
+	if win := ev.(*bgammon.EventWin); win.Player != practiceBotName || win.Resigned != "Alice" {
+		t.Errorf("unexpected win: %+v", win)
+	}
+}
+
+func TestPracticeServerUnknownEvent(t *testing.T) {
+	// Events which the practice server does not support are dropped.
+	s := &practiceServer{}
+	s.send(&bgammon.EventSay{Message: "hello"})
+}
@@ -0,0 +1,303 @@
+package game
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"strings"
+
+	"codeberg.org/tslocum/etk"
+	"codeberg.org/tslocum/gotext"
+)
+
+// ServerProfile is a named set of settings used when connecting to a server.
+type ServerProfile struct {
+	Name     string
+	Address  string
+	Username string
+	Password string `json:",omitempty"` // Only saved when requested.
+	Locale   string `json:",omitempty"`
+}
+
+type profileConfig struct {
+	Selected string // Name of the most recently used profile.
+	Profiles []*ServerProfile
+}
+
+func (c *profileConfig) index(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, p := range c.Profiles {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *profileConfig) find(name string) *ServerProfile {
+	i := c.index(name)
+	if i == -1 {
+		return nil
+	}
+	return c.Profiles[i]
+}
+
+// LoadProfile returns the server profile with the specified name, or nil when
+// no profile with the specified name exists. When no name is specified, the
+// most recently used profile is returned.
+func LoadProfile(name string) (*ServerProfile, error) {
+	config, err := loadProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server profiles: %s", err)
+	}
+	if name == "" {
+		name = config.Selected
+	}
+	return config.find(name), nil
+}
+
+// SaveProfile saves the specified server profile, replacing any existing
+// profile with the same name. The profile is selected on the connect screen
+// the next time the application starts.
+func SaveProfile(profile *ServerProfile) error {
+	config, err := loadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load server profiles: %s", err)
+	}
+	if existing := config.find(profile.Name); existing != nil {
+		*existing = *profile
+	} else {
+		config.Profiles = append(config.Profiles, profile)
+	}
+	config.Selected = profile.Name
+	err = saveProfiles(config)
+	if err != nil {
+		return fmt.Errorf("failed to save server profiles: %s", err)
+	}
+	return nil
+}
+
+// DeleteProfile deletes the server profile with the specified name.
+func DeleteProfile(name string) error {
+	config, err := loadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load server profiles: %s", err)
+	}
+	i := config.index(name)
+	if i == -1 {
+		return nil
+	}
+	config.Profiles = append(config.Profiles[:i], config.Profiles[i+1:]...)
+	if strings.EqualFold(config.Selected, name) {
+		config.Selected = ""
+	}
+	err = saveProfiles(config)
+	if err != nil {
+		return fmt.Errorf("failed to save server profiles: %s", err)
+	}
+	return nil
+}
+
+func (g *Game) createProfileDialogs() {
+	{
+		headerLabel := resizeText(gotext.Get("Server Profile"))
+		headerLabel.SetHorizontal(etk.AlignCenter)
+		headerLabel.SetVertical(etk.AlignCenter)
+
+		onConfirm := func(text string) (handled bool) {
+			g.confirmSaveProfile()
+			return false
+		}
+
+		g.profileName = &Input{etk.NewInput("", nil, onConfirm)}
+		g.profileName.SetBackground(frameColor)
+		centerInput(g.profileName)
+
+		g.profileLocale = &Input{etk.NewInput("", nil, onConfirm)}
+		g.profileLocale.SetBackground(frameColor)
+		centerInput(g.profileLocale)
+
+		g.profileSavePassword = etk.NewCheckbox(nil)
+		g.profileSavePassword.SetBorderColor(triangleA)
+		g.profileSavePassword.SetCheckColor(triangleA)
+
+		savePasswordLabel := &ClickableText{
+			Text: resizeText(gotext.Get("Save password")),
+			onSelected: func() {
+				g.profileSavePassword.SetSelected(!g.profileSavePassword.Selected())
+			},
+		}
+		savePasswordLabel.SetVertical(etk.AlignCenter)
+
+		checkboxGrid := etk.NewGrid()
+		checkboxGrid.SetColumnSizes(fieldHeight, etk.Scale(10), -1)
+		checkboxGrid.AddChildAt(g.profileSavePassword, 0, 0, 1, 1)
+		checkboxGrid.AddChildAt(savePasswordLabel, 2, 0, 1, 1)
+
+		grid := etk.NewGrid()
+		grid.SetColumnSizes(20, -1, -1, 20)
+		grid.SetRowSizes(72, fieldHeight, 20, fieldHeight, 20, fieldHeight, -1)
+		grid.AddChildAt(headerLabel, 1, 0, 2, 1)
+		grid.AddChildAt(newCenteredText(gotext.Get("Name")), 1, 1, 1, 1)
+		grid.AddChildAt(g.profileName, 2, 1, 1, 1)
+		grid.AddChildAt(newCenteredText(gotext.Get("Language")), 1, 3, 1, 1)
+		grid.AddChildAt(g.profileLocale, 2, 3, 1, 1)
+		grid.AddChildAt(checkboxGrid, 1, 5, 2, 1)
+
+		g.profileDialog = newDialog(etk.NewGrid())
+		d := g.profileDialog
+		d.SetRowSizes(-1, etk.Scale(baseButtonHeight))
+		d.AddChildAt(&withDialogBorder{grid, image.Rectangle{}}, 0, 0, 2, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("Cancel"), func() error { g.profileDialog.SetVisible(false); return nil }), 0, 1, 1, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("Save"), g.confirmSaveProfile), 1, 1, 1, 1)
+		d.SetVisible(false)
+	}
+
+	{
+		g.profileDeleteLabel = resizeText("")
+		g.profileDeleteLabel.SetHorizontal(etk.AlignCenter)
+		g.profileDeleteLabel.SetVertical(etk.AlignCenter)
+
+		grid := etk.NewGrid()
+		grid.AddChildAt(g.profileDeleteLabel, 0, 0, 1, 1)
+
+		g.profileDeleteDialog = newDialog(etk.NewGrid())
+		d := g.profileDeleteDialog
+		d.AddChildAt(&withDialogBorder{grid, image.Rectangle{}}, 0, 0, 2, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("No"), func() error { g.profileDeleteDialog.SetVisible(false); return nil }), 0, 1, 1, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("Yes"), g.confirmDeleteProfile), 1, 1, 1, 1)
+		d.SetVisible(false)
+	}
+}
+
+// selectSaveProfile shows the dialog used to save the values entered on the
+// connect screen as a server profile. When a profile is selected, it is
+// edited instead.
+func (g *Game) selectSaveProfile() error {
+	g.closeDialogs()
+	g.profileName.SetText("")
+	g.profileLocale.SetText("")
+	g.profileSavePassword.SetSelected(false)
+	if p := g.profiles.find(g.Profile); p != nil {
+		g.profileName.SetText(p.Name)
+		g.profileLocale.SetText(p.Locale)
+		g.profileSavePassword.SetSelected(p.Password != "")
+	}
+	g.profileDialog.SetVisible(true)
+	etk.SetFocus(g.profileName)
+	return nil
+}
+
+// confirmSaveProfile saves the values entered on the connect screen as a
+// server profile. The password is only saved when requested.
+func (g *Game) confirmSaveProfile() error {
+	if !g.profileDialog.Visible() {
+		return nil
+	}
+	name := strings.TrimSpace(g.profileName.Text())
+	if name == "" {
+		etk.SetFocus(g.profileName)
+		return nil
+	}
+	g.profileDialog.SetVisible(false)
+
+	p := &ServerProfile{
+		Name:     name,
+		Address:  g.ServerAddress,
+		Username: g.connectUsername.Text(),
+		Locale:   strings.TrimSpace(g.profileLocale.Text()),
+	}
+	if ShowServerSettings {
+		p.Address = g.connectServer.Text()
+	}
+	if g.profileSavePassword.Selected() {
+		p.Password = g.connectPassword.Text()
+	}
+	err := SaveProfile(p)
+	if err != nil {
+		log.Printf("warning: %s", err)
+		return nil
+	}
+	if g.Profile != "" && !strings.EqualFold(g.Profile, p.Name) {
+		// The selected profile was renamed.
+		err = DeleteProfile(g.Profile)
+		if err != nil {
+			log.Printf("warning: %s", err)
+		}
+	}
+	g.updateProfiles(p.Name)
+	g.loadProfileLocale(p)
+	return nil
+}
+
+// selectDeleteProfile asks to confirm deleting the selected server profile.
+func (g *Game) selectDeleteProfile() error {
+	p := g.profiles.find(g.Profile)
+	if p == nil {
+		return nil
+	}
+	g.closeDialogs()
+	g.profileDeleteLabel.SetText(gotext.Get("Delete server profile %s?", p.Name))
+	g.profileDeleteDialog.SetVisible(true)
+	return nil
+}
+
+func (g *Game) confirmDeleteProfile() error {
+	g.profileDeleteDialog.SetVisible(false)
+	if g.Profile == "" {
+		return nil
+	}
+	err := DeleteProfile(g.Profile)
+	if err != nil {
+		log.Printf("warning: %s", err)
+		return nil
+	}
+	g.updateProfiles("")
+	g.loadProfileLocale(nil)
+	return nil
+}
+
+// updateProfiles reloads the server profiles listed on the connect screen and
+// selects the profile with the specified name.
+func (g *Game) updateProfiles(selected string) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		log.Printf("warning: failed to load server profiles: %s", err)
+		return
+	}
+	g.profiles = profiles
+	g.Profile = ""
+
+	selectedIndex := 0
+	g.connectProfile.Clear()
+	g.connectProfile.AddOption(gotext.Get("None"))
+	for i, p := range profiles.Profiles {
+		g.connectProfile.AddOption(p.Name)
+		if strings.EqualFold(p.Name, selected) {
+			selectedIndex = i + 1
+			g.Profile = p.Name
+		}
+	}
+	g.connectProfile.SetSelectedItem(selectedIndex)
+}
+
+// loadProfileLocale translates the user interface using the locale of the
+// specified profile, or the system locale when the profile does not specify
+// one. A locale specified when starting the application takes precedence.
+// Text which is already shown is translated the next time the application
+// starts.
+func (g *Game) loadProfileLocale(p *ServerProfile) {
+	if g.Locale != "" {
+		return
+	}
+	var locale string
+	if p != nil {
+		locale = p.Locale
+	}
+	err := LoadLocale(locale)
+	if err != nil {
+		log.Printf("warning: failed to load locale: %s", err)
+	}
+}
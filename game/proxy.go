@@ -0,0 +1,11 @@
+package game
+
+import (
+	"codeberg.org/tslocum/boxcars/proxy"
+)
+
+// SetProxy configures the proxy server used when connecting to servers. See
+// proxy.Set for supported addresses.
+func SetProxy(address string) error {
+	return proxy.Set(address)
+}
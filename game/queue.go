@@ -0,0 +1,134 @@
+package game
+
+import (
+	"bytes"
+	"log"
+	"sync"
+)
+
+const maxQueuedCommands = 256
+
+// staleCommands are dropped from the outbound queue after reconnecting, as
+// they refer to a board state which may have changed while disconnected.
+var staleCommands = map[string]bool{
+	"board":   true,
+	"b":       true,
+	"double":  true,
+	"d":       true,
+	"resign":  true,
+	"roll":    true,
+	"r":       true,
+	"move":    true,
+	"mv":      true,
+	"m":       true,
+	"reset":   true,
+	"ok":      true,
+	"k":       true,
+	"rematch": true,
+	"rm":      true,
+	"pong":    true,
+	"join":    true, // The match is rejoined automatically after reconnecting.
+	"j":       true,
+}
+
+// queuedCommand is a command waiting to be sent to the server.
+type queuedCommand struct {
+	command []byte
+	probe   bool // Whether the command was queued to measure latency.
+}
+
+// commandQueue is a bounded queue of commands waiting to be sent to the
+// server. Commands are held while the client is disconnected.
+type commandQueue struct {
+	commands []queuedCommand
+	ready    chan struct{}
+	*sync.Mutex
+}
+
+func newCommandQueue() *commandQueue {
+	return &commandQueue{
+		ready: make(chan struct{}, 1),
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (q *commandQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push adds a command to the end of the queue. When the queue is full the
+// oldest command is dropped.
+func (q *commandQueue) push(command []byte) {
+	q.add(queuedCommand{command: command})
+}
+
+// pushProbe adds a command sent to measure latency to the end of the queue.
+func (q *commandQueue) pushProbe(command []byte) {
+	q.add(queuedCommand{command: command, probe: true})
+}
+
+func (q *commandQueue) add(c queuedCommand) {
+	q.Lock()
+	if len(q.commands) == maxQueuedCommands {
+		log.Printf("warning: outbound command queue is full, dropping command: %s", q.commands[0].command)
+		q.commands = q.commands[1:]
+	}
+	q.commands = append(q.commands, c)
+	q.Unlock()
+
+	q.signal()
+}
+
+// pushFront returns a command which failed to send to the front of the queue.
+func (q *commandQueue) pushFront(c queuedCommand) {
+	q.Lock()
+	if len(q.commands) < maxQueuedCommands {
+		q.commands = append([]queuedCommand{c}, q.commands...)
+	}
+	q.Unlock()
+
+	q.signal()
+}
+
+// pop removes the first command from the queue. It returns false when the
+// queue is empty.
+func (q *commandQueue) pop() (queuedCommand, bool) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.commands) == 0 {
+		return queuedCommand{}, false
+	}
+	c := q.commands[0]
+	q.commands[0] = queuedCommand{}
+	q.commands = q.commands[1:]
+	return c, true
+}
+
+// dropStale removes commands which should not be replayed after reconnecting.
+func (q *commandQueue) dropStale() {
+	q.Lock()
+	defer q.Unlock()
+
+	commands := q.commands[:0]
+	for _, c := range q.commands {
+		name := c.command
+		if i := bytes.IndexByte(c.command, ' '); i != -1 {
+			name = c.command[:i]
+		}
+		if c.probe || staleCommands[string(bytes.ToLower(name))] {
+			if Debug > 0 {
+				log.Printf("dropping stale command: %s", c.command)
+			}
+			continue
+		}
+		commands = append(commands, c)
+	}
+	for i := len(commands); i < len(q.commands); i++ {
+		q.commands[i] = queuedCommand{}
+	}
+	q.commands = commands
+}
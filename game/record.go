@@ -0,0 +1,212 @@
+package game
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionHeader = "boxcars-session"
+
+// Session files begin with a header line containing the time recording
+// started. Each following line contains the number of milliseconds elapsed
+// since recording started, the direction of the message (-> for commands
+// sent to the server and <- for events received from the server) and the
+// message itself.
+//
+//	boxcars-session 1700000000
+//	0 -> lj boxcars-v1.5.0/en player ***
+//	42 <- {"Type":"welcome","Player":"","PlayerName":"player",...}
+
+var recorder *sessionRecorder
+
+func init() {
+	RegisterTransport("playback", newPlaybackTransport)
+}
+
+type sessionRecorder struct {
+	f       *os.File
+	started time.Time
+	*sync.Mutex
+}
+
+// RecordSession records all commands sent to and events received from the
+// server to the specified session file.
+func RecordSession(filePath string) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	r := &sessionRecorder{
+		f:       f,
+		started: time.Now(),
+		Mutex:   &sync.Mutex{},
+	}
+	_, err = fmt.Fprintf(f, "%s %d\n", sessionHeader, r.started.Unix())
+	if err != nil {
+		f.Close()
+		return err
+	}
+	recorder = r
+	return nil
+}
+
+func (r *sessionRecorder) record(direction string, message []byte) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+
+	_, err := fmt.Fprintf(r.f, "%d %s %s\n", time.Since(r.started).Milliseconds(), direction, message)
+	if err != nil {
+		log.Printf("warning: failed to record session: %s", err)
+	}
+}
+
+// redactCommand removes passwords from commands before they are recorded.
+func redactCommand(command []byte) []byte {
+	split := bytes.Split(command, []byte(" "))
+	var keep int
+	switch string(bytes.ToLower(split[0])) {
+	case "lj", "loginjson", "login":
+		keep = 3
+	case "rj", "registerjson", "register":
+		keep = 4
+	case "password":
+		keep = 1
+	default:
+		return command
+	}
+	if len(split) <= keep {
+		return command
+	}
+	redacted := append([][]byte{}, split[:keep]...)
+	for range split[keep:] {
+		redacted = append(redacted, []byte("***"))
+	}
+	return bytes.Join(redacted, []byte(" "))
+}
+
+type sessionEvent struct {
+	offset time.Duration
+	event  []byte
+}
+
+// playbackTransport is a Transport which plays back the events recorded in a
+// session file. Commands written to the transport are discarded.
+type playbackTransport struct {
+	events []sessionEvent
+	index  int
+	start  time.Time
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func newPlaybackTransport() Transport {
+	return &playbackTransport{
+		closed: make(chan struct{}),
+		once:   &sync.Once{},
+	}
+}
+
+// PlaybackAddress returns the server address used to play back a session file.
+func PlaybackAddress(filePath string) string {
+	return "playback://" + filePath
+}
+
+func (t *playbackTransport) Dial(ctx context.Context, address string) error {
+	filePath := strings.TrimPrefix(address, "playback://")
+	events, err := readSession(filePath)
+	if err != nil {
+		return err
+	}
+	t.events = events
+	t.start = time.Now()
+	if len(events) != 0 {
+		// Begin playback with the first recorded event.
+		t.start = t.start.Add(-events[0].offset)
+	}
+	return nil
+}
+
+func readSession(filePath string) ([]sessionEvent, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []sessionEvent
+	var lineNumber int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024*10)
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Bytes()
+		if lineNumber == 1 {
+			if !bytes.HasPrefix(line, []byte(sessionHeader)) {
+				return nil, fmt.Errorf("failed to read session file %s: invalid header", filePath)
+			}
+			continue
+		}
+		split := bytes.SplitN(line, []byte(" "), 3)
+		if len(split) < 3 {
+			return nil, fmt.Errorf("failed to read session file %s: failed to parse line %d", filePath, lineNumber)
+		}
+		offset, err := strconv.ParseInt(string(split[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session file %s: failed to parse line %d", filePath, lineNumber)
+		}
+		if !bytes.Equal(split[1], []byte("<-")) {
+			continue
+		}
+		events = append(events, sessionEvent{
+			offset: time.Duration(offset) * time.Millisecond,
+			event:  bytes.Clone(split[2]),
+		})
+	}
+	if scanner.Err() != nil {
+		return nil, fmt.Errorf("failed to read session file %s: %s", filePath, scanner.Err())
+	}
+	return events, nil
+}
+
+func (t *playbackTransport) ReadEvent() ([]byte, error) {
+	if t.index >= len(t.events) {
+		return nil, ErrSessionEnded
+	}
+
+	ev := t.events[t.index]
+	t.index++
+
+	select {
+	case <-time.After(time.Until(t.start.Add(ev.offset))):
+	case <-t.closed:
+		return nil, ErrSessionEnded
+	}
+	return ev.event, nil
+}
+
+func (t *playbackTransport) WriteLine(line []byte) error {
+	select {
+	case <-t.closed:
+		return fmt.Errorf("connection closed")
+	default:
+	}
+	return nil
+}
+
+func (t *playbackTransport) Close() error {
+	t.once.Do(func() {
+		close(t.closed)
+	})
+	return nil
+}
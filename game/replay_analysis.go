@@ -0,0 +1,246 @@
+package game
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/replay"
+	"codeberg.org/tslocum/gotext"
+	"codeberg.org/tslocum/tabula"
+)
+
+// Move ratings assigned by replay analysis.
+const (
+	moveBest = iota
+	moveInaccuracy
+	moveBlunder
+)
+
+// blunderLoss is the evaluation score which must be lost for a move to be
+// rated as a blunder.
+const blunderLoss = 200
+
+// moveAnalysis is the engine's judgement of a move played in a replay. Losses
+// are measured in tabula evaluation score, where lower scores are better.
+type moveAnalysis struct {
+	Rating int
+	Loss   float64
+	Best   [][]int8 // Move preferred by the engine. Spaces are absolute.
+}
+
+// replayAnalysisResult is the analysis of a move played in a replay.
+type replayAnalysisResult struct {
+	frame    *replayFrame
+	analysis *moveAnalysis
+}
+
+// analyzeReplay analyzes each move of the replay in a pool of workers. The
+// analysis of each move is sent to the UI goroutine, which shows the rating
+// of each move in the replay list as it is analyzed.
+func (g *Game) analyzeReplay() {
+	if !g.replay || g.replayAnalysis != nil {
+		return
+	}
+	var frames []*replayFrame
+	for _, frame := range g.replayFrames {
+		if _, ok := frame.Record.(*replay.Roll); ok && frame.Analysis == nil {
+			frames = append(frames, frame)
+		}
+	}
+	results := make(chan *replayAnalysisResult, len(frames))
+	g.replayAnalysis = results
+
+	g.board.replayAnalyzeButton.SetText(gotext.Get("Analyzing..."))
+	scheduleFrame()
+
+	go func() {
+		jobs := make(chan *replayFrame)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < runtime.NumCPU(); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				buf := make([]*tabula.Analysis, 0, tabula.AnalysisBufferSize)
+				for frame := range jobs {
+					a := analyzeMove(frame.Game, frame.Record.(*replay.Roll), &buf)
+					if a == nil {
+						continue
+					}
+					results <- &replayAnalysisResult{
+						frame:    frame,
+						analysis: a,
+					}
+					scheduleFrame()
+				}
+			}()
+		}
+		for _, frame := range frames {
+			g.Lock()
+			replaying := g.replay
+			g.Unlock()
+			if !replaying {
+				break
+			}
+			jobs <- frame
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+		scheduleFrame()
+	}()
+}
+
+// updateReplayAnalysis shows the analysis of the moves which have been
+// analyzed since the last update.
+func (g *Game) updateReplayAnalysis() {
+	for g.replayAnalysis != nil {
+		select {
+		case result, ok := <-g.replayAnalysis:
+			if !ok {
+				g.replayAnalysis = nil
+				g.board.replayAnalyzeButton.SetText(gotext.Get("Analyze"))
+				if g.replay {
+					ls("*** " + gotext.Get("Analysis complete."))
+				}
+				return
+			}
+			result.frame.setAnalysis(result.analysis)
+		default:
+			return
+		}
+	}
+}
+
+// analyzeMove compares the move played with the moves available to the player
+// rolling. Nil is returned when no move was available.
+func analyzeMove(g *bgammon.Game, roll *replay.Roll, buf *[]*tabula.Analysis) *moveAnalysis {
+	game := g.Copy(true)
+	game.Roll1, game.Roll2, game.Roll3 = roll.Roll1, roll.Roll2, roll.Roll3
+	played := game.Copy(true)
+	if roll.Apply(played) != nil {
+		return nil
+	}
+	// The player rolling is always player 1 in the boards analyzed.
+	if roll.Player == 2 {
+		game, played = flipPosition(game), flipPosition(played)
+	}
+	b, playedBoard := tabulaBoard(game, game.Board), tabulaBoard(played, played.Board)
+
+	available, boards := b.Available(1)
+	if len(available) == 0 {
+		return nil
+	}
+	b.Analyze(available, buf, false)
+	if len(*buf) == 0 {
+		return nil
+	}
+
+	// Find the highest ranked analysis which results in the board played.
+	playedIndex := -1
+	for i, a := range *buf {
+		for j, moves := range available {
+			if tabula.MovesEqual(moves, a.Moves) && [28]int8(boards[j][:28]) == [28]int8(playedBoard[:28]) {
+				playedIndex = i
+				break
+			}
+		}
+		if playedIndex != -1 {
+			break
+		}
+	}
+	if playedIndex == -1 {
+		return nil
+	}
+
+	// Moves which end contact are evaluated as a race, and their scores are
+	// not comparable with the scores of moves which keep contact. The move
+	// played is compared with the highest ranked move of the same kind.
+	playedAnalysis := (*buf)[playedIndex]
+	bestIndex := playedIndex
+	for i, a := range (*buf)[:playedIndex] {
+		if a.Past == playedAnalysis.Past {
+			bestIndex = i
+			break
+		}
+	}
+	best := (*buf)[bestIndex]
+	result := &moveAnalysis{}
+	for _, move := range best.Moves {
+		if move[0] == 0 && move[1] == 0 {
+			break
+		}
+		result.Best = append(result.Best, []int8{bgammon.FlipSpace(move[0], roll.Player, g.Variant), bgammon.FlipSpace(move[1], roll.Player, g.Variant)})
+	}
+	if bestIndex == playedIndex {
+		return result
+	}
+
+	// Book moves and moves which end contact are prioritized by adjusting
+	// their score, so losses are calculated using the unadjusted scores.
+	result.Loss = analysisScore(playedAnalysis) - analysisScore(best)
+	if result.Loss < 0 {
+		result.Loss = 0
+	}
+	result.Rating = moveInaccuracy
+	if result.Loss >= blunderLoss {
+		result.Rating = moveBlunder
+	}
+	return result
+}
+
+// analysisScore returns the score of an analysis before any prioritization.
+func analysisScore(a *tabula.Analysis) float64 {
+	return a.PlayerScore + a.OppScore*tabula.WeightOppScore
+}
+
+// setAnalysis sets the analysis of the move played and shows its rating in
+// the replay list.
+func (f *replayFrame) setAnalysis(a *moveAnalysis) {
+	f.Analysis = a
+	if f.moveLabel == nil {
+		return
+	}
+	switch a.Rating {
+	case moveBest:
+		f.moveLabel.SetForeground(moveBestColor)
+	case moveInaccuracy:
+		f.moveLabel.SetForeground(moveInaccuracyColor)
+		f.analysisLabel.SetForeground(moveInaccuracyColor)
+		f.analysisLabel.SetText(fmt.Sprintf("? -%.0f", a.Loss))
+	case moveBlunder:
+		f.moveLabel.SetForeground(moveBlunderColor)
+		f.analysisLabel.SetForeground(moveBlunderColor)
+		f.analysisLabel.SetText(fmt.Sprintf("?? -%.0f", a.Loss))
+	}
+}
+
+// showAnalysis prints the analysis of the move played.
+func (f *replayFrame) showAnalysis() {
+	a := f.Analysis
+	if a == nil {
+		return
+	}
+	roll := f.Record.(*replay.Roll)
+	switch a.Rating {
+	case moveBest:
+		ls("*** " + gotext.Get("%s played the best move.", f.playerName(roll.Player)))
+	default:
+		ls("*** " + gotext.Get("%s played %s (-%.0f). Best move: %s", f.playerName(roll.Player), formatAnalysisMoves(roll.Moves), a.Loss, formatAnalysisMoves(a.Best)))
+	}
+}
+
+func (f *replayFrame) playerName(player int8) string {
+	if player == 2 {
+		return f.Game.Player2.Name
+	}
+	return f.Game.Player1.Name
+}
+
+func formatAnalysisMoves(moves [][]int8) string {
+	if len(moves) == 0 {
+		return gotext.Get("none")
+	}
+	return string(bgammon.FormatMoves(moves))
+}
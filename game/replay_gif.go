@@ -0,0 +1,68 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/render"
+	"codeberg.org/tslocum/gotext"
+)
+
+// Limits of the size and frame delay of GIF images exported from a replay.
+const (
+	minGIFSize  = 100
+	maxGIFSize  = 4096
+	minGIFDelay = 10 * time.Millisecond
+)
+
+// exportReplayGIF draws each frame of the replay as an animated GIF of the
+// provided size and frame delay and saves it to the replay directory.
+func (g *Game) exportReplayGIF(width int, height int, delay time.Duration) {
+	g.Lock()
+	if !g.replay || g.replayExporting || len(g.replayFrames) == 0 {
+		g.Unlock()
+		return
+	}
+	g.replayExporting = true
+	frames := make([]*bgammon.Game, len(g.replayFrames))
+	for i, frame := range g.replayFrames {
+		frames[i] = frame.Game
+	}
+	options := &render.GIFOptions{
+		Width:  width,
+		Height: height,
+		Delay:  delay,
+		Motion: !g.Instant,
+	}
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		g.replayExporting = false
+		g.Unlock()
+	}()
+
+	ls("*** " + gotext.Get("Exporting replay as GIF..."))
+
+	buf := &bytes.Buffer{}
+	err := render.EncodeGIF(buf, frames, options)
+	if err != nil {
+		ls("*** " + gotext.Get("Failed to export replay: %s", err))
+		return
+	}
+
+	first := frames[0]
+	replayDir := ReplayDir()
+	_ = os.MkdirAll(replayDir, 0700)
+	filePath := path.Join(replayDir, fmt.Sprintf("%d_%s_%s.gif", first.Started, first.Player1.Name, first.Player2.Name))
+	err = os.WriteFile(filePath, buf.Bytes(), 0600)
+	if err != nil {
+		ls("*** " + gotext.Get("Failed to export replay: %s", err))
+		return
+	}
+	ls(fmt.Sprintf("*** %s: %s", gotext.Get("Exported replay"), filePath))
+}
@@ -0,0 +1,471 @@
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/boxcars/replay"
+	"codeberg.org/tslocum/etk"
+	"codeberg.org/tslocum/gotext"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Results of saved replays, from the perspective of the player who saved the
+// replay.
+const (
+	replayResultWon = iota
+	replayResultLost
+	replayResultUnfinished
+)
+
+// Orders in which saved replays are listed.
+const (
+	replaySortDate = iota
+	replaySortOpponent
+	replaySortVariant
+	replaySortResult
+)
+
+// replayEntry is a replay saved in the replay directory.
+type replayEntry struct {
+	path     string
+	started  time.Time
+	opponent string
+	variant  int8
+	score    [2]int8 // Final score of the player and the opponent.
+	result   int
+	err      error // Error encountered while reading the last game, if any.
+}
+
+// loadReplayEntry reads the players, variant and result of a saved replay.
+// Replays are saved with the name of the player who saved the replay first.
+func loadReplayEntry(filePath string) (*replayEntry, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err = replay.Import(data)
+	if err != nil {
+		return nil, err
+	}
+	m, err := replay.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	first, last := m.Games[0].Header, m.Games[len(m.Games)-1]
+
+	e := &replayEntry{
+		path:     filePath,
+		started:  time.Unix(first.Started, 0),
+		opponent: first.Player2,
+		variant:  first.Variant,
+		result:   replayResultUnfinished,
+	}
+	if first.Started == 0 {
+		if info, err := os.Stat(filePath); err == nil {
+			e.started = info.ModTime()
+		}
+	}
+	player := int8(1)
+	name := path.Base(filePath)
+	if _, after, ok := strings.Cut(name, "_"); ok && strings.HasPrefix(after, first.Player2+"_") && !strings.HasPrefix(after, first.Player1+"_") {
+		player, e.opponent = 2, first.Player1
+	}
+
+	scores := [2]int8{last.Header.Score1, last.Header.Score2}
+	frames, err := last.Frames()
+	if err != nil {
+		// The replay is still listed, as the moves before the error may be
+		// viewed.
+		e.err = fmt.Errorf("failed to read game %d: %s", len(m.Games), err)
+	} else if winner, points := last.Result(frames[len(frames)-1], nil); winner != 0 {
+		scores[winner-1] += points
+	}
+	e.score = [2]int8{scores[player-1], scores[2-player]}
+	switch {
+	case e.score[0] >= first.Points:
+		e.result = replayResultWon
+	case e.score[1] >= first.Points:
+		e.result = replayResultLost
+	}
+	return e, nil
+}
+
+// replayLibrary is the screen which lists the replays saved in the replay
+// directory. It is available without connecting to a server.
+type replayLibrary struct {
+	entries []*replayEntry
+	shown   []*replayEntry // Entries matching the filters, in the selected order.
+
+	opponent *Input
+	variant  *etk.Select
+	result   *etk.Select
+	date     *etk.Select
+	order    *etk.Select
+
+	variantFilter int // Index of the selected variant filter option.
+	resultFilter  int
+	dateFilter    int
+	sortOrder     int
+
+	list         *etk.List
+	deleteDialog *Dialog
+	deleteLabel  *etk.Text
+	frame        *etk.Frame
+
+	*sync.Mutex
+}
+
+func newReplayLibrary() *replayLibrary {
+	l := &replayLibrary{
+		Mutex: &sync.Mutex{},
+	}
+
+	newSelect := func(set *int, options ...string) *etk.Select {
+		s := etk.NewSelect(game.itemHeight(), func(index int) (accept bool) {
+			*set = index
+			l.refresh()
+			return true
+		})
+		s.SetHighlightColor(color.RGBA{191, 156, 94, 255})
+		for _, option := range options {
+			s.AddOption(option)
+		}
+		return s
+	}
+	l.opponent = &Input{etk.NewInput("", func(text string, r rune) (accept bool) {
+		go l.refresh()
+		return true
+	}, nil)}
+	centerInput(l.opponent)
+	l.opponent.SetScrollBarVisible(false)
+	l.variant = newSelect(&l.variantFilter, gotext.Get("All variants"), gotext.Get("Backgammon"), gotext.Get("Acey-deucey"), gotext.Get("Tabula"))
+	l.result = newSelect(&l.resultFilter, gotext.Get("All results"), gotext.Get("Won"), gotext.Get("Lost"), gotext.Get("Unfinished"))
+	l.date = newSelect(&l.dateFilter, gotext.Get("Any date"), gotext.Get("Past week"), gotext.Get("Past month"), gotext.Get("Past year"))
+	l.order = newSelect(&l.sortOrder, gotext.Get("Sort by date"), gotext.Get("Sort by opponent"), gotext.Get("Sort by variant"), gotext.Get("Sort by result"))
+
+	filterGrid := etk.NewGrid()
+	filterGrid.SetColumnPadding(etk.Scale(5))
+	filterGrid.SetColumnSizes(-1, etk.Scale(250), etk.Scale(250), etk.Scale(250), etk.Scale(250))
+	filterGrid.AddChildAt(l.opponent, 0, 0, 1, 1)
+	filterGrid.AddChildAt(l.variant, 1, 0, 1, 1)
+	filterGrid.AddChildAt(l.result, 2, 0, 1, 1)
+	filterGrid.AddChildAt(l.date, 3, 0, 1, 1)
+	filterGrid.AddChildAt(l.order, 4, 0, 1, 1)
+
+	indentA, indentB := etk.Scale(lobbyIndentA), etk.Scale(lobbyIndentB)
+	columnSizes := []int{int(float64(indentA) * 1.25), -1, indentB - indentA, int(float64(indentB) * 1.25)}
+
+	backgroundBox := etk.NewBox()
+	backgroundBox.SetBackground(bufferBackgroundColor)
+	headerGrid := etk.NewGrid()
+	headerGrid.SetColumnSizes(columnSizes...)
+	headerGrid.AddChildAt(backgroundBox, 0, 0, 4, 1)
+	for i, label := range []string{gotext.Get("Date"), gotext.Get("Opponent"), gotext.Get("Variant"), gotext.Get("Result")} {
+		t := newCenteredText(label)
+		t.SetFollow(false)
+		t.SetScrollBarVisible(false)
+		headerGrid.AddChildAt(t, i, 0, 1, 1)
+	}
+
+	dividerLine := etk.NewBox()
+	dividerLine.SetBackground(bufferTextColor)
+
+	l.list = etk.NewList(game.itemHeight(), nil, func(index int) {
+		l.selectOpen()
+	})
+	l.list.SetColumnSizes(columnSizes...)
+	l.list.SetHighlightColor(color.RGBA{79, 55, 30, 255})
+	l.list.SetBackground(frameColor)
+	l.list.SetScrollBarWidth(etk.Scale(32))
+	l.list.SetScrollBarColors(etk.Style.ScrollAreaColor, etk.Style.ScrollHandleColor)
+
+	buttonGrid := etk.NewGrid()
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Return"), l.selectReturn), 0, 0, 1, 1)
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Delete"), l.selectDelete), 1, 0, 1, 1)
+	buttonGrid.AddChildAt(etk.NewButton(gotext.Get("Open"), l.selectOpen), 2, 0, 1, 1)
+
+	{
+		l.deleteLabel = resizeText("")
+		l.deleteLabel.SetHorizontal(etk.AlignCenter)
+		l.deleteLabel.SetVertical(etk.AlignCenter)
+
+		grid := etk.NewGrid()
+		grid.AddChildAt(l.deleteLabel, 0, 0, 1, 1)
+
+		l.deleteDialog = newDialog(etk.NewGrid())
+		d := l.deleteDialog
+		d.AddChildAt(&withDialogBorder{grid, image.Rectangle{}}, 0, 0, 2, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("No"), func() error { l.deleteDialog.SetVisible(false); return nil }), 0, 1, 1, 1)
+		d.AddChildAt(etk.NewButton(gotext.Get("Yes"), l.confirmDelete), 1, 1, 1, 1)
+		d.SetVisible(false)
+	}
+
+	container := etk.NewGrid()
+	container.SetBackground(bufferBackgroundColor)
+	container.SetRowSizes(game.itemHeight(), game.itemHeight(), 2, -1, etk.Scale(baseButtonHeight*2), etk.Scale(baseButtonHeight))
+	container.AddChildAt(filterGrid, 0, 0, 1, 1)
+	container.AddChildAt(headerGrid, 0, 1, 1, 1)
+	container.AddChildAt(dividerLine, 0, 2, 1, 1)
+	container.AddChildAt(l.list, 0, 3, 1, 1)
+	container.AddChildAt(statusBuffer, 0, 4, 1, 1)
+	container.AddChildAt(buttonGrid, 0, 5, 1, 1)
+
+	l.frame = etk.NewFrame()
+	l.frame.SetPositionChildren(true)
+	l.frame.AddChild(container)
+	l.frame.AddChild(etk.NewFrame(l.deleteDialog))
+	for _, s := range []*etk.Select{l.variant, l.result, l.date, l.order} {
+		l.frame.AddChild(etk.NewFrame(s.Children()...))
+	}
+	return l
+}
+
+// load indexes the replay directory.
+func (l *replayLibrary) load() {
+	var entries []*replayEntry
+	replayDir := ReplayDir()
+	files, err := os.ReadDir(replayDir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("warning: failed to read replay directory %s: %s", replayDir, err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		switch path.Ext(file.Name()) {
+		case ".match", ".mat", ".txt", ".sgf":
+		default:
+			continue
+		}
+		e, err := loadReplayEntry(path.Join(replayDir, file.Name()))
+		if err != nil {
+			log.Printf("warning: failed to read replay %s: %s", file.Name(), err)
+			continue
+		} else if e.err != nil {
+			log.Printf("warning: failed to read replay %s: %s", file.Name(), e.err)
+		}
+		entries = append(entries, e)
+	}
+
+	l.Lock()
+	l.entries = entries
+	l.Unlock()
+	l.refresh()
+}
+
+// refresh lists the entries which match the selected filters in the selected
+// order.
+func (l *replayLibrary) refresh() {
+	l.Lock()
+	defer l.Unlock()
+
+	opponent := strings.ToLower(strings.TrimSpace(l.opponent.Text()))
+	var since time.Time
+	switch l.dateFilter {
+	case 1:
+		since = time.Now().AddDate(0, 0, -7)
+	case 2:
+		since = time.Now().AddDate(0, -1, 0)
+	case 3:
+		since = time.Now().AddDate(-1, 0, 0)
+	}
+
+	l.shown = l.shown[:0]
+	for _, e := range l.entries {
+		if opponent != "" && !strings.Contains(strings.ToLower(e.opponent), opponent) {
+			continue
+		} else if l.variantFilter != 0 && e.variant != int8(l.variantFilter-1) {
+			continue
+		} else if l.resultFilter != 0 && e.result != l.resultFilter-1 {
+			continue
+		} else if !since.IsZero() && e.started.Before(since) {
+			continue
+		}
+		l.shown = append(l.shown, e)
+	}
+	sort.SliceStable(l.shown, func(i, j int) bool {
+		a, b := l.shown[i], l.shown[j]
+		switch l.sortOrder {
+		case replaySortOpponent:
+			if !strings.EqualFold(a.opponent, b.opponent) {
+				return strings.ToLower(a.opponent) < strings.ToLower(b.opponent)
+			}
+		case replaySortVariant:
+			if a.variant != b.variant {
+				return a.variant < b.variant
+			}
+		case replaySortResult:
+			if a.result != b.result {
+				return a.result < b.result
+			}
+		}
+		return a.started.After(b.started)
+	})
+
+	l.list.Clear()
+	if len(l.shown) == 0 {
+		l.list.SetSelectionMode(etk.SelectNone)
+		l.list.AddChildAt(newCenteredText(gotext.Get("No replays found.")), 1, 0)
+		scheduleFrame()
+		return
+	}
+	l.list.SetSelectionMode(etk.SelectRow)
+	for y, e := range l.shown {
+		var result string
+		switch {
+		case e.err != nil:
+			result = gotext.Get("Invalid")
+		case e.result == replayResultWon:
+			result = gotext.Get("Won %d-%d", e.score[0], e.score[1])
+		case e.result == replayResultLost:
+			result = gotext.Get("Lost %d-%d", e.score[0], e.score[1])
+		default:
+			result = fmt.Sprintf("%d-%d", e.score[0], e.score[1])
+		}
+		l.list.AddChildAt(newCenteredText(e.started.Format("2006-01-02")), 0, y)
+		l.list.AddChildAt(newCenteredText(e.opponent), 1, y)
+		l.list.AddChildAt(newCenteredText(variantLabel(e.variant)), 2, y)
+		l.list.AddChildAt(newCenteredText(result), 3, y)
+	}
+	l.list.SetSelectedItem(0, 0)
+	scheduleFrame()
+}
+
+func (l *replayLibrary) selected() *replayEntry {
+	l.Lock()
+	defer l.Unlock()
+
+	_, y := l.list.SelectedItem()
+	if y < 0 || y >= len(l.shown) {
+		return nil
+	}
+	return l.shown[y]
+}
+
+func (l *replayLibrary) selectReturn() error {
+	l.deleteDialog.SetVisible(false)
+	for _, s := range []*etk.Select{l.variant, l.result, l.date, l.order} {
+		s.SetMenuVisible(false)
+	}
+	game.setRoot(connectFrame)
+	return nil
+}
+
+func (l *replayLibrary) selectOpen() error {
+	e := l.selected()
+	if e == nil {
+		return nil
+	}
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		ls("*** " + gotext.Get("Failed to open replay: %s", err))
+		return nil
+	}
+	go game.HandleReplay(data)
+	return nil
+}
+
+func (l *replayLibrary) selectDelete() error {
+	e := l.selected()
+	if e == nil {
+		return nil
+	}
+	l.deleteLabel.SetText(gotext.Get("Delete replay against %s?", e.opponent))
+	l.deleteDialog.SetVisible(true)
+	return nil
+}
+
+func (l *replayLibrary) confirmDelete() error {
+	l.deleteDialog.SetVisible(false)
+	e := l.selected()
+	if e == nil {
+		return nil
+	}
+	err := os.Remove(e.path)
+	if err != nil {
+		ls("*** " + gotext.Get("Failed to delete replay: %s", err))
+		return nil
+	}
+	go l.load()
+	return nil
+}
+
+// handleKeys handles keyboard input while the replay library is shown.
+func (l *replayLibrary) handleKeys(keys []ebiten.Key) {
+	for _, key := range keys {
+		switch key {
+		case ebiten.KeyEnter, ebiten.KeyKPEnter:
+			if l.deleteDialog.Visible() {
+				l.confirmDelete()
+			} else {
+				l.selectOpen()
+			}
+		case ebiten.KeyEscape:
+			if l.deleteDialog.Visible() {
+				l.deleteDialog.SetVisible(false)
+			} else {
+				l.selectReturn()
+			}
+		case ebiten.KeyDelete:
+			l.selectDelete()
+		}
+	}
+}
+
+// layout positions the dialogs of the replay library.
+func (l *replayLibrary) layout() {
+	dialogWidth := etk.Scale(650)
+	if dialogWidth > game.screenW {
+		dialogWidth = game.screenW
+	}
+	dialogHeight := etk.Scale(baseButtonHeight) * 2
+	if dialogHeight > game.screenH {
+		dialogHeight = game.screenH
+	}
+	x, y := game.screenW/2-dialogWidth/2, game.screenH/2-dialogHeight/2
+	if x < 0 {
+		x = 0
+	}
+	if y < 0 {
+		y = 0
+	}
+	l.deleteDialog.SetRect(image.Rect(x, y, x+dialogWidth, y+dialogHeight))
+}
+
+// showReplayLibrary shows the replays saved in the replay directory.
+func (g *Game) showReplayLibrary() error {
+	go hideKeyboard()
+	if g.loggedIn {
+		return nil
+	}
+	if g.replayLibrary == nil {
+		g.replayLibrary = newReplayLibrary()
+		g.replayLibrary.layout()
+	}
+	g.setRoot(g.replayLibrary.frame)
+	etk.SetFocus(g.replayLibrary.list)
+	go g.replayLibrary.load()
+	return nil
+}
+
+func variantLabel(variant int8) string {
+	switch variant {
+	case bgammon.VariantAceyDeucey:
+		return gotext.Get("Acey-deucey")
+	case bgammon.VariantTabula:
+		return gotext.Get("Tabula")
+	default:
+		return gotext.Get("Backgammon")
+	}
+}
@@ -0,0 +1,113 @@
+package game
+
+import (
+	"image"
+	"image/color"
+	"time"
+
+	"codeberg.org/tslocum/boxcars/replay"
+	"codeberg.org/tslocum/etk"
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// replayAutoDelay is the delay between frames when autoplaying a replay at
+// normal speed.
+const replayAutoDelay = 3 * time.Second
+
+// replaySpeeds are the autoplay speeds which may be selected.
+var replaySpeeds = []float64{0.25, 0.5, 1, 2, 4}
+
+// replaySpeedNormal is the index of the normal autoplay speed.
+const replaySpeedNormal = 2
+
+// replayTimeline is a track showing the position of the current replay frame.
+// The start of each game and each cube action are marked on the track. Clicking
+// or dragging along the track jumps to the frame under the cursor.
+type replayTimeline struct {
+	*etk.Box
+}
+
+func newReplayTimeline() *replayTimeline {
+	return &replayTimeline{
+		Box: etk.NewBox(),
+	}
+}
+
+// bounds returns the horizontal range of the track.
+func (t *replayTimeline) bounds() (left int, right int) {
+	r := t.Rect()
+	padding := etk.Scale(8)
+	return r.Min.X + padding, r.Max.X - padding
+}
+
+// frameX returns the position of a frame along the track.
+func (t *replayTimeline) frameX(frame int, frames int) int {
+	left, right := t.bounds()
+	if frames < 2 {
+		return left
+	}
+	return left + frame*(right-left)/(frames-1)
+}
+
+// frameAt returns the frame nearest to a position along the track.
+func (t *replayTimeline) frameAt(x int, frames int) int {
+	left, right := t.bounds()
+	if right <= left || frames < 2 {
+		return 0
+	}
+	frame := ((x-left)*(frames-1) + (right-left)/2) / (right - left)
+	if frame < 0 {
+		return 0
+	} else if frame > frames-1 {
+		return frames - 1
+	}
+	return frame
+}
+
+func (t *replayTimeline) Cursor() ebiten.CursorShapeType {
+	return ebiten.CursorShapePointer
+}
+
+func (t *replayTimeline) HandleMouse(cursor image.Point, pressed bool, clicked bool) (handled bool, err error) {
+	if (!pressed && !clicked) || !game.replay || len(game.replayFrames) < 2 {
+		return false, nil
+	}
+	frame := t.frameAt(cursor.X, len(game.replayFrames))
+	if frame != game.replayFrame || !game.board.replayAuto.IsZero() {
+		game.board.seekReplay(frame)
+	}
+	return true, nil
+}
+
+func (t *replayTimeline) Draw(screen *ebiten.Image) error {
+	r := t.Rect()
+	frames := game.replayFrames
+	if !game.replay || len(frames) < 2 || r.Empty() {
+		return nil
+	}
+	fill := func(rect image.Rectangle, c color.Color) {
+		screen.SubImage(rect).(*ebiten.Image).Fill(c)
+	}
+
+	left, right := t.bounds()
+	middle := r.Min.Y + r.Dy()/2
+	trackSize := etk.Scale(4)
+	current := t.frameX(game.replayFrame, len(frames))
+	fill(image.Rect(left, middle-trackSize/2, right, middle+trackSize/2), etk.Style.ScrollAreaColor)
+	fill(image.Rect(left, middle-trackSize/2, current, middle+trackSize/2), etk.Style.ScrollHandleColor)
+
+	markerSize := etk.Scale(2)
+	for i, frame := range frames {
+		x := t.frameX(i, len(frames))
+		if frame.gameStart {
+			fill(image.Rect(x-markerSize/2, r.Min.Y+r.Dy()/4, x+markerSize/2+1, r.Max.Y-r.Dy()/4), replayTimelineGameColor)
+		}
+		if _, ok := frame.Record.(*replay.Double); ok {
+			fill(image.Rect(x-markerSize*2, middle-markerSize*2, x+markerSize*2, middle+markerSize*2), replayTimelineCubeColor)
+		}
+	}
+
+	handleSize := etk.Scale(4)
+	fill(image.Rect(current-handleSize, r.Min.Y+r.Dy()/6, current+handleSize, r.Max.Y-r.Dy()/6), etk.Style.ButtonTextColor)
+	return nil
+}
@@ -0,0 +1,161 @@
+//go:build !js || !wasm
+
+package game
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/bgammon-bei-bot/bot"
+	"codeberg.org/tslocum/boxcars/replay"
+)
+
+// simulationResult is the aggregate result of the matches won by a bot.
+type simulationResult struct {
+	name        string
+	wins        int
+	gammons     int
+	backgammons int
+}
+
+// ParseVariant parses a variant name or number.
+func ParseVariant(variant string) (int8, error) {
+	switch strings.ToLower(strings.ReplaceAll(variant, "-", "")) {
+	case "0", "backgammon":
+		return bgammon.VariantBackgammon, nil
+	case "1", "aceydeucey", "acey":
+		return bgammon.VariantAceyDeucey, nil
+	case "2", "tabula":
+		return bgammon.VariantTabula, nil
+	default:
+		return 0, fmt.Errorf("unknown variant: %s", variant)
+	}
+}
+
+// Simulate plays the specified number of 1-point matches between two bots
+// without a user interface. Aggregate results are written to out, and each
+// match is saved as a replay in ReplayDir.
+func Simulate(matches int, variant int8, out io.Writer) error {
+	if matches < 1 {
+		return fmt.Errorf("invalid number of matches: %d", matches)
+	}
+	// The bots and the local server log every action using the standard
+	// logger, which is restored once the simulation finishes.
+	logOutput := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(logOutput)
+
+	g := &Game{
+		Mutex: &sync.Mutex{},
+	}
+	g.startLocalServer()
+	m := startBotMatch(g.localServer, bot.NewLocalBEIClient(<-g.beiConns, true), variant, 1, 0)
+	defer m.stop()
+
+	c := newClient("", "Spectator", "", false)
+	c.Transport = NewConnTransport(<-g.localServer)
+	c.local = true
+	c.status = discardStatus{}
+	go c.Connect()
+	defer c.Disconnect()
+
+	replayDir := ReplayDir()
+	if replayDir != "" {
+		err := os.MkdirAll(replayDir, 0700)
+		if err != nil {
+			return fmt.Errorf("failed to create replay directory %s: %s", replayDir, err)
+		}
+	}
+
+	var (
+		results   [2]*simulationResult
+		spectator = newMatchRecorder()
+		joined    = m.joined
+		played    int
+		started   = time.Now()
+	)
+	for e := range c.Events {
+		switch ev := e.(type) {
+		case *bgammon.EventPing:
+			c.Send([]byte(fmt.Sprintf("pong %s", ev.Message)))
+		case *bgammon.EventWelcome:
+			go func() {
+				c.Send([]byte(fmt.Sprintf("j %d", <-joined)))
+			}()
+		case *bgammon.EventBoard:
+			if ev.Spectating {
+				m.start()
+			}
+			if results[0] == nil && ev.Player1.Name != "" && ev.Player2.Name != "" {
+				results[0] = &simulationResult{name: ev.Player1.Name}
+				results[1] = &simulationResult{name: ev.Player2.Name}
+			}
+		case *bgammon.EventWin:
+			gs := spectator.state
+			spectator.handleEvent(e)
+			if gs == nil || results[0] == nil {
+				continue
+			}
+
+			var winner int8 = 1
+			if ev.Player == gs.Player2.Name {
+				winner = 2
+			}
+			result := results[winner-1]
+			result.wins++
+			if ev.Resigned == "" && variant != bgammon.VariantAceyDeucey {
+				switch replay.WinPoints(gs.Game, winner) {
+				case 2:
+					result.gammons++
+				case 3:
+					result.backgammons++
+				}
+			}
+
+			played++
+			if m := spectator.match(); m != nil && replayDir != "" {
+				filePath := path.Join(replayDir, fmt.Sprintf("%d_%s_%s_%d.match", started.Unix(), gs.Player1.Name, gs.Player2.Name, played))
+				buf := &bytes.Buffer{}
+				err := m.WriteMatch(buf)
+				if err == nil {
+					err = os.WriteFile(filePath, buf.Bytes(), 0600)
+				}
+				if err != nil {
+					return fmt.Errorf("failed to write replay to %s: %s", filePath, err)
+				}
+			}
+			fmt.Fprintf(out, "%d/%d: %s wins\n", played, matches, ev.Player)
+			if played == matches {
+				printSimulationResults(out, results, played, time.Since(started))
+				return nil
+			}
+			continue
+		}
+		spectator.handleEvent(e)
+	}
+	return fmt.Errorf("disconnected from local server")
+}
+
+func printSimulationResults(out io.Writer, results [2]*simulationResult, played int, elapsed time.Duration) {
+	fmt.Fprintf(out, "\nPlayed %d matches in %s.\n\n", played, elapsed.Round(time.Second))
+	fmt.Fprintf(out, "%-20s %8s %8s %8s %12s\n", "Player", "Wins", "Win %", "Gammons", "Backgammons")
+	for _, result := range results {
+		fmt.Fprintf(out, "%-20s %8d %8s %8d %12d\n", result.name, result.wins, strconv.FormatFloat(float64(result.wins)*100/float64(played), 'f', 1, 64), result.gammons, result.backgammons)
+	}
+}
+
+// discardStatus discards status messages.
+type discardStatus struct{}
+
+func (discardStatus) addStatus(s string) {}
+
+func (discardStatus) replaceStatus(s string) {}
@@ -0,0 +1,57 @@
+package game
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+)
+
+// tlsConfig is used when connecting to tls:// server addresses.
+var tlsConfig = &tls.Config{
+	MinVersion: tls.VersionTLS12,
+}
+
+// ConfigureTLS configures connections to tls:// server addresses. When caFile
+// is specified, the server certificate is verified using the certificate
+// authorities in the PEM encoded file instead of the system certificate pool.
+// When certFile and keyFile are specified, the client certificate is presented
+// to the server. Server certificate verification is disabled when insecure is
+// true, which should only be used for local testing.
+func ConfigureTLS(caFile string, certFile string, keyFile string, insecure bool) error {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile != "" {
+		buf, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate authority file %s: %s", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("failed to read certificate authority file %s: no certificates found", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("both a client certificate and a client key must be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if insecure {
+		log.Println("warning: TLS server certificate verification is disabled")
+	}
+
+	tlsConfig = config
+	return nil
+}
@@ -0,0 +1,253 @@
+package game
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/boxcars/proxy"
+	"github.com/coder/websocket"
+)
+
+const transportWriteTimeout = 10 * time.Second
+
+// ErrSessionEnded is returned by a Transport when no more events may be read
+// and connecting again is not useful, such as when a recorded session has been
+// played back. The client does not reconnect after reading this error.
+var ErrSessionEnded = errors.New("session ended")
+
+// Transport is a connection to a bgammon server. Each connection attempt
+// creates a new Transport via the function registered for the scheme of the
+// server address.
+type Transport interface {
+	// Dial connects to the server at the specified address.
+	Dial(ctx context.Context, address string) error
+
+	// ReadEvent reads a single JSON encoded event from the server. When the
+	// session has ended, ErrSessionEnded is returned.
+	ReadEvent() ([]byte, error)
+
+	// WriteLine writes a single command to the server. The command must not
+	// contain a newline.
+	WriteLine(line []byte) error
+
+	// Close closes the connection.
+	Close() error
+}
+
+var (
+	transports     = make(map[string]func() Transport)
+	transportsLock = &sync.Mutex{}
+)
+
+func init() {
+	RegisterTransport("ws", newWebSocketTransport)
+	RegisterTransport("wss", newWebSocketTransport)
+	RegisterTransport("tcp", newTCPTransport)
+	RegisterTransport("tls", newTLSTransport)
+	RegisterTransport("unix", newUnixTransport)
+}
+
+// RegisterTransport registers a function which creates a Transport for server
+// addresses beginning with the specified scheme (e.g. "tcp" for tcp://).
+// Addresses without a scheme are handled by the tcp Transport.
+func RegisterTransport(scheme string, newTransport func() Transport) {
+	transportsLock.Lock()
+	defer transportsLock.Unlock()
+
+	transports[strings.ToLower(scheme)] = newTransport
+}
+
+func addressScheme(address string) string {
+	i := strings.Index(address, "://")
+	if i == -1 {
+		return "tcp"
+	}
+	return strings.ToLower(address[:i])
+}
+
+func newTransport(address string) (Transport, error) {
+	scheme := addressScheme(address)
+
+	transportsLock.Lock()
+	f := transports[scheme]
+	transportsLock.Unlock()
+
+	if f == nil {
+		return nil, fmt.Errorf("unsupported server address scheme: %s", scheme)
+	}
+	return f(), nil
+}
+
+type webSocketTransport struct {
+	conn *websocket.Conn
+}
+
+func newWebSocketTransport() Transport {
+	return &webSocketTransport{}
+}
+
+func (t *webSocketTransport) Dial(ctx context.Context, address string) error {
+	conn, _, err := websocket.Dial(ctx, address, dialOptions)
+	if err != nil {
+		return err
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *webSocketTransport) ReadEvent() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+	defer cancel()
+
+	msgType, msg, err := t.conn.Read(ctx)
+	if err != nil {
+		return nil, err
+	} else if msgType != websocket.MessageText {
+		return nil, fmt.Errorf("unexpected message type: %s", msgType)
+	}
+	return msg, nil
+}
+
+func (t *webSocketTransport) WriteLine(line []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), transportWriteTimeout)
+	defer cancel()
+
+	return t.conn.Write(ctx, websocket.MessageText, line)
+}
+
+func (t *webSocketTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close(websocket.StatusNormalClosure, "")
+}
+
+// ConnTransport is a Transport which communicates with a bgammon server over
+// a stream-oriented connection such as a TCP connection, a unix socket or an
+// in-memory pipe.
+type ConnTransport struct {
+	network string
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+func newTCPTransport() Transport {
+	return &ConnTransport{network: "tcp"}
+}
+
+func newTLSTransport() Transport {
+	return &ConnTransport{network: "tls"}
+}
+
+func newUnixTransport() Transport {
+	return &ConnTransport{network: "unix"}
+}
+
+// NewConnTransport returns a Transport which uses an established connection.
+// Dial reads the server greeting from the connection. The connection may not
+// be re-dialed after it is closed.
+func NewConnTransport(conn net.Conn) *ConnTransport {
+	return &ConnTransport{conn: conn}
+}
+
+func (t *ConnTransport) Dial(ctx context.Context, address string) error {
+	if t.network != "" {
+		if i := strings.Index(address, "://"); i != -1 {
+			address = address[i+3:]
+		}
+
+		network := t.network
+		if network == "tls" {
+			network = "tcp"
+		}
+		conn, err := proxy.DialContext(ctx, network, address)
+		if err != nil {
+			return err
+		}
+		if t.network == "tls" {
+			config := tlsConfig.Clone()
+			if config.ServerName == "" {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					host = address
+				}
+				config.ServerName = host
+			}
+			tlsConn := tls.Client(conn, config)
+			err = tlsConn.HandshakeContext(ctx)
+			if err != nil {
+				conn.Close()
+				return err
+			}
+			conn = tlsConn
+		}
+		t.conn = conn
+	} else if t.conn == nil || t.scanner != nil {
+		return fmt.Errorf("connection closed")
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		t.conn.SetReadDeadline(deadline)
+	}
+
+	// Read a single line of text and parse remaining output as JSON.
+	buf := make([]byte, 1)
+	var readBytes int
+	for {
+		_, err := t.conn.Read(buf)
+		if err != nil {
+			t.conn.Close()
+			return err
+		}
+
+		if buf[0] == '\n' {
+			break
+		}
+
+		readBytes++
+		if readBytes == 512 {
+			t.conn.Close()
+			return fmt.Errorf("failed to read server greeting")
+		}
+	}
+
+	t.scanner = bufio.NewScanner(t.conn)
+	return nil
+}
+
+func (t *ConnTransport) ReadEvent() ([]byte, error) {
+	t.conn.SetReadDeadline(time.Now().Add(clientTimeout))
+
+	if !t.scanner.Scan() {
+		err := t.scanner.Err()
+		if err == nil {
+			err = fmt.Errorf("connection closed")
+		}
+		return nil, err
+	}
+	return t.scanner.Bytes(), nil
+}
+
+func (t *ConnTransport) WriteLine(line []byte) error {
+	t.conn.SetWriteDeadline(time.Now().Add(transportWriteTimeout))
+
+	buf := make([]byte, len(line)+1)
+	copy(buf, line)
+	buf[len(line)] = '\n'
+	_, err := t.conn.Write(buf)
+	return err
+}
+
+func (t *ConnTransport) Close() error {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.Close()
+}
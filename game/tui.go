@@ -0,0 +1,208 @@
+//go:build !js || !wasm
+
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"codeberg.org/tslocum/gotext"
+)
+
+const terminalLogLines = 8
+
+// terminal is a text-mode user interface which plays via a Client without
+// any graphical dependencies.
+type terminal struct {
+	client  *Client
+	session *sessionState
+	status  []string
+	gameLog []string
+	*sync.Mutex
+}
+
+// RunTerminal connects to the specified server and plays using a text-mode
+// user interface. Commands are read from standard input until /quit is
+// entered or standard input is closed.
+func RunTerminal(address string, username string, password string) error {
+	t := &terminal{
+		client:  newClient(address, username, password, false),
+		session: newSessionState(),
+		Mutex:   &sync.Mutex{},
+	}
+	t.client.status = t
+
+	go t.client.Connect()
+	go t.handleEvents()
+	go t.refreshList()
+	go t.redrawStatus()
+
+	t.draw()
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if !t.handleInput(strings.TrimSpace(scanner.Text())) {
+			break
+		}
+	}
+	t.client.Disconnect()
+	return scanner.Err()
+}
+
+func (t *terminal) addStatus(s string) {
+	t.Lock()
+	t.status = appendLog(t.status, s)
+	t.Unlock()
+
+	t.draw()
+}
+
+func (t *terminal) replaceStatus(s string) {
+	t.Lock()
+	if len(t.status) == 0 {
+		t.status = appendLog(t.status, s)
+	} else {
+		t.status[len(t.status)-1] = s
+	}
+	t.Unlock()
+
+	t.draw()
+}
+
+func appendLog(l []string, messages ...string) []string {
+	l = append(l, messages...)
+	if len(l) > terminalLogLines {
+		l = l[len(l)-terminalLogLines:]
+	}
+	return l
+}
+
+func (t *terminal) handleEvents() {
+	for e := range t.client.Events {
+		switch ev := e.(type) {
+		case *bgammon.EventPing:
+			t.client.Send([]byte(fmt.Sprintf("pong %s", ev.Message)))
+		case *bgammon.EventWelcome:
+			t.client.Send([]byte("ls"))
+		case *bgammon.EventLeft:
+			t.client.Send([]byte("ls"))
+		}
+
+		t.Lock()
+		status, gameLog := t.session.apply(e)
+		t.status = appendLog(t.status, status...)
+		t.gameLog = appendLog(t.gameLog, gameLog...)
+		t.Unlock()
+
+		t.draw()
+	}
+}
+
+// refreshList periodically refreshes the match list while in the lobby.
+func (t *terminal) refreshList() {
+	ticker := time.NewTicker(19 * time.Second)
+	for range ticker.C {
+		t.Lock()
+		inMatch := t.session.inMatch()
+		t.Unlock()
+		if !inMatch {
+			t.client.Send([]byte("ls"))
+		}
+	}
+}
+
+// redrawStatus periodically redraws the screen to update the connection status.
+func (t *terminal) redrawStatus() {
+	ticker := time.NewTicker(latencyProbeInterval)
+	for range ticker.C {
+		t.draw()
+	}
+}
+
+// handleInput handles a line of input. It returns false when the user quits.
+func (t *terminal) handleInput(text string) bool {
+	if len(text) == 0 {
+		t.Lock()
+		gs := t.session.gameState
+		inMatch := t.session.inMatch()
+		t.Unlock()
+		if !inMatch {
+			t.client.Send([]byte("ls"))
+		} else if gs.MayRoll() {
+			t.client.Send([]byte("roll"))
+		} else if gs.MayOK() {
+			t.client.Send([]byte("ok"))
+		}
+		return true
+	}
+
+	if text[0] == '/' {
+		text = text[1:]
+		switch strings.ToLower(text) {
+		case "quit", "exit":
+			return false
+		}
+		t.client.Send([]byte(text))
+		return true
+	}
+
+	t.client.Send([]byte(fmt.Sprintf("say %s", text)))
+	return true
+}
+
+func (t *terminal) draw() {
+	t.Lock()
+	defer t.Unlock()
+
+	b := &strings.Builder{}
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(b, "%s: %s\n\n", gotext.Get("Connection"), connectionStatusText(t.client.latency.status()))
+
+	s := t.session
+	if s.inMatch() {
+		gs := s.gameState
+		b.Write(gs.BoardState(gs.PlayerNumber, false))
+		b.WriteByte('\n')
+		fmt.Fprintf(b, "%s (%d) - %s (%d)", gs.Player1.Name, gs.Player1.Points, gs.Player2.Name, gs.Player2.Points)
+		if gs.Points > 1 {
+			fmt.Fprintf(b, "  %s", gotext.Get("%d-point match", gs.Points))
+		}
+		b.WriteByte('\n')
+		if gs.Roll1 != 0 || gs.Roll2 != 0 {
+			fmt.Fprintf(b, "%s: %s\n", gotext.Get("Dice"), formatRoll(gs.Roll1, gs.Roll2, gs.Roll3))
+		}
+		if gs.PlayerNumber == gs.Turn && len(gs.Available) > 0 {
+			fmt.Fprintf(b, "%s\n", gotext.Get("Legal moves: %s", bgammon.FormatMoves(gs.Available)))
+		}
+		b.WriteByte('\n')
+		for _, line := range t.gameLog {
+			b.WriteString(line + "\n")
+		}
+	} else {
+		fmt.Fprintf(b, "%-6s %-8s %-6s %s\n", gotext.Get("ID"), gotext.Get("Status"), gotext.Get("Points"), gotext.Get("Name"))
+		for _, listing := range s.games {
+			status := gotext.Get("Open")
+			if listing.Password {
+				status = gotext.Get("Locked")
+			} else if listing.Players == 2 {
+				status = gotext.Get("Full")
+			}
+			fmt.Fprintf(b, "%-6d %-8s %-6d %s\n", listing.ID, status, listing.Points, listing.Name)
+		}
+		if len(s.games) == 0 {
+			b.WriteString(gotext.Get("No matches available.") + "\n")
+		}
+	}
+
+	b.WriteByte('\n')
+	for _, line := range t.status {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString("\n" + gotext.Get("Enter a message, a /command (e.g. /j 1, /mv 13/7, /roll, /ok) or /quit.") + "\n> ")
+
+	os.Stdout.WriteString(b.String())
+}
@@ -5,6 +5,7 @@ go 1.24.3
 toolchain go1.24.9
 
 require (
+	codeberg.org/tslocum/bei v0.0.0-20251126224720-ad50f5673164
 	codeberg.org/tslocum/bgammon v0.0.0-20260113212327-5bab53db5679
 	codeberg.org/tslocum/bgammon-bei-bot v0.0.0-20250401034558-ae6ab01531a9
 	codeberg.org/tslocum/etk v0.0.0-20251229055419-a7f958964684
@@ -12,12 +13,13 @@ require (
 	codeberg.org/tslocum/tabula v0.0.0-20251126224954-c4a498a4d704
 	github.com/coder/websocket v1.8.14
 	github.com/hajimehoshi/ebiten/v2 v2.9.7
+	golang.org/x/image v0.35.0
+	golang.org/x/net v0.49.0
 	golang.org/x/sys v0.40.0
 	golang.org/x/text v0.33.0
 )
 
 require (
-	codeberg.org/tslocum/bei v0.0.0-20251126224720-ad50f5673164 // indirect
 	github.com/Masterminds/goutils v1.1.1 // indirect
 	github.com/Masterminds/semver v1.5.0 // indirect
 	github.com/Masterminds/sprig v2.22.0+incompatible // indirect
@@ -65,8 +67,6 @@ require (
 	golang.design/x/clipboard v0.7.1 // indirect
 	golang.org/x/crypto v0.47.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20260112195511-716be5621a96 // indirect
-	golang.org/x/image v0.35.0 // indirect
 	golang.org/x/mobile v0.0.0-20260112195712-5b9ecdfb8721 // indirect
-	golang.org/x/net v0.49.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
 )
@@ -0,0 +1,304 @@
+// Package proxy connects to servers via SOCKS5 and HTTP CONNECT proxies.
+//
+// By default, the proxy is configured using the HTTP_PROXY, HTTPS_PROXY,
+// ALL_PROXY and NO_PROXY environment variables (or the lowercase versions
+// thereof). Servers on the loopback interface and the local network are always
+// connected to directly.
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc returns the proxy server used when connecting to a URL. When the
+// returned URL is nil, connections are made directly.
+var proxyFunc = fromEnvironment().ProxyFunc()
+
+// fromEnvironment returns the proxy configuration specified by the
+// environment. ALL_PROXY is used when no proxy is specified for a scheme.
+func fromEnvironment() *httpproxy.Config {
+	config := httpproxy.FromEnvironment()
+	for _, name := range []string{"ALL_PROXY", "all_proxy"} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		if config.HTTPProxy == "" {
+			config.HTTPProxy = v
+		}
+		if config.HTTPSProxy == "" {
+			config.HTTPSProxy = v
+		}
+		break
+	}
+	return config
+}
+
+// Set configures the proxy server used when connecting to servers. SOCKS5
+// (socks5://host:port) and HTTP CONNECT (http://host:port) proxies are
+// supported. Credentials may be included in the address. Hosts listed in
+// NO_PROXY are connected to directly. Proxy settings from the environment are
+// disabled when the address is "none".
+func Set(address string) error {
+	if address == "none" {
+		proxyFunc = (&httpproxy.Config{}).ProxyFunc()
+		return nil
+	}
+	_, err := parseProxy(address)
+	if err != nil {
+		return err
+	}
+	proxyFunc = (&httpproxy.Config{
+		HTTPProxy:  address,
+		HTTPSProxy: address,
+		NoProxy:    httpproxy.FromEnvironment().NoProxy,
+	}).ProxyFunc()
+	return nil
+}
+
+// For returns the proxy server used when connecting to the address using the
+// specified scheme, or nil when connecting directly.
+func For(scheme string, address string) (*url.URL, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()) {
+		return nil, nil
+	}
+	u, err := proxyFunc(&url.URL{Scheme: scheme, Host: address})
+	if err != nil {
+		return nil, err
+	} else if u == nil {
+		return nil, nil
+	}
+	return parseProxy(u.String())
+}
+
+// Request returns the proxy server used when sending the provided request. It
+// may be used as the Proxy of an http.Transport.
+func Request(req *http.Request) (*url.URL, error) {
+	return For(req.URL.Scheme, req.URL.Host)
+}
+
+func parseProxy(address string) (*url.URL, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy address %s: %s", address, err)
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy address %s: no host specified", address)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "1080")
+		}
+	case "http":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	default:
+		return nil, fmt.Errorf("invalid proxy address %s: unsupported scheme %s", address, u.Scheme)
+	}
+	return u, nil
+}
+
+// DialContext connects to the address via the proxy server configured for
+// secure connections, or directly when no proxy is configured.
+func DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return dialer.DialContext(ctx, network, address)
+	}
+	proxy, err := For("https", address)
+	if err != nil {
+		return nil, err
+	} else if proxy == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy %s: %s", proxy.Host, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	proxyConn := conn
+	if proxy.Scheme == "http" {
+		proxyConn, err = proxyHTTPConnect(conn, proxy, address)
+	} else {
+		err = proxySOCKS5Connect(conn, proxy, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s via proxy %s: %s", address, proxy.Host, err)
+	}
+	proxyConn.SetDeadline(time.Time{})
+	return proxyConn, nil
+}
+
+// bufferedConn is a connection which reads any data buffered while
+// establishing the proxied connection before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func proxyHTTPConnect(conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	err := req.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	res, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response: %s", res.Status)
+	}
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+const (
+	socksVersion         = 5
+	socksAuthNone        = 0
+	socksAuthPassword    = 2
+	socksAuthUnsupported = 0xff
+	socksCommandConnect  = 1
+	socksAddressIPv4     = 1
+	socksAddressDomain   = 3
+	socksAddressIPv6     = 4
+)
+
+func proxySOCKS5Connect(conn net.Conn, proxy *url.URL, address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %s", portString)
+	}
+
+	// Negotiate authentication.
+	method := byte(socksAuthNone)
+	if proxy.User != nil {
+		method = socksAuthPassword
+	}
+	_, err = conn.Write([]byte{socksVersion, 1, method})
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	} else if buf[0] != socksVersion {
+		return fmt.Errorf("unexpected SOCKS version %d", buf[0])
+	} else if buf[1] == socksAuthUnsupported || buf[1] != method {
+		return fmt.Errorf("authentication method not supported by proxy")
+	}
+
+	if method == socksAuthPassword {
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return fmt.Errorf("proxy credentials are too long")
+		}
+		req := []byte{1, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		_, err = conn.Write(req)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			return err
+		} else if buf[1] != 0 {
+			return fmt.Errorf("proxy authentication failed")
+		}
+	}
+
+	// Request connection.
+	req := []byte{socksVersion, socksCommandConnect, 0}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(req, socksAddressIPv4)
+		req = append(req, ip.To4()...)
+	} else if ip != nil {
+		req = append(req, socksAddressIPv6)
+		req = append(req, ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("host name is too long")
+		}
+		req = append(req, socksAddressDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	res := make([]byte, 4)
+	_, err = io.ReadFull(conn, res)
+	if err != nil {
+		return err
+	} else if res[1] != 0 {
+		return fmt.Errorf("proxy returned error code %d", res[1])
+	}
+
+	// Discard the bound address.
+	var addressLength int
+	switch res[3] {
+	case socksAddressIPv4:
+		addressLength = net.IPv4len
+	case socksAddressIPv6:
+		addressLength = net.IPv6len
+	case socksAddressDomain:
+		_, err = io.ReadFull(conn, buf[:1])
+		if err != nil {
+			return err
+		}
+		addressLength = int(buf[0])
+	default:
+		return fmt.Errorf("unexpected address type %d", res[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, addressLength+2))
+	return err
+}
@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// setProxy configures the proxy for the duration of the test.
+func setProxy(t *testing.T, address string) {
+	t.Helper()
+	previous := proxyFunc
+	t.Cleanup(func() {
+		proxyFunc = previous
+	})
+	err := Set(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func clearEnvironment(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestFromEnvironment(t *testing.T) {
+	clearEnvironment(t)
+	t.Setenv("ALL_PROXY", "socks5://all.example:1080")
+	t.Setenv("HTTP_PROXY", "http://http.example:3128")
+
+	config := fromEnvironment()
+	if config.HTTPProxy != "http://http.example:3128" {
+		t.Errorf("unexpected HTTP proxy: got %s", config.HTTPProxy)
+	}
+	if config.HTTPSProxy != "socks5://all.example:1080" {
+		t.Errorf("unexpected HTTPS proxy: got %s", config.HTTPSProxy)
+	}
+}
+
+func TestFor(t *testing.T) {
+	clearEnvironment(t)
+	t.Setenv("NO_PROXY", "bypass.example")
+	setProxy(t, "socks5://proxy.example")
+
+	testCases := []struct {
+		scheme  string
+		address string
+		proxy   string
+	}{
+		{"https", "bgammon.org:1337", "socks5://proxy.example:1080"},
+		{"http", "bgammon.org:80", "socks5://proxy.example:1080"},
+		{"https", "bypass.example:1337", ""},
+		{"https", "server.bypass.example:1337", ""},
+		{"https", "localhost:1337", ""},
+		{"https", "127.0.0.1:1337", ""},
+		{"https", "[::1]:1337", ""},
+		{"https", "192.168.1.20:1337", ""},
+		{"https", "10.0.0.5:1337", ""},
+		{"https", "169.254.1.1:1337", ""},
+	}
+	for _, c := range testCases {
+		u, err := For(c.scheme, c.address)
+		if err != nil {
+			t.Errorf("%s://%s: unexpected error: %s", c.scheme, c.address, err)
+			continue
+		}
+		var got string
+		if u != nil {
+			got = u.String()
+		}
+		if got != c.proxy {
+			t.Errorf("%s://%s: unexpected proxy: expected %q, got %q", c.scheme, c.address, c.proxy, got)
+		}
+	}
+
+	setProxy(t, "none")
+	u, err := For("https", "bgammon.org:1337")
+	if err != nil {
+		t.Fatal(err)
+	} else if u != nil {
+		t.Errorf("unexpected proxy after disabling proxy: %s", u)
+	}
+}
+
+func TestSetInvalid(t *testing.T) {
+	for _, address := range []string{"ftp://proxy.example", "socks5://", "://proxy"} {
+		previous := proxyFunc
+		err := Set(address)
+		proxyFunc = previous
+		if err == nil {
+			t.Errorf("%s: expected error", address)
+		}
+	}
+}
+
+// fakeProxy listens for a single proxied connection. The requested address
+// is sent to the returned channel, after which the connection is echoed.
+func fakeProxy(t *testing.T, handshake func(conn net.Conn, r *bufio.Reader) (string, error)) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	requested := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		address, err := handshake(conn, r)
+		if err != nil {
+			requested <- "error: " + err.Error()
+			return
+		}
+		requested <- address
+		io.Copy(conn, r)
+	}()
+	return listener.Addr().String(), requested
+}
+
+func socks5Handshake(username string, password string) func(conn net.Conn, r *bufio.Reader) (string, error) {
+	return func(conn net.Conn, r *bufio.Reader) (string, error) {
+		buf := make([]byte, 3)
+		_, err := io.ReadFull(r, buf)
+		if err != nil {
+			return "", err
+		}
+		method := byte(socksAuthNone)
+		if username != "" {
+			method = socksAuthPassword
+		}
+		if buf[0] != socksVersion || buf[1] != 1 || buf[2] != method {
+			return "", fmt.Errorf("unexpected greeting %v", buf)
+		}
+		conn.Write([]byte{socksVersion, method})
+
+		if username != "" {
+			header := make([]byte, 2)
+			_, err = io.ReadFull(r, header)
+			if err != nil {
+				return "", err
+			}
+			user := make([]byte, header[1])
+			_, err = io.ReadFull(r, user)
+			if err != nil {
+				return "", err
+			}
+			passwordLength, err := r.ReadByte()
+			if err != nil {
+				return "", err
+			}
+			pass := make([]byte, passwordLength)
+			_, err = io.ReadFull(r, pass)
+			if err != nil {
+				return "", err
+			}
+			if string(user) != username || string(pass) != password {
+				conn.Write([]byte{1, 1})
+				return "", fmt.Errorf("invalid credentials %s:%s", user, pass)
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		req := make([]byte, 5)
+		_, err = io.ReadFull(r, req)
+		if err != nil {
+			return "", err
+		} else if req[0] != socksVersion || req[1] != socksCommandConnect || req[3] != socksAddressDomain {
+			return "", fmt.Errorf("unexpected request %v", req)
+		}
+		host := make([]byte, req[4]+2)
+		_, err = io.ReadFull(r, host)
+		if err != nil {
+			return "", err
+		}
+		port := binary.BigEndian.Uint16(host[len(host)-2:])
+
+		conn.Write([]byte{socksVersion, 0, 0, socksAddressIPv4, 127, 0, 0, 1, 0, 0})
+		return fmt.Sprintf("%s:%d", host[:len(host)-2], port), nil
+	}
+}
+
+func httpConnectHandshake(credentials string) func(conn net.Conn, r *bufio.Reader) (string, error) {
+	return func(conn net.Conn, r *bufio.Reader) (string, error) {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return "", err
+		} else if req.Method != http.MethodConnect {
+			return "", fmt.Errorf("unexpected method %s", req.Method)
+		}
+		if credentials != "" && req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)) {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return "", fmt.Errorf("invalid credentials %s", req.Header.Get("Proxy-Authorization"))
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return req.Host, nil
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	clearEnvironment(t)
+
+	testCases := []struct {
+		name      string
+		scheme    string
+		user      string
+		handshake func(conn net.Conn, r *bufio.Reader) (string, error)
+	}{
+		{"SOCKS5", "socks5", "", socks5Handshake("", "")},
+		{"SOCKS5 with credentials", "socks5", "player:secret@", socks5Handshake("player", "secret")},
+		{"HTTP CONNECT", "http", "", httpConnectHandshake("")},
+		{"HTTP CONNECT with credentials", "http", "player:secret@", httpConnectHandshake("player:secret")},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			address, requested := fakeProxy(t, c.handshake)
+			setProxy(t, fmt.Sprintf("%s://%s%s", c.scheme, c.user, address))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			conn, err := DialContext(ctx, "tcp", "bgammon.example:1337")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if target := <-requested; target != "bgammon.example:1337" {
+				t.Fatalf("unexpected requested address: %s", target)
+			}
+
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+			_, err = conn.Write([]byte("hello\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			} else if line != "hello\n" {
+				t.Fatalf("unexpected reply: %q", line)
+			}
+		})
+	}
+}
+
+func TestDialContextDirect(t *testing.T) {
+	clearEnvironment(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("hello\n"))
+		conn.Close()
+	}()
+
+	// Loopback addresses are connected to directly, even when a proxy is set.
+	setProxy(t, "socks5://proxy.invalid:1080")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := DialContext(ctx, "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	} else if line != "hello\n" {
+		t.Fatalf("unexpected reply: %q", line)
+	}
+}
+
+func TestDialContextProxyError(t *testing.T) {
+	clearEnvironment(t)
+
+	address, _ := fakeProxy(t, func(conn net.Conn, r *bufio.Reader) (string, error) {
+		_, err := http.ReadRequest(r)
+		if err != nil {
+			return "", err
+		}
+		conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+		return "", fmt.Errorf("forbidden")
+	})
+	setProxy(t, "http://"+address)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := DialContext(ctx, "tcp", "bgammon.example:1337")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,14 @@
+package render
+
+import "image/color"
+
+// Board colors.
+var (
+	FrameColor      = color.RGBA{65, 40, 14, 255}
+	BorderColor     = color.RGBA{0, 0, 0, 255}
+	FaceColor       = color.RGBA{120, 63, 25, 255}
+	TriangleA       = color.RGBA{225, 188, 125, 255}
+	TriangleB       = color.RGBA{120, 17, 0, 255}
+	CheckerColor    = color.RGBA{232, 211, 162, 255}
+	SpaceLabelColor = color.RGBA{121, 96, 60, 255}
+)
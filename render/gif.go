@@ -0,0 +1,231 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"strconv"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+	"golang.org/x/image/font"
+)
+
+const (
+	statusBarHeight = 40
+	motionSteps     = 6
+	motionDelay     = 40 * time.Millisecond
+)
+
+// GIFOptions are the options used when drawing an animated GIF.
+type GIFOptions struct {
+	Width  int
+	Height int
+
+	// Delay is the amount of time each game state is shown.
+	Delay time.Duration
+
+	// Motion enables drawing checkers as they move between spaces.
+	Motion bool
+}
+
+// EncodeGIF draws each game state as a frame of an animated GIF. The names and
+// scores of the players are drawn below the board.
+func EncodeGIF(w io.Writer, frames []*bgammon.Game, options *GIFOptions) error {
+	b := NewBoard(options.Width, options.Height-statusBarHeight)
+	q := &quantizer{
+		palette: gifPalette(),
+		indexes: make(map[color.RGBA]uint8),
+	}
+
+	var (
+		status    *image.RGBA
+		statusKey [2]string
+		scoreKey  [3]int8
+		previous  *image.Paletted
+	)
+	anim := &gif.GIF{}
+	addFrame := func(g *bgammon.Game, board *image.RGBA, delay time.Duration) {
+		bounds := board.Bounds()
+		names, score := [2]string{g.Player1.Name, g.Player2.Name}, [3]int8{g.Points, g.Player1.Points, g.Player2.Points}
+		if status == nil || names != statusKey || score != scoreKey {
+			status = b.statusBar(g, bounds.Dx())
+			statusKey, scoreKey = names, score
+		}
+		img := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()+statusBarHeight), q.palette)
+		q.draw(img, board, image.Point{})
+		q.draw(img, status, image.Pt(0, bounds.Dy()))
+
+		// Only the area which changed since the previous frame is stored.
+		frame := img
+		if previous != nil {
+			changed := changedRect(previous, img)
+			if changed.Empty() {
+				anim.Delay[len(anim.Delay)-1] += int(delay / (10 * time.Millisecond))
+				return
+			}
+			frame = img.SubImage(changed).(*image.Paletted)
+		}
+		previous = img
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond)))
+	}
+
+	for i, g := range frames {
+		if options.Motion && i > 0 {
+			b.addMotionFrames(frames[i-1], g, addFrame)
+		}
+		delay := options.Delay
+		if i == len(frames)-1 {
+			delay *= 3
+		}
+		addFrame(g, b.Draw(g), delay)
+	}
+	return gif.EncodeAll(w, anim)
+}
+
+// addMotionFrames adds frames which show the checkers moved between two game
+// states. No frames are added when the second state does not follow a roll
+// played from the first state.
+func (b *Board) addMotionFrames(from *bgammon.Game, to *bgammon.Game, addFrame func(g *bgammon.Game, board *image.RGBA, delay time.Duration)) {
+	if len(to.Moves) == 0 || to.Roll1 == 0 || from.Winner != 0 {
+		return
+	}
+
+	// Verify all moves are legal before drawing any frames.
+	check := from.Copy(true)
+	check.Turn, check.Roll1, check.Roll2, check.Roll3 = to.Turn, to.Roll1, to.Roll2, to.Roll3
+	check.Moves = nil
+	check.DoubleOffered = false
+	g := check.Copy(true)
+	for _, move := range to.Moves {
+		ok, _ := check.AddMoves([][]int8{move}, false)
+		if !ok {
+			return
+		}
+	}
+
+	for _, move := range to.Moves {
+		space, dest := move[0], move[1]
+		white := g.Board[space] < 0
+		count := abs(g.Board[space])
+		if count == 0 {
+			return
+		}
+		var destCount int
+		if (g.Board[dest] < 0) == white {
+			destCount = abs(g.Board[dest])
+		}
+		x1, y1 := b.checkerPosition(space, int8(count-1))
+		x2, y2 := b.checkerPosition(dest, int8(destCount))
+
+		moving := g.Copy(true)
+		if white {
+			moving.Board[space]++
+		} else {
+			moving.Board[space]--
+		}
+		checker := b.checkerTopDark
+		if white {
+			checker = b.checkerTopLight
+		}
+		for step := 1; step < motionSteps; step++ {
+			progress := float64(step) / motionSteps
+			img := b.Draw(moving)
+			drawImage(img, checker, x1+(x2-x1)*progress, y1+(y2-y1)*progress)
+			addFrame(moving, img, motionDelay)
+		}
+
+		g.AddMoves([][]int8{move}, false)
+	}
+}
+
+// statusBar returns an image of the names and scores of the players, which is
+// drawn below the board.
+func (b *Board) statusBar(g *bgammon.Game, width int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, statusBarHeight))
+	fillRect(img, img.Bounds(), FrameColor)
+	fillRect(img, image.Rect(0, 0, width, 1), BorderColor)
+
+	iconSize := statusBarHeight * 3 / 5
+	iconY := float64(statusBarHeight-iconSize) / 2
+	lineHeight := (b.face.Metrics().Ascent + b.face.Metrics().Descent).Ceil()
+	textY := (statusBarHeight - lineHeight) / 2
+	const padding = 10
+
+	drawImage(img, resizeImage(imgCheckerTopDark, iconSize), padding, iconY)
+	b.drawText(img, g.Player1.Name, CheckerColor, padding*2+iconSize, textY)
+
+	x := width - padding - iconSize
+	drawImage(img, resizeImage(imgCheckerTopLight, iconSize), float64(x), iconY)
+	x -= padding + font.MeasureString(b.face, g.Player2.Name).Ceil()
+	b.drawText(img, g.Player2.Name, CheckerColor, x, textY)
+
+	if g.Points > 1 {
+		score := strconv.Itoa(int(g.Player1.Points)) + " - " + strconv.Itoa(int(g.Player2.Points)) + " (" + strconv.Itoa(int(g.Points)) + ")"
+		x = (width - font.MeasureString(b.face, score).Ceil()) / 2
+		b.drawText(img, score, CheckerColor, x, textY)
+	}
+	return img
+}
+
+// quantizer draws images using a palette. The palette index of each color is
+// cached, as each frame contains mostly the same colors.
+type quantizer struct {
+	palette color.Palette
+	indexes map[color.RGBA]uint8
+}
+
+// draw draws an image with its top left corner at the provided position.
+func (q *quantizer) draw(dst *image.Paletted, src *image.RGBA, p image.Point) {
+	bounds := src.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := src.RGBAAt(x, y)
+			index, ok := q.indexes[c]
+			if !ok {
+				index = uint8(q.palette.Index(c))
+				q.indexes[c] = index
+			}
+			dst.SetColorIndex(p.X+x-bounds.Min.X, p.Y+y-bounds.Min.Y, index)
+		}
+	}
+}
+
+// changedRect returns the smallest rectangle which contains every pixel which
+// differs between two images of the same size.
+func changedRect(a *image.Paletted, b *image.Paletted) image.Rectangle {
+	var r image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.ColorIndexAt(x, y) != b.ColorIndexAt(x, y) {
+				r = r.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return r
+}
+
+// gifPalette returns a palette which contains the colors of the board followed
+// by the web-safe colors and shades of gray.
+func gifPalette() color.Palette {
+	pal := color.Palette{
+		FrameColor,
+		BorderColor,
+		FaceColor,
+		TriangleA,
+		TriangleB,
+		CheckerColor,
+		SpaceLabelColor,
+		color.RGBA{255, 255, 255, 255},
+	}
+	pal = append(pal, palette.WebSafe...)
+	for i := 0; len(pal) < 256; i++ {
+		v := uint8(8 + i*8)
+		pal = append(pal, color.RGBA{v, v, v, 255})
+	}
+	return pal
+}
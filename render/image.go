@@ -0,0 +1,189 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/png"
+	"log"
+	"math"
+	"sync"
+
+	"codeberg.org/tslocum/boxcars/game/asset"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/vector"
+)
+
+var (
+	imgCheckerTopLight  image.Image
+	imgCheckerTopDark   image.Image
+	imgCheckerSideLight image.Image
+	imgCheckerSideDark  image.Image
+	imgDice             image.Image
+	imgCubes            image.Image
+	textFont            *opentype.Font
+
+	loadAssetsOnce sync.Once
+)
+
+// loadAssets decodes the image and font assets. Checker images are tinted
+// using the checker color.
+func loadAssets() {
+	loadAssetsOnce.Do(func() {
+		imgCheckerTopLight = tint(loadImage("image/checker_top_light.png"), CheckerColor)
+		imgCheckerTopDark = tint(loadImage("image/checker_top_dark.png"), CheckerColor)
+		imgCheckerSideLight = tint(loadImage("image/checker_side_light.png"), CheckerColor)
+		imgCheckerSideDark = tint(loadImage("image/checker_side_dark.png"), CheckerColor)
+		imgDice = loadImage("image/dice.png")
+		imgCubes = loadImage("image/cubes.png")
+
+		data, err := asset.FS.ReadFile("font/mplus-1p-regular.ttf")
+		if err != nil {
+			log.Panicf("failed to read font: %s", err)
+		}
+		textFont, err = opentype.Parse(data)
+		if err != nil {
+			log.Panicf("failed to parse font: %s", err)
+		}
+	})
+}
+
+func loadImage(assetPath string) image.Image {
+	f, err := asset.FS.Open(assetPath)
+	if err != nil {
+		log.Panicf("failed to open image %s: %s", assetPath, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		log.Panicf("failed to decode image %s: %s", assetPath, err)
+	}
+	return img
+}
+
+// fontFace returns the text font at the provided size in pixels.
+func fontFace(size float64) font.Face {
+	face, err := opentype.NewFace(textFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		log.Panicf("failed to load font face: %s", err)
+	}
+	return face
+}
+
+// tint multiplies the color channels of an image by a color.
+func tint(src image.Image, c color.RGBA) *image.RGBA {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(uint16(img.Pix[i]) * uint16(c.R) / 0xff)
+		img.Pix[i+1] = uint8(uint16(img.Pix[i+1]) * uint16(c.G) / 0xff)
+		img.Pix[i+2] = uint8(uint16(img.Pix[i+2]) * uint16(c.B) / 0xff)
+	}
+	return img
+}
+
+// resizeImage scales an image to fit within a square of the provided size. The
+// image is centered within the square.
+func resizeImage(src image.Image, size int) *image.RGBA {
+	if size < 1 {
+		size = 1
+	}
+	bounds := src.Bounds()
+	scale, yScale := float64(size)/float64(bounds.Dx()), float64(size)/float64(bounds.Dy())
+	if yScale < scale {
+		scale = yScale
+	}
+	w, h := int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale)
+	x, y := (size-w)/2, (size-h)/2
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(img, image.Rect(x, y, x+w, y+h), src, bounds, xdraw.Over, nil)
+	return img
+}
+
+// subImage returns a cell of an image which contains a grid of square cells.
+func subImage(img image.Image, x int, y int, size int) image.Image {
+	return img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}).SubImage(image.Rect(x*size, y*size, (x+1)*size, (y+1)*size))
+}
+
+// drawImage draws an image with its top left corner at the provided position.
+func drawImage(dst draw.Image, src image.Image, x float64, y float64) {
+	p := image.Pt(int(math.Round(x)), int(math.Round(y)))
+	bounds := src.Bounds()
+	draw.Draw(dst, image.Rectangle{p, p.Add(bounds.Size())}, src, bounds.Min, draw.Over)
+}
+
+func fillRect(dst draw.Image, r image.Rectangle, c color.Color) {
+	draw.Draw(dst, r, image.NewUniform(c), image.Point{}, draw.Over)
+}
+
+// path is a polygon which is filled or stroked using an antialiasing software
+// rasterizer.
+type path struct {
+	points [][2]float64
+	closed bool
+}
+
+func (p *path) moveTo(x float64, y float64) {
+	p.points = append(p.points[:0], [2]float64{x, y})
+	p.closed = false
+}
+
+func (p *path) lineTo(x float64, y float64) {
+	p.points = append(p.points, [2]float64{x, y})
+}
+
+func (p *path) close() {
+	p.closed = true
+}
+
+func (p *path) fill(dst draw.Image, c color.Color) {
+	if len(p.points) < 3 {
+		return
+	}
+	bounds := dst.Bounds()
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	z.DrawOp = draw.Over
+	z.MoveTo(float32(p.points[0][0]), float32(p.points[0][1]))
+	for _, point := range p.points[1:] {
+		z.LineTo(float32(point[0]), float32(point[1]))
+	}
+	z.ClosePath()
+	z.Draw(dst, bounds, image.NewUniform(c), image.Point{})
+}
+
+// stroke draws each segment of the path as a line of the provided width. Lines
+// are extended by half of their width so that segments meet at corners.
+func (p *path) stroke(dst draw.Image, c color.Color, width float64) {
+	points := p.points
+	if p.closed && len(points) > 1 {
+		points = append(points, points[0])
+	}
+	bounds := dst.Bounds()
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	z.DrawOp = draw.Over
+	for i := 1; i < len(points); i++ {
+		x1, y1, x2, y2 := points[i-1][0], points[i-1][1], points[i][0], points[i][1]
+		length := math.Hypot(x2-x1, y2-y1)
+		if length == 0 {
+			continue
+		}
+		dx, dy := (x2-x1)/length*width/2, (y2-y1)/length*width/2
+		x1, y1, x2, y2 = x1-dx, y1-dy, x2+dx, y2+dy
+		z.MoveTo(float32(x1-dy), float32(y1+dx))
+		z.LineTo(float32(x2-dy), float32(y2+dx))
+		z.LineTo(float32(x2+dy), float32(y2-dx))
+		z.LineTo(float32(x1+dy), float32(y1-dx))
+		z.ClosePath()
+	}
+	z.Draw(dst, bounds, image.NewUniform(c), image.Point{})
+}
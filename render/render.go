@@ -0,0 +1,671 @@
+// Package render draws backgammon positions to images without a window.
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+
+	"codeberg.org/tslocum/bgammon"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	horizontalBorderSize = 20
+	verticalBorderSize   = 25
+	fontSize             = 24
+	dividerHeight        = 15
+	cubePadding          = 10
+	maxDiceSize          = 100
+	diceImageCellSize    = 184
+)
+
+// Board draws positions using the same geometry, colors and images as the
+// board displayed by the client. Positions are drawn from the perspective of
+// player 1, whose checkers are black.
+type Board struct {
+	w, h int
+
+	spaceWidth     float64
+	barWidth       float64
+	triangleOffset float64
+	overlapSize    float64
+	innerW, innerH int
+
+	diceSize int
+	diceGap  float64
+
+	variant    int8
+	spaceRects [bgammon.BoardSpaces][4]int
+
+	checkerTopLight  image.Image
+	checkerTopDark   image.Image
+	checkerSideLight image.Image
+	checkerSideDark  image.Image
+	dice             [6]image.Image
+	cubes            [7]image.Image
+
+	face font.Face
+
+	background    *image.RGBA
+	backgroundKey [4]int8
+}
+
+// NewBoard returns a Board which draws images of the provided size. The width
+// is reduced when it exceeds the maximum aspect ratio of the board.
+func NewBoard(width int, height int) *Board {
+	loadAssets()
+
+	b := &Board{
+		w: width,
+		h: height,
+	}
+	maxWidth := int(float64(b.h) * 1.333)
+	if b.w > maxWidth {
+		b.w = maxWidth
+	}
+
+	b.triangleOffset = (float64(b.h) - (verticalBorderSize * 2)) / 15
+
+	const horizontalSpaces = 14
+	b.spaceWidth = (float64(b.w) - (horizontalBorderSize * 2)) / horizontalSpaces
+	b.barWidth = b.spaceWidth
+
+	b.overlapSize = (((float64(b.h) - (verticalBorderSize * 2)) - (b.triangleOffset * 2)) / 2) / 5
+	if b.overlapSize > b.spaceWidth*0.94 {
+		b.overlapSize = b.spaceWidth * 0.94
+	}
+
+	b.barWidth = float64(b.spaceWidth) + horizontalBorderSize
+	b.spaceWidth = ((float64(b.w) - (horizontalBorderSize * 2)) - b.barWidth) / (horizontalSpaces - 1)
+	if b.barWidth < 1 {
+		b.barWidth = 1
+	}
+	if b.spaceWidth < 1 {
+		b.spaceWidth = 1
+	}
+
+	b.innerW = int(float64(b.w) - (horizontalBorderSize * 2) - b.spaceWidth)
+	b.innerH = int(float64(b.h) - (verticalBorderSize * 2))
+
+	b.triangleOffset = (float64(b.innerH)+verticalBorderSize-b.spaceWidth*10)/2 + b.spaceWidth/12
+
+	b.diceSize = int(b.spaceWidth)
+	for _, maxSize := range []int{maxDiceSize, b.w / 10, b.h / 10} {
+		if b.diceSize > maxSize {
+			b.diceSize = maxSize
+		}
+	}
+	b.diceGap = 10.0
+	for _, size := range []int{b.w, b.h} {
+		if size < 800 {
+			v := 10.0 * (float64(size) / 800)
+			if v < b.diceGap {
+				b.diceGap = v
+			}
+		}
+	}
+
+	checkerSize := int(b.spaceWidth)
+	b.checkerTopLight = resizeImage(imgCheckerTopLight, checkerSize)
+	b.checkerTopDark = resizeImage(imgCheckerTopDark, checkerSize)
+	b.checkerSideLight = resizeImage(imgCheckerSideLight, checkerSize)
+	b.checkerSideDark = resizeImage(imgCheckerSideDark, checkerSize)
+	for i := range b.dice {
+		b.dice[i] = resizeImage(subImage(imgDice, i%3, i/3, diceImageCellSize), b.diceSize)
+	}
+	for i := range b.cubes {
+		b.cubes[i] = resizeImage(subImage(imgCubes, i%3, i/3, diceImageCellSize), int(float64(b.diceSize)*0.6))
+	}
+
+	b.face = fontFace(fontSize)
+
+	b.setSpaceRects(bgammon.VariantBackgammon)
+	return b
+}
+
+// Bounds returns the bounds of the images drawn by the board.
+func (b *Board) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.w, b.h)
+}
+
+// Draw returns an image of the provided game.
+func (b *Board) Draw(g *bgammon.Game) *image.RGBA {
+	if g.Variant != b.variant {
+		b.setSpaceRects(g.Variant)
+	}
+
+	img := image.NewRGBA(b.Bounds())
+	draw.Draw(img, img.Bounds(), b.backgroundImage(g), image.Point{}, draw.Src)
+	b.drawCheckers(img, g)
+	b.drawDice(img, g)
+	return img
+}
+
+// Position returns an image of the provided game at the provided size.
+func Position(g *bgammon.Game, width int, height int) *image.RGBA {
+	return NewBoard(width, height).Draw(g)
+}
+
+// RomanNumerals returns the roman numeral representation of a number.
+func RomanNumerals(i int) string {
+	var roman string = ""
+	var numbers = []int{1, 4, 5, 9, 10}
+	var numerals = []string{"I", "IV", "V", "IX", "X"}
+	var index = len(numerals) - 1
+	for i > 0 {
+		for numbers[index] <= i {
+			roman += numerals[index]
+			i -= numbers[index]
+		}
+		index -= 1
+	}
+	return roman
+}
+
+func (b *Board) bottomRow(space int8) bool {
+	var bottomStart int8 = 1
+	var bottomEnd int8 = 12
+	if b.variant == bgammon.VariantTabula {
+		bottomStart = 13
+		bottomEnd = 24
+	}
+	return space == bgammon.SpaceBarPlayer || space == bgammon.SpaceHomePlayer || (space >= bottomStart && space <= bottomEnd)
+}
+
+func (b *Board) setSpaceRects(variant int8) {
+	b.variant = variant
+
+	var x, y, w, h int
+	for space := int8(0); space < bgammon.BoardSpaces; space++ {
+		if !b.bottomRow(space) {
+			y = 0
+		} else {
+			y = int((float64(b.h) / 2) - verticalBorderSize)
+		}
+
+		w = int(b.spaceWidth)
+
+		var hspace int8 // horizontal space
+		var add int
+		if space == bgammon.SpaceBarPlayer || space == bgammon.SpaceBarOpponent {
+			hspace = 6
+			add = 1
+			w = int(b.barWidth)
+		} else if space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent {
+			hspace = 13
+			add = horizontalBorderSize
+		} else if space <= 6 {
+			hspace = space - 1
+		} else if space <= 12 {
+			hspace = space - 1
+			add = int(b.barWidth)
+		} else if space <= 18 {
+			hspace = 24 - space
+			add = int(b.barWidth)
+		} else {
+			hspace = 24 - space
+		}
+
+		x = int((b.spaceWidth * float64(hspace)) + float64(add))
+
+		h = int((float64(b.h) - (verticalBorderSize * 2)) / 2)
+
+		if space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent {
+			x += horizontalBorderSize
+		}
+
+		b.spaceRects[space] = [4]int{x, y, w, h}
+	}
+
+	// Flip board.
+	for i := 0; i < 6; i++ {
+		j, k, l, m := 1+i, 12-i, 13+i, 24-i
+		b.spaceRects[j], b.spaceRects[k], b.spaceRects[l], b.spaceRects[m] = b.spaceRects[k], b.spaceRects[j], b.spaceRects[m], b.spaceRects[l]
+	}
+}
+
+func (b *Board) stackSpaceRect(space int8, stack int8) (x, y, w, h int) {
+	r := b.spaceRects[space]
+	x, y, h = r[0], r[1], r[3]
+
+	// Stack pieces
+	var o int
+	if space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent {
+		if space == bgammon.SpaceHomeOpponent && stack > 0 {
+			stack -= 1
+			if stack > 0 {
+				stack -= 1
+			}
+		}
+		o = (h / 15) * int(stack)
+	} else {
+		osize := float64(stack)
+		if stack > 4 {
+			osize = 3.5
+		}
+		if b.bottomRow(space) {
+			osize += 1.0
+		}
+		o = int(osize * float64(b.overlapSize))
+		padding := int(b.spaceWidth - b.overlapSize)
+		if b.bottomRow(space) {
+			o += padding
+		} else {
+			o -= padding - 3
+		}
+	}
+	if !b.bottomRow(space) {
+		y += o
+	} else {
+		y += h - o
+	}
+
+	w, h = int(b.spaceWidth), int(b.spaceWidth)
+	if space == bgammon.SpaceBarPlayer || space == bgammon.SpaceBarOpponent {
+		w = int(b.barWidth)
+	}
+
+	return x, y, w, h
+}
+
+func (b *Board) offsetPosition(space int8, x, y int) (int, int) {
+	if space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent {
+		x += 1
+	}
+	return x + horizontalBorderSize, y + verticalBorderSize
+}
+
+func (b *Board) innerBoardCenter(right bool) int {
+	if right {
+		return horizontalBorderSize + b.innerW - (b.innerW / 4) + int(b.barWidth/4)
+	}
+	return horizontalBorderSize + b.innerW/4 - int(b.barWidth/4)
+}
+
+// backgroundImage returns an image of the board without any checkers or dice.
+// The image is redrawn only when the variant or doubling cube changes.
+func (b *Board) backgroundImage(g *bgammon.Game) *image.RGBA {
+	key := [4]int8{g.Variant, g.Points, g.DoublePlayer, g.DoubleValue}
+	if g.Crawford == bgammon.CrawfordActive {
+		key[3] = -1
+	}
+	if b.background != nil && b.backgroundKey == key {
+		return b.background
+	}
+	b.backgroundKey = key
+
+	img := image.NewRGBA(b.Bounds())
+	b.background = img
+
+	borderSize := float64(horizontalBorderSize)
+	if borderSize > b.barWidth/2 {
+		borderSize = b.barWidth / 2
+	}
+	frameW := b.w - int((horizontalBorderSize-borderSize)*2)
+
+	// Draw frame.
+	{
+		x, y := int(horizontalBorderSize-borderSize), 0
+		w, h := frameW, b.h
+		fillRect(img, image.Rect(x, y, x+w, y+h), FrameColor)
+	}
+
+	// Draw face.
+	{
+		x, y := horizontalBorderSize, verticalBorderSize
+		w, h := b.w+horizontalBorderSize, b.h-verticalBorderSize*2
+		fillRect(img, image.Rect(x, y, x+w, y+h), FaceColor)
+	}
+
+	// Draw right edge of frame.
+	{
+		x, y := horizontalBorderSize+b.innerW, verticalBorderSize
+		w, h := horizontalBorderSize, b.h
+		fillRect(img, image.Rect(x, y, x+w, y+h), FrameColor)
+	}
+
+	// Draw bar.
+	{
+		x, y := int((b.w/2)-int(b.spaceWidth/2)-int(b.barWidth/2)), 0
+		w, h := int(b.barWidth), b.h
+		fillRect(img, image.Rect(x, y, x+w, y+h), FrameColor)
+	}
+
+	p := &path{}
+
+	// Draw triangles.
+	offsetX, offsetY := float64(horizontalBorderSize), float64(verticalBorderSize)
+	for i := 0; i < 2; i++ {
+		triangleTip := float64(b.innerH) / 2
+		if i == 0 {
+			triangleTip -= b.triangleOffset
+		} else {
+			triangleTip += b.triangleOffset
+		}
+		for j := 0; j < 12; j++ {
+			colorA := j%2 == 0
+			if i == 1 {
+				colorA = !colorA
+			}
+
+			tx := b.spaceWidth * float64(j)
+			ty := b.innerH * i
+			if j >= 6 {
+				tx += b.barWidth
+			}
+			p.moveTo(offsetX+float64(tx), offsetY+float64(ty))
+			p.lineTo(offsetX+float64(tx+b.spaceWidth/2), offsetY+triangleTip)
+			p.lineTo(offsetX+float64(tx+b.spaceWidth), offsetY+float64(ty))
+			p.close()
+
+			fillColor := TriangleA
+			if !colorA {
+				fillColor = TriangleB
+			}
+			p.fill(img, fillColor)
+		}
+	}
+
+	// Draw border.
+	borderStrokeSize := 2.0
+	// Center.
+	p.moveTo(float64(frameW-int(b.spaceWidth))/2-1, float64(0))
+	p.lineTo(float64(frameW-int(b.spaceWidth))/2-1, float64(b.h))
+	p.stroke(img, BorderColor, borderStrokeSize)
+	// Outside right.
+	p.moveTo(float64(frameW), float64(0))
+	p.lineTo(float64(frameW), float64(b.h))
+	p.stroke(img, BorderColor, borderStrokeSize)
+	// Inside left.
+	edge := float64(((float64(b.innerW) + 2 - b.barWidth) / 2) + borderSize)
+	p.moveTo(float64(borderSize), float64(verticalBorderSize))
+	p.lineTo(edge, float64(verticalBorderSize))
+	p.lineTo(edge, float64(b.h-verticalBorderSize))
+	p.lineTo(float64(borderSize), float64(b.h-verticalBorderSize))
+	p.lineTo(float64(borderSize), float64(verticalBorderSize))
+	p.close()
+	p.stroke(img, BorderColor, borderStrokeSize/2)
+	// Inside right.
+	leftEdge := float64((b.innerW-int(b.barWidth))/2) + borderSize + b.barWidth
+	edge = leftEdge + math.Ceil(float64((b.innerW-int(b.barWidth)))/2)
+	p.moveTo(leftEdge, float64(verticalBorderSize))
+	p.lineTo(edge, float64(verticalBorderSize))
+	p.lineTo(edge, float64(b.h-verticalBorderSize))
+	p.lineTo(leftEdge, float64(b.h-verticalBorderSize))
+	p.lineTo(leftEdge, float64(verticalBorderSize))
+	p.close()
+	p.stroke(img, BorderColor, borderStrokeSize/2)
+	// Home spaces.
+	{
+		edgeStart := horizontalBorderSize + float64(b.innerW) + horizontalBorderSize
+		edgeEnd := edgeStart + b.spaceWidth
+		p.moveTo(float64(edgeStart), float64(verticalBorderSize))
+		p.lineTo(edgeEnd, float64(verticalBorderSize))
+		p.lineTo(edgeEnd, float64(b.h-verticalBorderSize))
+		p.lineTo(float64(edgeStart), float64(b.h-verticalBorderSize))
+		p.lineTo(float64(edgeStart), float64(verticalBorderSize))
+		p.close()
+		p.stroke(img, BorderColor, borderStrokeSize/2)
+	}
+	// Home space center divider.
+	extraSpace := b.h - verticalBorderSize*2 - int(b.overlapSize*10) - 4
+	if extraSpace > 0 {
+		edgeStart := horizontalBorderSize + float64(b.innerW) + horizontalBorderSize
+		edgeEnd := edgeStart + b.spaceWidth
+		divStart := float64(b.h/2 - (extraSpace / 2))
+		divEnd := float64(b.h/2 + (extraSpace / 2))
+
+		p.moveTo(float64(edgeStart)-1, divStart)
+		p.lineTo(edgeEnd, divStart)
+		p.lineTo(edgeEnd, divEnd)
+		p.lineTo(edgeStart-1, divEnd)
+		p.close()
+		p.fill(img, FrameColor)
+
+		p.moveTo(float64(edgeStart), divStart)
+		p.lineTo(edgeEnd, divStart)
+		p.stroke(img, BorderColor, borderStrokeSize/2)
+		p.moveTo(float64(edgeStart), divEnd)
+		p.lineTo(edgeEnd, divEnd)
+		p.stroke(img, BorderColor, borderStrokeSize/2)
+	}
+	// Home space partitions.
+	{
+		dividerHeight := float64(dividerHeight)
+		r := b.spaceRects[bgammon.SpaceHomePlayer]
+		checkerY := float64(verticalBorderSize+r[1]+r[3]) + 3
+		checkerHeight := (b.spaceWidth + b.overlapSize*4 - dividerHeight*2) / 15
+		for i := 0; i < 2; i++ {
+			if i == 1 {
+				checkerY = float64(verticalBorderSize) + 1
+				dividerHeight *= -1
+				checkerHeight *= -1
+			}
+			for j := 0; j < 2; j++ {
+				x1, y1 := horizontalBorderSize+float64(b.innerW)+horizontalBorderSize-1, checkerY-checkerHeight*5
+				x2, y2 := x1+b.spaceWidth+1, y1-dividerHeight
+				if j == 1 {
+					y1, y2 = y1-checkerHeight*5-dividerHeight, y2-checkerHeight*5-dividerHeight
+				}
+
+				p.moveTo(x1, y1)
+				p.lineTo(x2, y1)
+				p.lineTo(x2, y2)
+				p.lineTo(x1, y2)
+				p.close()
+				p.fill(img, FrameColor)
+
+				p.moveTo(x1, y1)
+				p.lineTo(x2, y1)
+				p.stroke(img, BorderColor, borderStrokeSize/2)
+
+				p.moveTo(x1, y2)
+				p.lineTo(x2, y2)
+				p.stroke(img, BorderColor, borderStrokeSize/2)
+			}
+		}
+	}
+
+	// Doubling cube.
+	if g.Points > 1 {
+		cube := b.cubeImage(g.DoubleValue, g.Crawford)
+		cubeSize := float64(cube.Bounds().Dx())
+		var cubeY float64
+		switch g.DoublePlayer {
+		case 1:
+			cubeY = float64(b.h) - verticalBorderSize - b.overlapSize*5 - cubeSize - cubePadding
+		case 2:
+			cubeY = verticalBorderSize + b.overlapSize*5 + cubePadding
+		default:
+			cubeY = float64(b.h)/2 - cubeSize/2
+		}
+		drawImage(img, cube, float64(b.w)-b.spaceWidth/2-cubeSize/2-1, cubeY)
+	}
+
+	// Draw space numbers.
+	lineHeight := (b.face.Metrics().Ascent + b.face.Metrics().Descent).Ceil()
+	for space, r := range b.spaceRects {
+		if space < 1 || space > 24 {
+			continue
+		}
+		space = 24 - space + 1
+
+		sp := strconv.Itoa(space)
+		if g.Variant == bgammon.VariantTabula {
+			sp = RomanNumerals(space)
+		}
+		bounds, _ := font.BoundString(b.face, sp)
+		x := horizontalBorderSize + r[0] + (r[2]-(bounds.Max.X-bounds.Min.X).Ceil())/2
+		if len(sp) == 1 {
+			switch sp[0] {
+			case '1', '2', '3', '4', '7':
+				x += 2
+			case '5', '9':
+				x += 1
+			}
+		}
+		y := 0
+		if b.bottomRow(int8(space)) {
+			y = b.h - verticalBorderSize
+		}
+		b.drawText(img, sp, SpaceLabelColor, x, y+(verticalBorderSize-lineHeight)/2)
+	}
+	return img
+}
+
+func (b *Board) drawCheckers(img *image.RGBA, g *bgammon.Game) {
+	for j := 0; j < 2; j++ {
+		drawWhite := j == 1
+		for space := int8(1); space < bgammon.BoardSpaces; space++ {
+			if space == bgammon.SpaceHomeOpponent {
+				continue
+			}
+			checkers := g.Board[space]
+			if (checkers < 0) != drawWhite {
+				continue
+			} else if checkers < 0 {
+				checkers *= -1
+			}
+			for i := int8(0); i < checkers; i++ {
+				b.drawChecker(img, space, i, drawWhite)
+
+				if i > 5 {
+					b.drawStackLabel(img, space, i, strconv.Itoa(int(i+1)), drawWhite)
+				}
+			}
+		}
+	}
+
+	checkerHeight := (b.spaceWidth + b.overlapSize*4 - dividerHeight*2) / 15
+
+	checkerY := float64(b.h-verticalBorderSize) - checkerHeight - 4
+	checkers := abs(g.Board[bgammon.SpaceHomePlayer])
+	var checkerOffset float64
+	for i := 0; i < checkers; i++ {
+		checkerOffset = 0
+		if i >= 10 {
+			checkerOffset = dividerHeight*2 - 2
+		} else if i >= 5 {
+			checkerOffset = dividerHeight - 2
+		}
+		drawImage(img, b.checkerSideDark, float64(b.w)-b.spaceWidth, checkerY-checkerHeight*float64(i+1)-checkerOffset)
+	}
+
+	checkerY = float64(verticalBorderSize) - checkerHeight - 3
+	checkers = abs(g.Board[bgammon.SpaceHomeOpponent])
+	for i := 0; i < checkers; i++ {
+		checkerOffset = 0
+		if i >= 10 {
+			checkerOffset = dividerHeight * 2
+		} else if i >= 5 {
+			checkerOffset = dividerHeight
+		}
+		drawImage(img, b.checkerSideLight, float64(b.w)-b.spaceWidth, checkerY+checkerHeight*float64(i)+checkerOffset)
+	}
+}
+
+// checkerPosition returns the position of a checker in a stack.
+func (b *Board) checkerPosition(space int8, stack int8) (float64, float64) {
+	x, y, w, _ := b.stackSpaceRect(space, stack)
+	x, y = b.offsetPosition(space, x, y)
+	// Center piece in space
+	x += (w - b.checkerTopLight.Bounds().Dx()) / 2
+	return float64(x), float64(y)
+}
+
+func (b *Board) drawChecker(img *image.RGBA, space int8, stack int8, white bool) {
+	x, y := b.checkerPosition(space, stack)
+	checker := b.checkerTopDark
+	if white {
+		checker = b.checkerTopLight
+	}
+	drawImage(img, checker, x, y)
+}
+
+func (b *Board) drawStackLabel(img *image.RGBA, space int8, stack int8, label string, white bool) {
+	labelColor := color.RGBA{255, 255, 255, 255}
+	if white {
+		labelColor = color.RGBA{0, 0, 0, 255}
+	}
+
+	bounds, _ := font.BoundString(b.face, label)
+	x, y, w, h := b.stackSpaceRect(space, stack)
+	x += (w / 2) - ((bounds.Max.X - bounds.Min.X).Ceil() / 2)
+	y += (h / 2) - ((bounds.Max.Y - bounds.Min.Y).Ceil() / 2)
+	x, y = b.offsetPosition(space, x, y)
+	b.drawText(img, label, labelColor, x, y)
+}
+
+func (b *Board) drawDice(img *image.RGBA, g *bgammon.Game) {
+	y := float64(b.innerH/2) - b.diceGap - float64(b.diceSize)
+	if g.Turn == 0 {
+		if g.Roll1 != 0 {
+			drawImage(img, b.diceImage(g.Roll1), float64(b.innerBoardCenter(true)-b.diceSize/2), y)
+		}
+		if g.Roll2 != 0 {
+			drawImage(img, b.diceImage(g.Roll2), float64(b.innerBoardCenter(false)-b.diceSize/2), y)
+		}
+		return
+	} else if g.Roll1 == 0 || g.Roll2 == 0 {
+		return
+	}
+
+	innerCenter := b.innerBoardCenter(g.Turn == 1)
+	if g.Roll3 != 0 {
+		drawImage(img, b.diceImage(g.Roll1), float64(innerCenter-b.diceSize)-b.diceGap-float64(b.diceSize/2)-b.diceGap, y)
+		drawImage(img, b.diceImage(g.Roll2), float64(innerCenter)-float64(b.diceSize)/2, y)
+		drawImage(img, b.diceImage(g.Roll3), float64(innerCenter)+b.diceGap+float64(b.diceSize/2)+b.diceGap, y)
+		return
+	}
+	drawImage(img, b.diceImage(g.Roll1), float64(innerCenter-b.diceSize)-b.diceGap, y)
+	drawImage(img, b.diceImage(g.Roll2), float64(innerCenter)+b.diceGap, y)
+}
+
+func (b *Board) diceImage(roll int8) image.Image {
+	if roll < 1 || roll > 6 {
+		roll = 1
+	}
+	return b.dice[roll-1]
+}
+
+func (b *Board) cubeImage(value int8, crawford bgammon.Crawford) image.Image {
+	if crawford == bgammon.CrawfordActive {
+		return b.cubes[6]
+	}
+	switch value {
+	case 2:
+		return b.cubes[0]
+	case 4:
+		return b.cubes[1]
+	case 8:
+		return b.cubes[2]
+	case 16:
+		return b.cubes[3]
+	case 32:
+		return b.cubes[4]
+	default:
+		return b.cubes[5]
+	}
+}
+
+// drawText draws text with its top left corner at the provided position.
+func (b *Board) drawText(img *image.RGBA, text string, c color.Color, x int, y int) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: b.face,
+		Dot:  fixed.P(x, y+b.face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+}
+
+func abs(v int8) int {
+	if v < 0 {
+		return int(-v)
+	}
+	return int(v)
+}
@@ -0,0 +1,133 @@
+package render
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"testing"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+const testWidth, testHeight = 720, 600
+
+// emptyGame returns a game without any checkers on the board.
+func emptyGame(variant int8) *bgammon.Game {
+	g := bgammon.NewGame(variant)
+	g.Board = make([]int8, bgammon.BoardSpaces)
+	return g
+}
+
+// changedBounds returns the bounds of the pixels which differ between two
+// images of the same size.
+func changedBounds(a *image.RGBA, b *image.RGBA) image.Rectangle {
+	var changed image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if a.RGBAAt(x, y) != b.RGBAAt(x, y) {
+				changed = changed.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return changed
+}
+
+func TestDraw(t *testing.T) {
+	g := bgammon.NewGame(bgammon.VariantBackgammon)
+	g.Turn, g.Roll1, g.Roll2 = 1, 6, 4
+
+	img := Position(g, testWidth, testHeight)
+	if img.Bounds() != image.Rect(0, 0, testWidth, testHeight) {
+		t.Fatalf("unexpected image bounds: %s", img.Bounds())
+	} else if !bytes.Equal(img.Pix, Position(g, testWidth, testHeight).Pix) {
+		t.Error("drawing the same position twice produced different images")
+	}
+
+	b := NewBoard(testWidth, testHeight)
+	if !bytes.Equal(img.Pix, b.Draw(g).Pix) || !bytes.Equal(img.Pix, b.Draw(g).Pix) {
+		t.Error("drawing a position with a reused board produced a different image")
+	}
+}
+
+func TestCheckerPositions(t *testing.T) {
+	testCases := []struct {
+		variant int8
+		bottom  [2]int8 // First and last space of the bottom row, from right to left.
+	}{
+		{bgammon.VariantBackgammon, [2]int8{1, 12}},
+		{bgammon.VariantTabula, [2]int8{24, 13}},
+	}
+	for _, c := range testCases {
+		b := NewBoard(testWidth, testHeight)
+		empty := b.Draw(emptyGame(c.variant))
+		size := b.checkerTopDark.Bounds().Size()
+
+		var previous image.Point
+		for i := int8(0); i < 24; i++ {
+			// Spaces are listed counterclockwise, beginning at the bottom right.
+			space, bottom := c.bottom[0]+i, i < 12
+			if c.bottom[0] > c.bottom[1] {
+				space = c.bottom[0] - i
+			}
+			if space > 24 {
+				space -= 24
+			} else if space < 1 {
+				space += 24
+			}
+
+			g := emptyGame(c.variant)
+			g.Board[space] = 1
+			changed := changedBounds(empty, b.Draw(g))
+			if changed.Empty() {
+				t.Errorf("variant %d: checker at space %d was not drawn", c.variant, space)
+				continue
+			}
+
+			x, y := b.checkerPosition(space, 0)
+			p := image.Pt(int(math.Round(x)), int(math.Round(y)))
+			if expected := (image.Rectangle{p, p.Add(size)}); !changed.In(expected) {
+				t.Errorf("variant %d: checker at space %d was drawn at %s, expected within %s", c.variant, space, changed, expected)
+			}
+
+			center := changed.Min.Add(changed.Max).Div(2)
+			if (center.Y > testHeight/2) != bottom {
+				t.Errorf("variant %d: checker at space %d was drawn in the wrong row at %s", c.variant, space, center)
+			}
+			switch {
+			case i == 0 && center.X < testWidth/2:
+				t.Errorf("variant %d: first space %d was drawn on the left at %s", c.variant, space, center)
+			case i == 0 || i == 12:
+			case bottom && center.X >= previous.X:
+				t.Errorf("variant %d: checker at space %d was drawn at %s, expected left of %s", c.variant, space, center, previous)
+			case !bottom && center.X <= previous.X:
+				t.Errorf("variant %d: checker at space %d was drawn at %s, expected right of %s", c.variant, space, center, previous)
+			}
+			previous = center
+		}
+	}
+}
+
+func TestCheckerStack(t *testing.T) {
+	b := NewBoard(testWidth, testHeight)
+	for _, space := range []int8{1, 24} {
+		g := emptyGame(bgammon.VariantBackgammon)
+		g.Board[space] = 1
+		one := b.Draw(g)
+		g.Board[space] = 2
+		second := changedBounds(one, b.Draw(g))
+		if second.Empty() {
+			t.Errorf("second checker at space %d was not drawn", space)
+			continue
+		}
+
+		// Checkers are stacked towards the center of the board.
+		x, y := b.checkerPosition(space, 0)
+		first := image.Pt(int(math.Round(x)), int(math.Round(y)))
+		if space == 1 && second.Min.Y >= first.Y {
+			t.Errorf("second checker at space %d was drawn at %s, expected above %s", space, second, first)
+		} else if space == 24 && second.Min.Y <= first.Y {
+			t.Errorf("second checker at space %d was drawn at %s, expected below %s", space, second, first)
+		}
+	}
+}
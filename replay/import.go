@@ -0,0 +1,374 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+// Import converts a GNU Backgammon SGF, GNU Backgammon .mat or Jellyfish
+// match file to a bgammon replay. Replays already in the bgammon format are
+// returned unchanged.
+func Import(data []byte) ([]byte, error) {
+	var m *Match
+	var err error
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("(;")):
+		m, err = ParseSGF(bytes.NewReader(data))
+	case matPoints.Match(data):
+		m, err = ParseMat(bytes.NewReader(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = m.WriteMatch(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	matPoints   = regexp.MustCompile(`(?m)^\s*(\d+) point match\s*$`)
+	matGame     = regexp.MustCompile(`^\s*Game (\d+)\s*$`)
+	matScore    = regexp.MustCompile(`^\s*(.+?)\s*:\s*(\d+)\s+(.+?)\s*:\s*(\d+)\s*$`)
+	matMetadata = regexp.MustCompile(`^;\s*\[(.+?)\s+"(.*)"\]`)
+	matActions  = regexp.MustCompile(`^\s*\d+\)`)
+	matWins     = regexp.MustCompile(`Wins (\d+) points?`)
+	matRollLine = regexp.MustCompile(`^(\d)(\d)(\d)?:$`)
+)
+
+// matColumn is the column at which the actions of player 2 begin. Actions
+// beginning before this column are played by player 1.
+const matColumn = 20
+
+// matAction is an action in a .mat file, such as a roll or a double.
+type matAction struct {
+	column int // Column of the first field, starting at 1.
+	fields []string
+}
+
+// ParseMat parses a match in the text format written by GNU Backgammon and
+// Jellyfish.
+func ParseMat(r io.Reader) (*Match, error) {
+	m := &Match{}
+	var points int8
+	var started int64
+	var date, clock, variation string
+	players := [2]string{"Player_1", "Player_2"}
+	var game *Game
+	var double *Double
+	var lineNumber int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		errorf := func(format string, a ...interface{}) error {
+			return &Error{Line: lineNumber, Err: fmt.Errorf(format, a...)}
+		}
+
+		if strings.HasPrefix(line, ";") {
+			match := matMetadata.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			switch match[1] {
+			case "Player 1":
+				players[0] = matPlayerName(match[2])
+			case "Player 2":
+				players[1] = matPlayerName(match[2])
+			case "EventDate":
+				date = match[2]
+			case "EventTime":
+				clock = match[2]
+			case "Variation":
+				variation = match[2]
+			}
+			continue
+		} else if match := matPoints.FindStringSubmatch(line); match != nil {
+			v, err := strconv.Atoi(match[1])
+			if err != nil || v > 127 {
+				return nil, errorf("invalid match length %q", match[1])
+			}
+			points = int8(v)
+			if points == 0 {
+				points = 1
+			}
+			continue
+		} else if matGame.MatchString(line) {
+			if game != nil {
+				err := importGame(game)
+				if err != nil {
+					return nil, err
+				}
+			}
+			variant, err := matVariant(variation)
+			if err != nil {
+				return nil, &Error{Line: lineNumber, Err: err}
+			}
+			if started == 0 && date != "" {
+				t, err := time.Parse("2006.01.02 15.04", date+" "+clock)
+				if err != nil {
+					t, _ = time.Parse("2006.01.02", date)
+				}
+				started = t.Unix()
+			}
+			game = &Game{
+				Header: &Header{
+					Line:        Line(lineNumber),
+					Started:     started,
+					Player1:     players[0],
+					Player2:     players[1],
+					Points:      points,
+					DoubleValue: 1,
+					Variant:     variant,
+				},
+			}
+			m.Games = append(m.Games, game)
+			double = nil
+			continue
+		} else if game == nil {
+			continue
+		}
+
+		h := game.Header
+		if match := matWins.FindStringSubmatchIndex(line); match != nil {
+			h.Winner = 1
+			if match[0] >= matColumn {
+				h.Winner = 2
+			}
+			continue
+		} else if !matActions.MatchString(line) {
+			if match := matScore.FindStringSubmatch(line); match != nil && len(game.Records) == 0 {
+				score1, err1 := strconv.Atoi(match[2])
+				score2, err2 := strconv.Atoi(match[4])
+				if err1 != nil || err2 != nil || score1 > 127 || score2 > 127 {
+					return nil, errorf("invalid score")
+				}
+				h.Player1, h.Player2 = matPlayerName(match[1]), matPlayerName(match[3])
+				h.Score1, h.Score2 = int8(score1), int8(score2)
+			}
+			continue
+		}
+
+		actions := matSplitActions(line)
+		for i, action := range actions {
+			player := int8(1)
+			if i > 0 || (len(actions) == 1 && action.column >= matColumn) {
+				player = 2
+			}
+			switch strings.ToLower(action.fields[0]) {
+			case "doubles":
+				value := h.DoubleValue * 2
+				if len(action.fields) == 3 && action.fields[1] == "=>" {
+					v, err := strconv.Atoi(action.fields[2])
+					if err != nil || v < 2 || v > 64 {
+						return nil, errorf("invalid cube value %q", action.fields[2])
+					}
+					value = int8(v)
+				}
+				double = &Double{Line: Line(lineNumber), Player: player, Value: value}
+			case "takes", "accepts", "drops", "passes", "rejects", "refuses":
+				if double == nil || double.Player == player {
+					return nil, errorf("%w %s", ErrUnexpectedAction, action.fields[0])
+				}
+				switch strings.ToLower(action.fields[0]) {
+				case "takes", "accepts":
+					double.Accepted = true
+					h.DoubleValue = double.Value
+				}
+				game.Records = append(game.Records, double)
+				double = nil
+			default:
+				roll, err := matParseRoll(action, player, lineNumber)
+				if err != nil {
+					return nil, err
+				}
+				game.Records = append(game.Records, roll)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if len(m.Games) == 0 {
+		return nil, &Error{Line: lineNumber, Err: errors.New("no games")}
+	}
+	err := importGame(game)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// matSplitActions returns the actions in a line of a .mat file.
+func matSplitActions(line string) []*matAction {
+	var actions []*matAction
+	var action *matAction
+	start := strings.Index(line, ")") + 1
+	for i := start; i < len(line); {
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+		end := strings.IndexAny(line[i:], " \t")
+		if end == -1 {
+			end = len(line)
+		} else {
+			end += i
+		}
+		field := line[i:end]
+		switch strings.ToLower(field) {
+		case "doubles", "takes", "accepts", "drops", "passes", "rejects", "refuses":
+			action = nil
+		default:
+			if matRollLine.MatchString(field) {
+				action = nil
+			}
+		}
+		if action == nil {
+			action = &matAction{column: i + 1}
+			actions = append(actions, action)
+		}
+		action.fields = append(action.fields, field)
+		i = end
+	}
+	return actions
+}
+
+// matParseRoll parses a roll and the moves played from the perspective of the
+// player moving. The bar is 25 and the home space is 0.
+func matParseRoll(action *matAction, player int8, lineNumber int) (*Roll, error) {
+	match := matRollLine.FindStringSubmatch(action.fields[0])
+	if match == nil {
+		return nil, &Error{Line: lineNumber, Column: action.column, Err: fmt.Errorf("unknown action %q", action.fields[0])}
+	}
+	r := &Roll{Line: Line(lineNumber), Player: player}
+	r.Roll1, r.Roll2 = int8(match[1][0]-'0'), int8(match[2][0]-'0')
+	if match[3] != "" {
+		r.Roll3 = int8(match[3][0] - '0')
+	}
+	for _, field := range action.fields[1:] {
+		if !strings.Contains(field, "/") {
+			// Cannot move.
+			continue
+		}
+		count := 1
+		if i := strings.Index(field, "("); i != -1 && strings.HasSuffix(field, ")") {
+			v, err := strconv.Atoi(field[i+1 : len(field)-1])
+			if err != nil || v < 1 || v > 4 {
+				return nil, &Error{Line: lineNumber, Column: action.column, Err: fmt.Errorf("%w %q", ErrInvalidMove, field)}
+			}
+			count, field = v, field[:i]
+		}
+		spaces := strings.Split(strings.ReplaceAll(field, "*", ""), "/")
+		for i := 0; i < len(spaces)-1; i++ {
+			from, to := matParseSpace(spaces[i]), matParseSpace(spaces[i+1])
+			if from < 0 || to < 0 || from == to {
+				return nil, &Error{Line: lineNumber, Column: action.column, Err: fmt.Errorf("%w %q", ErrInvalidMove, field)}
+			}
+			for j := 0; j < count; j++ {
+				r.Moves = append(r.Moves, []int8{importSpace(from, player), importSpace(to, player)})
+			}
+		}
+	}
+	return r, nil
+}
+
+func matParseSpace(space string) int8 {
+	switch strings.ToLower(space) {
+	case "bar":
+		return 25
+	case "off":
+		return 0
+	}
+	v, err := strconv.Atoi(space)
+	if err != nil || v < 0 || v > 25 {
+		return -1
+	}
+	return int8(v)
+}
+
+// matPlayerName returns a player name which does not contain spaces.
+func matPlayerName(name string) string {
+	name = strings.Join(strings.Fields(name), "_")
+	if name == "" {
+		return "Player"
+	}
+	return name
+}
+
+func matVariant(name string) (int8, error) {
+	switch name {
+	case "", "Backgammon":
+		return bgammon.VariantBackgammon, nil
+	case "Acey-Deucey":
+		return bgammon.VariantAceyDeucey, nil
+	case "Tabula":
+		return bgammon.VariantTabula, nil
+	default:
+		return 0, ErrUnsupportedVariant
+	}
+}
+
+// importSpace returns the absolute space of a space numbered from the
+// perspective of the provided player, where the bar is 25 and the home space
+// is 0.
+func importSpace(space int8, player int8) int8 {
+	switch {
+	case space == 25 && player == 1:
+		return bgammon.SpaceBarPlayer
+	case space == 25:
+		return bgammon.SpaceBarOpponent
+	case space == 0 && player == 1:
+		return bgammon.SpaceHomePlayer
+	case space == 0:
+		return bgammon.SpaceHomeOpponent
+	case player == 2:
+		return 25 - space
+	}
+	return space
+}
+
+// importGame plays the records of an imported game to verify they are legal.
+// Moves which use more than one die are split into one move per die, and the
+// loser resigns when the game ended before it was played out.
+func importGame(game *Game) error {
+	h := game.Header
+	g := h.NewGame()
+	for _, record := range game.Records {
+		if g.Winner != 0 {
+			return &Error{Line: record.LineNumber(), Err: errors.New("game has ended")}
+		}
+		err := record.Apply(g)
+		if err != nil {
+			return err
+		}
+		if r, ok := record.(*Roll); ok {
+			r.Moves = nil
+			for _, move := range g.Moves {
+				r.Moves = append(r.Moves, []int8{move[0], move[1]})
+			}
+		}
+	}
+	if h.Winner == 0 {
+		h.Winner = g.Winner
+	} else if g.Winner == 0 {
+		game.Records = append(game.Records, &Resign{Line: h.Line, Player: opponent(h.Winner)})
+	}
+	h.DoubleValue = g.DoubleValue
+	return nil
+}
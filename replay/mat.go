@@ -0,0 +1,251 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+// Format is a replay file format.
+type Format int
+
+// Replay file formats.
+const (
+	FormatMatch     Format = iota // bgammon replay.
+	FormatMat                     // GNU Backgammon match.
+	FormatJellyfish               // Jellyfish match.
+)
+
+// Formats lists the replay file formats.
+var Formats = []Format{FormatMatch, FormatMat, FormatJellyfish}
+
+// ErrUnsupportedVariant is returned when a replay can not be converted to a
+// format because the format does not support the variant played.
+var ErrUnsupportedVariant = errors.New("variant is not supported by format")
+
+// ParseFormat returns the format with the provided name or file extension.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "match", "bgammon":
+		return FormatMatch, nil
+	case "mat", "gnubg":
+		return FormatMat, nil
+	case "txt", "jellyfish":
+		return FormatJellyfish, nil
+	default:
+		return 0, fmt.Errorf("unknown replay format: %s", name)
+	}
+}
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatMat:
+		return "GNU Backgammon"
+	case FormatJellyfish:
+		return "Jellyfish"
+	default:
+		return "bgammon"
+	}
+}
+
+// Extension returns the file extension of the format, including the dot.
+func (f Format) Extension() string {
+	switch f {
+	case FormatMat:
+		return ".mat"
+	case FormatJellyfish:
+		return ".txt"
+	default:
+		return ".match"
+	}
+}
+
+// Convert converts a replay to the provided format. Replays in formats other
+// than the bgammon format are imported first.
+func Convert(data []byte, format Format) ([]byte, error) {
+	data, err := Import(data)
+	if err != nil {
+		return nil, err
+	} else if format == FormatMatch {
+		return data, nil
+	}
+	m, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = m.WriteMat(buf, format == FormatMat)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteMat writes the match in the text format read by GNU Backgammon and
+// Jellyfish. When metadata is true, the players, date and variant are written
+// as comments in the format exported by GNU Backgammon. Jellyfish does not
+// support comments.
+func (m *Match) WriteMat(w io.Writer, metadata bool) error {
+	first := m.Games[0].Header
+	if !metadata && first.Variant != bgammon.VariantBackgammon {
+		return ErrUnsupportedVariant
+	}
+
+	buf := &bytes.Buffer{}
+	if metadata {
+		started := time.Unix(first.Started, 0).UTC()
+		fmt.Fprintf(buf, "; [Player 1 \"%s\"]\n", first.Player1)
+		fmt.Fprintf(buf, "; [Player 2 \"%s\"]\n", first.Player2)
+		fmt.Fprintf(buf, "; [EventDate \"%s\"]\n", started.Format("2006.01.02"))
+		fmt.Fprintf(buf, "; [EventTime \"%s\"]\n", started.Format("15.04"))
+		fmt.Fprintf(buf, "; [Variation \"%s\"]\n", variantName(first.Variant))
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(buf, " %d point match\n", first.Points)
+	for i, game := range m.Games {
+		h := game.Header
+		fmt.Fprintf(buf, "\n Game %d\n", i+1)
+		fmt.Fprintf(buf, " %-36s%s : %d\n", fmt.Sprintf("%s : %d", h.Player1, h.Score1), h.Player2, h.Score2)
+		var next *Header
+		if i < len(m.Games)-1 {
+			next = m.Games[i+1].Header
+		}
+		err := writeMatGame(buf, game, next)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// matWriter formats the actions of a game in two columns, one per player.
+type matWriter struct {
+	w       io.Writer
+	columns [2]string
+	number  int
+}
+
+// add adds an action to the column of the provided player. A new line is
+// started when the column is occupied, or when player 1 acts after player 2.
+func (m *matWriter) add(player int8, action string) {
+	if m.columns[player-1] != "" || (player == 1 && m.columns[1] != "") {
+		m.flush()
+	}
+	m.columns[player-1] = action
+}
+
+func (m *matWriter) flush() {
+	if m.columns[0] == "" && m.columns[1] == "" {
+		return
+	}
+	m.number++
+	fmt.Fprintln(m.w, strings.TrimRight(fmt.Sprintf("%3d) %-32s%s", m.number, m.columns[0], m.columns[1]), " "))
+	m.columns[0], m.columns[1] = "", ""
+}
+
+// writeMatGame writes the actions of a game. When the header of the next game
+// is provided, the points won are calculated from the scores in the header.
+func writeMatGame(w io.Writer, game *Game, next *Header) error {
+	h := game.Header
+	g := h.NewGame()
+	m := &matWriter{w: w}
+	for _, record := range game.Records {
+		switch r := record.(type) {
+		case *Roll:
+			m.add(r.Player, matRoll(g, r))
+		case *Double:
+			m.add(r.Player, fmt.Sprintf(" Doubles => %d", r.Value))
+			if r.Accepted {
+				m.add(opponent(r.Player), " Takes")
+			} else {
+				m.add(opponent(r.Player), " Drops")
+			}
+		}
+		err := record.Apply(g)
+		if err != nil {
+			return err
+		}
+	}
+	m.flush()
+
+	winner, points := game.Result(g, next)
+	if winner == 0 {
+		return nil
+	}
+	score := h.Score1
+	if winner == 2 {
+		score = h.Score2
+	}
+	result := fmt.Sprintf("Wins %d point", points)
+	if points != 1 {
+		result += "s"
+	}
+	if h.Points > 1 && score+points >= h.Points {
+		result += " and the match"
+	}
+	var columns [2]string
+	columns[winner-1] = result
+	fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("%5s%-32s%s", "", columns[0], columns[1]), " "))
+	return nil
+}
+
+// matRoll formats a roll and the moves played from the perspective of the
+// player moving. Hits are marked with an asterisk.
+func matRoll(g *bgammon.Game, r *Roll) string {
+	dice := []int8{r.Roll1, r.Roll2, r.Roll3}
+	if dice[2] == 0 {
+		dice = dice[:2]
+	}
+	buf := &strings.Builder{}
+	for _, die := range dice {
+		fmt.Fprintf(buf, "%d", die)
+	}
+	buf.WriteString(":")
+
+	played := g.Copy(true)
+	played.Turn = r.Player
+	played.Roll1, played.Roll2, played.Roll3 = r.Roll1, r.Roll2, r.Roll3
+	played.Moves = nil
+	for _, move := range r.Moves {
+		hit := move[1] != bgammon.SpaceHomePlayer && move[1] != bgammon.SpaceHomeOpponent && bgammon.PlayerCheckers(played.Board[move[1]], opponent(r.Player)) == 1
+		fmt.Fprintf(buf, " %d/%d", matSpace(move[0], r.Player), matSpace(move[1], r.Player))
+		if hit {
+			buf.WriteByte('*')
+		}
+		played.AddMoves([][]int8{move}, false)
+	}
+	return buf.String()
+}
+
+// matSpace returns the number of a space from the perspective of the provided
+// player. The bar is 25 and the home space is 0.
+func matSpace(space int8, player int8) int8 {
+	switch space {
+	case bgammon.SpaceBarPlayer, bgammon.SpaceBarOpponent:
+		return 25
+	case bgammon.SpaceHomePlayer, bgammon.SpaceHomeOpponent:
+		return 0
+	}
+	if player == 2 {
+		return 25 - space
+	}
+	return space
+}
+
+func variantName(variant int8) string {
+	switch variant {
+	case bgammon.VariantAceyDeucey:
+		return "Acey-Deucey"
+	case bgammon.VariantTabula:
+		return "Tabula"
+	default:
+		return "Backgammon"
+	}
+}
@@ -0,0 +1,68 @@
+package replay
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+// ParsePositionID returns a backgammon game with the checkers placed as
+// described by a GNU Backgammon position ID. The player on roll is player 1.
+func ParsePositionID(id string) (*bgammon.Game, error) {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(id), "="))
+	if err != nil || len(data) != 10 {
+		return nil, fmt.Errorf("invalid position ID: %s", id)
+	}
+
+	g := bgammon.NewGame(bgammon.VariantBackgammon)
+	g.Turn = 1
+	for i := range g.Board {
+		g.Board[i] = 0
+	}
+
+	// Checkers are encoded as 1 bits, least significant bit first, and each
+	// point ends with a 0 bit. Points 1-24 and the bar of the opponent are
+	// followed by those of the player on roll.
+	var bit int
+	for side := 0; side < 2; side++ {
+		var checkers int
+		for point := 1; point <= 25; point++ {
+			var count int8
+			for bit < len(data)*8 && data[bit/8]&(1<<(bit%8)) != 0 {
+				count++
+				bit++
+			}
+			bit++
+			if bit > len(data)*8 {
+				return nil, fmt.Errorf("invalid position ID: %s", id)
+			}
+			checkers += int(count)
+			if count == 0 {
+				continue
+			}
+
+			switch {
+			case side == 0 && point == 25:
+				g.Board[bgammon.SpaceBarOpponent] = -count
+			case side == 0:
+				g.Board[25-point] = -count
+			case point == 25:
+				g.Board[bgammon.SpaceBarPlayer] = count
+			default:
+				g.Board[point] = count
+			}
+		}
+		if checkers > 15 {
+			return nil, fmt.Errorf("invalid position ID: %s", id)
+		}
+
+		if side == 0 {
+			g.Board[bgammon.SpaceHomeOpponent] = -int8(15 - checkers)
+		} else {
+			g.Board[bgammon.SpaceHomePlayer] = int8(15 - checkers)
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,574 @@
+// Package replay parses bgammon match replays and applies them to games.
+//
+// A replay (.match file) contains one or more games. When a replay contains
+// more than one game, it begins with an index of the offset of each game:
+//
+//	bgammon-replay <offset>
+//
+// Each game begins with a header line followed by one line per action:
+//
+//	i <started> <player1> <player2> <points> <score1> <score2> <winner> <cube> <variant>
+//	<player> r <roll> [<from>/<to>...]
+//	<player> d <cube> <accepted>
+//	<player> t
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+// Record is a line of a replay.
+type Record interface {
+	// LineNumber returns the line number of the record, starting at 1.
+	LineNumber() int
+
+	// Apply applies the record to the provided game.
+	Apply(g *bgammon.Game) error
+}
+
+// Line is the line number of a record, starting at 1.
+type Line int
+
+// LineNumber returns the line number of the record.
+func (l Line) LineNumber() int {
+	return int(l)
+}
+
+// Index is the offset of a game in a replay containing more than one game.
+type Index struct {
+	Line
+	Offset int
+}
+
+// Apply does nothing, as an index does not change the state of a game.
+func (r *Index) Apply(g *bgammon.Game) error {
+	return nil
+}
+
+// Header is the metadata which precedes the actions of a game.
+type Header struct {
+	Line
+	Started     int64
+	Player1     string
+	Player2     string
+	Points      int8
+	Score1      int8 // Score of player 1 when the game started.
+	Score2      int8 // Score of player 2 when the game started.
+	Winner      int8
+	DoubleValue int8 // Value of the doubling cube when the game ended.
+	Variant     int8
+}
+
+// NewGame returns a game at the state described by the header, before any
+// actions have been applied.
+func (r *Header) NewGame() *bgammon.Game {
+	g := bgammon.NewGame(r.Variant)
+	g.Started, g.Ended = r.Started, r.Started
+	g.Player1.Name, g.Player2.Name = r.Player1, r.Player2
+	g.Points = r.Points
+	g.Player1.Points, g.Player2.Points = r.Score1, r.Score2
+	g.Turn = 0
+	return g
+}
+
+// Apply resets the game to the state described by the header.
+func (r *Header) Apply(g *bgammon.Game) error {
+	*g = *r.NewGame()
+	return nil
+}
+
+// Roll is a roll of the dice and the moves played with the roll.
+type Roll struct {
+	Line
+	Player int8
+	Roll1  int8
+	Roll2  int8
+	Roll3  int8     // Used in tabula games.
+	Moves  [][]int8 // Moves played. Spaces are absolute.
+}
+
+// Dice returns the roll formatted as it appears in a replay.
+func (r *Roll) Dice() string {
+	dice := fmt.Sprintf("%d-%d", r.Roll1, r.Roll2)
+	if r.Roll3 != 0 {
+		dice += fmt.Sprintf("-%d", r.Roll3)
+	}
+	return dice
+}
+
+// Apply rolls the dice and plays the moves. When the last checker is borne
+// off, the winner of the game is set.
+func (r *Roll) Apply(g *bgammon.Game) error {
+	g.Turn = r.Player
+	g.Roll1, g.Roll2, g.Roll3 = r.Roll1, r.Roll2, r.Roll3
+	g.Moves = nil
+	g.DoubleOffered = false
+	for _, move := range r.Moves {
+		ok, _ := g.AddMoves([][]int8{move}, false)
+		if !ok {
+			return &Error{Line: r.LineNumber(), Err: fmt.Errorf("%w %s", ErrIllegalMove, bgammon.FormatMoves([][]int8{move}))}
+		}
+	}
+	return nil
+}
+
+// Double is a double offered by a player and the response of the opponent.
+type Double struct {
+	Line
+	Player   int8 // Player offering the double.
+	Value    int8 // Value of the doubling cube after accepting the double.
+	Accepted bool
+}
+
+// Apply turns the doubling cube over to the opponent when the double is
+// accepted, or ends the game when the double is declined.
+func (r *Double) Apply(g *bgammon.Game) error {
+	g.Turn = r.Player
+	g.Roll1, g.Roll2, g.Roll3 = 0, 0, 0
+	g.Moves = nil
+	g.DoubleOffered = false
+	if !r.Accepted {
+		g.Winner = r.Player
+		return nil
+	}
+	g.DoubleValue = r.Value
+	g.DoublePlayer = opponent(r.Player)
+	return nil
+}
+
+// Resign is a player resigning or running out of time.
+type Resign struct {
+	Line
+	Player int8 // Player resigning.
+}
+
+// Apply ends the game.
+func (r *Resign) Apply(g *bgammon.Game) error {
+	g.Winner = opponent(r.Player)
+	return nil
+}
+
+// Game is a game within a replay.
+type Game struct {
+	Header  *Header
+	Records []Record // Records following the header.
+}
+
+// Frames returns the state of the game before each record is applied, followed
+// by the state of the game after all records are applied.
+func (g *Game) Frames() ([]*bgammon.Game, error) {
+	game := g.Header.NewGame()
+	frames := []*bgammon.Game{game.Copy(true)}
+	for _, record := range g.Records {
+		err := record.Apply(game)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, game.Copy(true))
+	}
+	return frames, nil
+}
+
+// Result returns the winner of the game and the points won, provided the state
+// of the game after all records are applied. When the header of the next game
+// is provided, the points won are calculated from the scores in the header.
+// The winner is zero when the game did not end.
+func (g *Game) Result(final *bgammon.Game, next *Header) (winner int8, points int8) {
+	h := g.Header
+	winner = h.Winner
+	if winner == 0 {
+		winner = final.Winner
+	}
+	if winner == 0 {
+		return 0, 0
+	}
+	points = WinPoints(final, winner) * final.DoubleValue
+	if len(g.Records) != 0 {
+		if d, ok := g.Records[len(g.Records)-1].(*Double); ok && !d.Accepted {
+			points = final.DoubleValue
+		}
+	}
+	score := h.Score1
+	if winner == 2 {
+		score = h.Score2
+	}
+	if next != nil {
+		nextScore := next.Score1
+		if winner == 2 {
+			nextScore = next.Score2
+		}
+		if nextScore > score {
+			points = nextScore - score
+		}
+	}
+	return winner, points
+}
+
+// Match is a parsed replay.
+type Match struct {
+	Index []*Index
+	Games []*Game
+}
+
+// WriteMatch writes the match in the bgammon replay format.
+func (m *Match) WriteMatch(w io.Writer) error {
+	games := make([][]byte, len(m.Games))
+	for i, game := range m.Games {
+		buf := &bytes.Buffer{}
+		h := game.Header
+		fmt.Fprintf(buf, "i %d %s %s %d %d %d %d %d %d\n", h.Started, h.Player1, h.Player2, h.Points, h.Score1, h.Score2, h.Winner, h.DoubleValue, h.Variant)
+		for _, record := range game.Records {
+			switch r := record.(type) {
+			case *Roll:
+				fmt.Fprintf(buf, "%d r %s", r.Player, r.Dice())
+				if len(r.Moves) != 0 {
+					fmt.Fprintf(buf, " %s", bgammon.FormatMoves(r.Moves))
+				}
+				buf.WriteByte('\n')
+			case *Double:
+				var accepted int
+				if r.Accepted {
+					accepted = 1
+				}
+				fmt.Fprintf(buf, "%d d %d %d\n", r.Player, r.Value, accepted)
+			case *Resign:
+				fmt.Fprintf(buf, "%d t\n", r.Player)
+			}
+		}
+		games[i] = buf.Bytes()
+	}
+
+	buf := &bytes.Buffer{}
+	if len(games) > 1 {
+		const indexLength = len("bgammon-replay 00000000\n")
+		offset := indexLength * len(games)
+		for _, game := range games {
+			fmt.Fprintf(buf, "bgammon-replay %08d\n", offset)
+			offset += len(game)
+		}
+	}
+	for _, game := range games {
+		buf.Write(game)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// Parse parses a replay.
+func Parse(r io.Reader) (*Match, error) {
+	m := &Match{}
+	var lineNumber int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNumber++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		record, err := ParseLine(scanner.Bytes(), lineNumber)
+		if err != nil {
+			return nil, err
+		}
+		switch record := record.(type) {
+		case *Index:
+			if len(m.Games) != 0 {
+				return nil, &Error{Line: lineNumber, Column: 1, Err: errors.New("index follows game")}
+			}
+			m.Index = append(m.Index, record)
+		case *Header:
+			m.Games = append(m.Games, &Game{Header: record})
+		default:
+			if len(m.Games) == 0 {
+				return nil, &Error{Line: lineNumber, Column: 1, Err: errors.New("record precedes game header")}
+			}
+			game := m.Games[len(m.Games)-1]
+			game.Records = append(game.Records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	} else if len(m.Games) == 0 {
+		return nil, &Error{Line: lineNumber, Err: errors.New("no games")}
+	}
+	return m, nil
+}
+
+// ParseLine parses a line of a replay.
+func ParseLine(line []byte, lineNumber int) (Record, error) {
+	p := &parser{line: line, lineNumber: lineNumber}
+	p.split()
+	if len(p.fields) == 0 {
+		return nil, &Error{Line: lineNumber, Column: 1, Err: errors.New("empty line")}
+	}
+
+	switch string(p.fields[0]) {
+	case "bgammon-replay":
+		if len(p.fields) != 2 {
+			return nil, p.errorf(len(p.fields), "expected offset")
+		}
+		offset, err := p.int(1, 0, 1<<31-1)
+		if err != nil {
+			return nil, err
+		}
+		return &Index{Line: Line(lineNumber), Offset: offset}, nil
+	case "i":
+		return p.parseHeader()
+	case "1", "2":
+		if len(p.fields) < 2 {
+			return nil, p.errorf(1, "expected action")
+		}
+		player := int8(p.fields[0][0] - '0')
+		switch string(p.fields[1]) {
+		case "r":
+			return p.parseRoll(player)
+		case "d":
+			return p.parseDouble(player)
+		case "t":
+			if len(p.fields) != 2 {
+				return nil, p.errorf(2, "unexpected field")
+			}
+			return &Resign{Line: Line(lineNumber), Player: player}, nil
+		default:
+			return nil, p.errorf(1, "unknown action %q", p.fields[1])
+		}
+	default:
+		return nil, p.errorf(0, "unknown record %q", p.fields[0])
+	}
+}
+
+// Errors wrapped by an Error when the records of a replay are invalid.
+var (
+	ErrInvalidMove      = errors.New("invalid move")      // The move could not be parsed.
+	ErrIllegalMove      = errors.New("illegal move")      // The move is not legal in the position.
+	ErrUnexpectedAction = errors.New("unexpected action") // The action may not be taken in the position.
+)
+
+// Error is an error encountered while reading a replay.
+type Error struct {
+	Line   int // Line number, starting at 1.
+	Column int // Column of the field which could not be parsed, starting at 1.
+	Err    error
+}
+
+// Error returns the error message.
+func (e *Error) Error() string {
+	if e.Column == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type parser struct {
+	line       []byte
+	lineNumber int
+	fields     [][]byte
+	columns    []int // Column of each field, starting at 1.
+}
+
+// split splits the line into fields separated by spaces. Commas separating
+// moves are removed.
+func (p *parser) split() {
+	start := -1
+	for i := 0; i <= len(p.line); i++ {
+		if i == len(p.line) || p.line[i] == ' ' || p.line[i] == '\t' || p.line[i] == '\r' {
+			if start != -1 {
+				p.fields = append(p.fields, bytes.TrimSuffix(p.line[start:i], []byte(",")))
+				p.columns = append(p.columns, start+1)
+				start = -1
+			}
+			continue
+		} else if start == -1 {
+			start = i
+		}
+	}
+}
+
+// errorf returns an error at the provided field. When the field is beyond the
+// end of the line, the error is reported at the end of the line.
+func (p *parser) errorf(field int, format string, a ...interface{}) error {
+	column := len(p.line) + 1
+	if field < len(p.columns) {
+		column = p.columns[field]
+	}
+	return &Error{Line: p.lineNumber, Column: column, Err: fmt.Errorf(format, a...)}
+}
+
+func (p *parser) int(field int, min int, max int) (int, error) {
+	v, err := strconv.Atoi(string(p.fields[field]))
+	if err != nil {
+		return 0, p.errorf(field, "invalid number %q", p.fields[field])
+	} else if v < min || v > max {
+		return 0, p.errorf(field, "%d is out of range (%d-%d)", v, min, max)
+	}
+	return v, nil
+}
+
+func (p *parser) parseHeader() (*Header, error) {
+	if len(p.fields) != 10 {
+		return nil, p.errorf(len(p.fields), "expected 10 fields, found %d", len(p.fields))
+	}
+	started, err := strconv.ParseInt(string(p.fields[1]), 10, 64)
+	if err != nil {
+		return nil, p.errorf(1, "invalid timestamp %q", p.fields[1])
+	}
+	r := &Header{
+		Line:    Line(p.lineNumber),
+		Started: started,
+		Player1: string(p.fields[2]),
+		Player2: string(p.fields[3]),
+	}
+	values := []*int8{&r.Points, &r.Score1, &r.Score2, &r.Winner, &r.DoubleValue, &r.Variant}
+	limits := [][2]int{{1, 127}, {0, 127}, {0, 127}, {0, 2}, {1, 64}, {int(bgammon.VariantBackgammon), int(bgammon.VariantTabula)}}
+	for i, value := range values {
+		v, err := p.int(4+i, limits[i][0], limits[i][1])
+		if err != nil {
+			return nil, err
+		}
+		*value = int8(v)
+	}
+	return r, nil
+}
+
+func (p *parser) parseRoll(player int8) (*Roll, error) {
+	if len(p.fields) < 3 {
+		return nil, p.errorf(2, "expected roll")
+	}
+	dice := bytes.Split(p.fields[2], []byte("-"))
+	if len(dice) < 2 || len(dice) > 3 {
+		return nil, p.errorf(2, "invalid roll %q", p.fields[2])
+	}
+	r := &Roll{
+		Line:   Line(p.lineNumber),
+		Player: player,
+	}
+	rolls := []*int8{&r.Roll1, &r.Roll2, &r.Roll3}
+	for i, die := range dice {
+		if len(die) != 1 || die[0] < '1' || die[0] > '6' {
+			return nil, p.errorf(2, "invalid roll %q", p.fields[2])
+		}
+		*rolls[i] = int8(die[0] - '0')
+	}
+
+	for i, move := range p.fields[3:] {
+		field := 3 + i
+		split := bytes.Split(move, []byte("/"))
+		if len(split) != 2 {
+			return nil, p.errorf(field, "%w %q", ErrInvalidMove, move)
+		}
+		from, to := bgammon.ParseSpace(string(split[0])), bgammon.ParseSpace(string(split[1]))
+		if from < 0 || from >= bgammon.BoardSpaces || to < 0 || to >= bgammon.BoardSpaces || from == to {
+			return nil, p.errorf(field, "%w %q", ErrInvalidMove, move)
+		}
+		// The bar and home spaces are written from the perspective of the
+		// player moving.
+		from, to = playerSpace(from, player), playerSpace(to, player)
+		if from == to {
+			return nil, p.errorf(field, "%w %q", ErrInvalidMove, move)
+		}
+		r.Moves = append(r.Moves, []int8{from, to})
+	}
+	return r, nil
+}
+
+// playerSpace returns the bar or home space of the provided player when the
+// space is a bar or home space. Other spaces are returned unchanged.
+func playerSpace(space int8, player int8) int8 {
+	switch space {
+	case bgammon.SpaceBarPlayer, bgammon.SpaceBarOpponent:
+		if player == 2 {
+			return bgammon.SpaceBarOpponent
+		}
+		return bgammon.SpaceBarPlayer
+	case bgammon.SpaceHomePlayer, bgammon.SpaceHomeOpponent:
+		if player == 2 {
+			return bgammon.SpaceHomeOpponent
+		}
+		return bgammon.SpaceHomePlayer
+	}
+	return space
+}
+
+func (p *parser) parseDouble(player int8) (*Double, error) {
+	if len(p.fields) != 4 {
+		return nil, p.errorf(len(p.fields), "expected cube value and response")
+	}
+	value, err := p.int(2, 2, 64)
+	if err != nil {
+		return nil, err
+	}
+	accepted, err := p.int(3, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &Double{
+		Line:     Line(p.lineNumber),
+		Player:   player,
+		Value:    int8(value),
+		Accepted: accepted == 1,
+	}, nil
+}
+
+// WinPoints returns the number of points the game is worth to the winner
+// without applying the doubling cube.
+func WinPoints(g *bgammon.Game, winner int8) int8 {
+	var opponent int8 = 1
+	opponentHome := bgammon.SpaceHomePlayer
+	opponentEntered := g.Player1.Entered
+	playerBar := bgammon.SpaceBarPlayer
+	if winner == 1 {
+		opponent = 2
+		opponentHome = bgammon.SpaceHomeOpponent
+		opponentEntered = g.Player2.Entered
+		playerBar = bgammon.SpaceBarOpponent
+	}
+
+	if g.Variant == bgammon.VariantAceyDeucey {
+		var points int8
+		for space := int8(0); space < bgammon.BoardSpaces; space++ {
+			if (space == bgammon.SpaceHomePlayer || space == bgammon.SpaceHomeOpponent) && opponentEntered {
+				continue
+			}
+			points += bgammon.PlayerCheckers(g.Board[space], opponent)
+		}
+		return points
+	}
+
+	backgammon := g.Variant == bgammon.VariantTabula && !opponentEntered
+	if !backgammon {
+		backgammon = bgammon.PlayerCheckers(g.Board[playerBar], opponent) != 0
+	}
+	if !backgammon {
+		homeStart, homeEnd := bgammon.HomeRange(winner, g.Variant)
+		bgammon.IterateSpaces(homeStart, homeEnd, g.Variant, func(space int8, spaceCount int8) {
+			if bgammon.PlayerCheckers(g.Board[space], opponent) != 0 {
+				backgammon = true
+			}
+		})
+	}
+	switch {
+	case backgammon:
+		return 3
+	case g.Board[opponentHome] == 0:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func opponent(player int8) int8 {
+	if player == 1 {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,379 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"codeberg.org/tslocum/bgammon"
+)
+
+// testMatches returns the contents of the replays in the testdata directory.
+func testMatches(t testing.TB) map[string][]byte {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.match"))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(paths) == 0 {
+		t.Fatal("no replays found in testdata")
+	}
+	matches := make(map[string][]byte)
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches[filepath.Base(p)] = data
+	}
+	return matches
+}
+
+func writeMatch(t testing.TB, m *Match) []byte {
+	buf := &bytes.Buffer{}
+	err := m.WriteMatch(buf)
+	if err != nil {
+		t.Fatalf("failed to write match: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	for name, data := range testMatches(t) {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("failed to parse replay: %s", err)
+			}
+			for i, game := range m.Games {
+				frames, err := game.Frames()
+				if err != nil {
+					t.Fatalf("game %d: failed to apply records: %s", i+1, err)
+				}
+				winner, _ := game.Result(frames[len(frames)-1], nil)
+				if winner != game.Header.Winner {
+					t.Errorf("game %d: expected winner %d, got %d", i+1, game.Header.Winner, winner)
+				}
+			}
+			written := writeMatch(t, m)
+			parsed, err := Parse(bytes.NewReader(written))
+			if err != nil {
+				t.Fatalf("failed to parse written replay: %s", err)
+			}
+			for i := range m.Games {
+				if !equalGames(m.Games[i], parsed.Games[i]) {
+					t.Errorf("game %d differs after writing replay:\n%s", i+1, written)
+				}
+			}
+
+			// The server writes an index before a single game.
+			expected := data
+			if len(m.Games) == 1 && bytes.HasPrefix(data, []byte("bgammon-replay ")) {
+				expected = data[bytes.IndexByte(data, '\n')+1:]
+			}
+			if !bytes.Equal(written, expected) {
+				t.Errorf("written replay differs from original replay:\n%s", written)
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, data := range testMatches(f) {
+		f.Add(data)
+	}
+	f.Add([]byte("i 1 a b 3 0 0 0 1 0\n1 r 6-5 24/18 18/13\n2 d 2 1\n2 r 3-3 bar/22 6/3 6/3 8/5\n1 t\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		m, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		written := writeMatch(t, m)
+		parsed, err := Parse(bytes.NewReader(written))
+		if err != nil {
+			t.Fatalf("failed to parse written replay: %s\n%s", err, written)
+		}
+		if len(parsed.Games) != len(m.Games) {
+			t.Fatalf("expected %d games, got %d", len(m.Games), len(parsed.Games))
+		}
+		for i := range m.Games {
+			if !equalGames(m.Games[i], parsed.Games[i]) {
+				t.Fatalf("game %d differs after writing replay:\n%s", i+1, written)
+			}
+		}
+		if rewritten := writeMatch(t, parsed); !bytes.Equal(rewritten, written) {
+			t.Fatalf("replay differs after writing twice:\n%s\n%s", written, rewritten)
+		}
+	})
+}
+
+// equalGames returns whether two games contain the same header and records.
+// Line numbers are not compared.
+func equalGames(a *Game, b *Game) bool {
+	if len(a.Records) != len(b.Records) {
+		return false
+	}
+	ha, hb := *a.Header, *b.Header
+	ha.Line, hb.Line = 0, 0
+	if ha != hb {
+		return false
+	}
+	for i := range a.Records {
+		var ra, rb Record
+		switch r := a.Records[i].(type) {
+		case *Roll:
+			c := *r
+			c.Line = 0
+			ra = &c
+		case *Double:
+			c := *r
+			c.Line = 0
+			ra = &c
+		case *Resign:
+			c := *r
+			c.Line = 0
+			ra = &c
+		}
+		switch r := b.Records[i].(type) {
+		case *Roll:
+			c := *r
+			c.Line = 0
+			rb = &c
+		case *Double:
+			c := *r
+			c.Line = 0
+			rb = &c
+		case *Resign:
+			c := *r
+			c.Line = 0
+			rb = &c
+		}
+		if !reflect.DeepEqual(ra, rb) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestError(t *testing.T) {
+	const header = "i 1 a b 1 0 0 0 1 0\n"
+	tests := []struct {
+		replay  string
+		line    int
+		column  int
+		message string
+	}{
+		{"", 0, 0, "line 0: no games"},
+		{"x", 1, 1, `line 1, column 1: unknown record "x"`},
+		{"1 r 3-1 8/5 6/5", 1, 1, "line 1, column 1: record precedes game header"},
+		{"i x a b 1 0 0 0 1 0", 1, 3, `line 1, column 3: invalid timestamp "x"`},
+		{"i 1 a b 0 0 0 0 1 0", 1, 9, "line 1, column 9: 0 is out of range (1-127)"},
+		{"i 1 a b 1 0 0 0 1", 1, 18, "line 1, column 18: expected 10 fields, found 9"},
+		{header + "bgammon-replay 24", 2, 1, "line 2, column 1: index follows game"},
+		{header + "1 r 7-1", 2, 5, `line 2, column 5: invalid roll "7-1"`},
+		{header + "1 x", 2, 3, `line 2, column 3: unknown action "x"`},
+		{header + "1 d 2", 2, 6, "line 2, column 6: expected cube value and response"},
+		{header + "1 d 2 3", 2, 7, "line 2, column 7: 3 is out of range (0-1)"},
+		{header + "1 t 1", 2, 5, "line 2, column 5: unexpected field"},
+		{header + "\n  2 r 3-1 13/13", 3, 11, `line 3, column 11: invalid move "13/13"`},
+		{header + "1 r 3-1 8/5, 6/x", 2, 14, `line 2, column 14: invalid move "6/x"`},
+	}
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.replay))
+		var replayErr *Error
+		if !errors.As(err, &replayErr) {
+			t.Errorf("%q: expected *Error, got %v", test.replay, err)
+			continue
+		}
+		if replayErr.Line != test.line || replayErr.Column != test.column {
+			t.Errorf("%q: expected line %d column %d, got line %d column %d", test.replay, test.line, test.column, replayErr.Line, replayErr.Column)
+		}
+		if replayErr.Error() != test.message {
+			t.Errorf("%q: expected message %q, got %q", test.replay, test.message, replayErr.Error())
+		}
+	}
+}
+
+func TestApplyIllegalMove(t *testing.T) {
+	m, err := Parse(strings.NewReader("i 1 a b 1 0 0 0 1 0\n1 r 3-1 8/5 6/5\n2 r 2-1 1/7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Games[0].Frames()
+	var replayErr *Error
+	if !errors.As(err, &replayErr) || replayErr.Line != 3 {
+		t.Fatalf("expected error on line 3, got %v", err)
+	}
+}
+
+const testMat = `; [Player 1 "Alice Smith"]
+; [Player 2 "Bob"]
+; [EventDate "2024.05.01"]
+; [EventTime "12.30"]
+
+ 3 point match
+
+ Game 1
+ Alice Smith : 0                     Bob : 0
+  1) 31: 8/5 6/5                     52: 13/11 13/8
+  2)  Doubles => 2                    Drops
+      Wins 1 point
+`
+
+func TestImport(t *testing.T) {
+	for name, data := range testMatches(t) {
+		imported, err := Import(data)
+		if err != nil {
+			t.Fatalf("%s: failed to import replay: %s", name, err)
+		} else if !bytes.Equal(imported, data) {
+			t.Errorf("%s: expected bgammon replay to be returned unchanged", name)
+		}
+	}
+
+	data, err := Import([]byte(testMat))
+	if err != nil {
+		t.Fatalf("failed to import match: %s", err)
+	}
+	m, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to parse imported match: %s", err)
+	} else if len(m.Games) != 1 {
+		t.Fatalf("expected 1 game, got %d", len(m.Games))
+	}
+
+	h := m.Games[0].Header
+	started := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC).Unix()
+	expected := Header{Line: 1, Started: started, Player1: "Alice_Smith", Player2: "Bob", Points: 3, Winner: 1, DoubleValue: 1, Variant: bgammon.VariantBackgammon}
+	if *h != expected {
+		t.Errorf("expected header %+v, got %+v", expected, *h)
+	}
+
+	records := []Record{
+		&Roll{Line: 2, Player: 1, Roll1: 3, Roll2: 1, Moves: [][]int8{{8, 5}, {6, 5}}},
+		&Roll{Line: 3, Player: 2, Roll1: 5, Roll2: 2, Moves: [][]int8{{12, 14}, {12, 17}}},
+		&Double{Line: 4, Player: 1, Value: 2},
+	}
+	if !reflect.DeepEqual(m.Games[0].Records, records) {
+		t.Errorf("unexpected records:\n%s", data)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		line int
+		err  error
+	}{
+		{" 1 point match\n Game 1\n  1) 31: 8/5 6/x\n", 3, ErrInvalidMove},
+		{" 1 point match\n Game 1\n  1) 31: 8/2\n", 3, ErrIllegalMove},
+		{" 1 point match\n Game 1\n  1)  Takes\n", 3, ErrUnexpectedAction},
+		{"; [Variation \"Nackgammon\"]\n 1 point match\n Game 1\n", 3, ErrUnsupportedVariant},
+	}
+	for _, test := range tests {
+		_, err := Import([]byte(test.data))
+		var replayErr *Error
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: expected %v, got %v", test.data, test.err, err)
+		} else if !errors.As(err, &replayErr) {
+			t.Errorf("%q: expected *Error, got %v", test.data, err)
+		} else if replayErr.Line != test.line {
+			t.Errorf("%q: expected error on line %d, got %v", test.data, test.line, err)
+		}
+	}
+}
+
+func TestWriteMat(t *testing.T) {
+	for name, data := range testMatches(t) {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, metadata := range []bool{true, false} {
+				buf := &bytes.Buffer{}
+				err := m.WriteMat(buf, metadata)
+				if m.Games[0].Header.Variant != bgammon.VariantBackgammon && !metadata {
+					if !errors.Is(err, ErrUnsupportedVariant) {
+						t.Errorf("expected ErrUnsupportedVariant, got %v", err)
+					}
+					continue
+				} else if err != nil {
+					t.Fatalf("failed to write match: %s", err)
+				}
+
+				imported, err := ParseMat(bytes.NewReader(buf.Bytes()))
+				if err != nil {
+					t.Fatalf("failed to import written match: %s\n%s", err, buf.Bytes())
+				} else if len(imported.Games) != len(m.Games) {
+					t.Fatalf("expected %d games, got %d", len(m.Games), len(imported.Games))
+				}
+				for i, game := range imported.Games {
+					// Only the date and time of the first game are written,
+					// to the minute.
+					expected := *m.Games[i]
+					header := *expected.Header
+					header.Started = game.Header.Started
+					if !metadata {
+						header.Player1, header.Player2 = game.Header.Player1, game.Header.Player2
+					}
+					expected.Header = &header
+					if !equalGames(&expected, game) {
+						t.Errorf("game %d differs after writing match (metadata %v):\n%s", i+1, metadata, buf.Bytes())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParsePositionID(t *testing.T) {
+	g, err := ParsePositionID("4HPwATDgc/ABMA")
+	if err != nil {
+		t.Fatalf("failed to parse position ID: %s", err)
+	}
+	start := bgammon.NewBoard(bgammon.VariantBackgammon)
+	if !reflect.DeepEqual(g.Board, start) {
+		t.Errorf("expected starting position %v, got %v", start, g.Board)
+	}
+	if g.Turn != 1 {
+		t.Errorf("expected turn 1, got %d", g.Turn)
+	}
+
+	// Each player has one checker on the bar and two checkers borne off.
+	g, err = ParsePositionID("4Bx8ABQ4Bx8ABQ")
+	if err != nil {
+		t.Fatalf("failed to parse position ID: %s", err)
+	}
+	var player, opponent int
+	for i, checkers := range g.Board {
+		space := int8(i)
+		if checkers > 0 {
+			player += int(checkers)
+		} else if checkers < 0 {
+			opponent -= int(checkers)
+		}
+		if space == bgammon.SpaceHomePlayer && checkers != 2 {
+			t.Errorf("expected 2 checkers borne off by player, got %d", checkers)
+		} else if space == bgammon.SpaceHomeOpponent && checkers != -2 {
+			t.Errorf("expected 2 checkers borne off by opponent, got %d", -checkers)
+		} else if space == bgammon.SpaceBarPlayer && checkers != 1 {
+			t.Errorf("expected 1 checker on the bar of player, got %d", checkers)
+		} else if space == bgammon.SpaceBarOpponent && checkers != -1 {
+			t.Errorf("expected 1 checker on the bar of opponent, got %d", -checkers)
+		}
+	}
+	if player != 15 || opponent != 15 {
+		t.Errorf("expected 15 checkers per player, got %d and %d", player, opponent)
+	}
+
+	for _, id := range []string{"", "4HPwATDgc", "4HPwATDgc/ABMA/ABMA", "!!!!!!!!!!!!!!", "//////////////"} {
+		_, err := ParsePositionID(id)
+		if err == nil {
+			t.Errorf("%q: expected error", id)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sgfNode is a node of an SGF game tree.
+type sgfNode struct {
+	line       int
+	properties map[string][]string
+}
+
+func (n *sgfNode) value(property string) string {
+	values := n.properties[property]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// sgfParser reads SGF game trees. Only the main line of each game tree is
+// read, as variations are not played.
+type sgfParser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *sgfParser) errorf(format string, a ...interface{}) error {
+	return &Error{Line: p.line, Err: fmt.Errorf(format, a...)}
+}
+
+// next returns the next character which is not whitespace, or 0 at the end of
+// the input.
+func (p *sgfParser) next() byte {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch c {
+		case '\n':
+			p.line++
+			fallthrough
+		case ' ', '\t', '\r':
+			p.pos++
+			continue
+		}
+		return c
+	}
+	return 0
+}
+
+func (p *sgfParser) parseTree() ([]*sgfNode, error) {
+	if p.next() != '(' {
+		return nil, p.errorf("expected game tree")
+	}
+	p.pos++
+	var nodes []*sgfNode
+	for p.next() == ';' {
+		p.pos++
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	for i := 0; p.next() == '('; i++ {
+		variation, err := p.parseTree()
+		if err != nil {
+			return nil, err
+		} else if i == 0 {
+			nodes = append(nodes, variation...)
+		}
+	}
+	if p.next() != ')' {
+		return nil, p.errorf("expected end of game tree")
+	}
+	p.pos++
+	return nodes, nil
+}
+
+func (p *sgfParser) parseNode() (*sgfNode, error) {
+	node := &sgfNode{line: p.line, properties: make(map[string][]string)}
+	for {
+		c := p.next()
+		if c < 'A' || c > 'Z' {
+			return node, nil
+		}
+		start := p.pos
+		for p.pos < len(p.data) && p.data[p.pos] >= 'A' && p.data[p.pos] <= 'Z' {
+			p.pos++
+		}
+		property := string(p.data[start:p.pos])
+		if p.next() != '[' {
+			return nil, p.errorf("expected value of property %s", property)
+		}
+		for p.next() == '[' {
+			p.pos++
+			value := &strings.Builder{}
+			for {
+				if p.pos >= len(p.data) {
+					return nil, p.errorf("unterminated value of property %s", property)
+				}
+				c := p.data[p.pos]
+				p.pos++
+				if c == '\n' {
+					p.line++
+				}
+				if c == ']' {
+					break
+				} else if c == '\\' && p.pos < len(p.data) {
+					c = p.data[p.pos]
+					p.pos++
+				}
+				value.WriteByte(c)
+			}
+			node.properties[property] = append(node.properties[property], value.String())
+		}
+	}
+}
+
+// ParseSGF parses a match in the SGF format written by GNU Backgammon. Each
+// game of the match is a separate game tree.
+func ParseSGF(r io.Reader) (*Match, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &sgfParser{data: data, line: 1}
+	m := &Match{}
+	for p.next() == '(' {
+		nodes, err := p.parseTree()
+		if err != nil {
+			return nil, err
+		} else if len(nodes) == 0 {
+			continue
+		}
+		game, err := sgfGame(nodes)
+		if err != nil {
+			return nil, err
+		}
+		m.Games = append(m.Games, game)
+	}
+	if p.next() != 0 {
+		return nil, p.errorf("expected game tree")
+	} else if len(m.Games) == 0 {
+		return nil, &Error{Line: p.line, Err: errors.New("no games")}
+	}
+	return m, nil
+}
+
+// sgfGame converts the main line of an SGF game tree to a game. White is
+// player 1 and black is player 2.
+func sgfGame(nodes []*sgfNode) (*Game, error) {
+	root := nodes[0]
+	if gm := root.value("GM"); gm != "" && gm != "6" {
+		return nil, &Error{Line: root.line, Err: fmt.Errorf("unsupported game type %s", gm)}
+	}
+	h := &Header{
+		Line:        Line(root.line),
+		Player1:     matPlayerName(root.value("PW")),
+		Player2:     matPlayerName(root.value("PB")),
+		Points:      1,
+		DoubleValue: 1,
+	}
+	if t, err := time.Parse("2006-01-02", root.value("DT")); err == nil {
+		h.Started = t.Unix()
+	}
+	for _, info := range root.properties["MI"] {
+		key, value, _ := strings.Cut(info, ":")
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 0 || v > 127 {
+			continue
+		}
+		switch key {
+		case "length":
+			if v > 0 {
+				h.Points = int8(v)
+			}
+		case "ws":
+			h.Score1 = int8(v)
+		case "bs":
+			h.Score2 = int8(v)
+		}
+	}
+	if result := root.value("RE"); len(result) > 1 && result[1] == '+' {
+		switch result[0] {
+		case 'W':
+			h.Winner = 1
+		case 'B':
+			h.Winner = 2
+		}
+	}
+
+	game := &Game{Header: h}
+	var double *Double
+	for _, node := range nodes {
+		player, action := int8(1), node.value("W")
+		if _, ok := node.properties["B"]; ok {
+			player, action = 2, node.value("B")
+		} else if _, ok := node.properties["W"]; !ok {
+			continue
+		}
+		switch action {
+		case "double":
+			double = &Double{Line: Line(node.line), Player: player, Value: h.DoubleValue * 2}
+			h.DoubleValue *= 2
+		case "take", "drop":
+			if double == nil || double.Player == player {
+				return nil, &Error{Line: node.line, Err: fmt.Errorf("unexpected %s", action)}
+			}
+			double.Accepted = action == "take"
+			game.Records = append(game.Records, double)
+			double = nil
+		default:
+			roll, err := sgfRoll(node, player, action)
+			if err != nil {
+				return nil, err
+			}
+			game.Records = append(game.Records, roll)
+		}
+	}
+	err := importGame(game)
+	if err != nil {
+		return nil, err
+	}
+	return game, nil
+}
+
+// sgfRoll parses a roll followed by the moves played. Each move is a pair of
+// spaces, where 'a' through 'x' are the points numbered from the perspective
+// of black, 'y' is the bar and 'z' is the home space.
+func sgfRoll(node *sgfNode, player int8, action string) (*Roll, error) {
+	if len(action) < 2 || len(action)%2 != 0 || action[0] < '1' || action[0] > '6' || action[1] < '1' || action[1] > '6' {
+		return nil, &Error{Line: node.line, Err: fmt.Errorf("invalid move %q", action)}
+	}
+	r := &Roll{Line: Line(node.line), Player: player, Roll1: int8(action[0] - '0'), Roll2: int8(action[1] - '0')}
+	for i := 2; i < len(action); i += 2 {
+		from, to := sgfSpace(action[i], player), sgfSpace(action[i+1], player)
+		if from < 0 || to < 0 {
+			return nil, &Error{Line: node.line, Err: fmt.Errorf("invalid move %q", action)}
+		}
+		r.Moves = append(r.Moves, []int8{from, to})
+	}
+	return r, nil
+}
+
+// sgfSpace returns the absolute space of an SGF point.
+func sgfSpace(c byte, player int8) int8 {
+	switch {
+	case c >= 'a' && c <= 'x':
+		return 24 - int8(c-'a')
+	case c == 'y':
+		return importSpace(25, player)
+	case c == 'z':
+		return importSpace(0, player)
+	}
+	return -1
+}